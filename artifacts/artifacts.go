@@ -0,0 +1,157 @@
+package artifacts
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"github.com/p0tr3c/terra-ci/aws"
+)
+
+const (
+	refChecksumSeparator     = "#sha256="
+	refJsonChecksumSeparator = "&json_sha256="
+	planJsonSuffix           = ".json"
+)
+
+// Store keeps artifacts handed over between executions. Put returns
+// location of stored artifact, which is accepted by Get.
+type Store interface {
+	Put(key string, data []byte) (string, error)
+	Get(location string) ([]byte, error)
+}
+
+// NewStore returns store for uri, either s3://bucket/prefix or local
+// directory path, optionally prefixed with file://.
+func NewStore(uri string, client *aws.Client) (Store, error) {
+	if strings.HasPrefix(uri, "s3://") {
+		if client == nil {
+			return nil, fmt.Errorf("s3 artifact store %s requires aws client", uri)
+		}
+		return NewS3Store(client.S3, uri)
+	}
+	return NewLocalStore(strings.TrimPrefix(uri, "file://"))
+}
+
+// Ref references stored artifact together with checksum of its content.
+// References of plans also hold checksum of plan json stored next to the
+// plan.
+type Ref struct {
+	Location   string
+	Sha256     string
+	JsonSha256 string
+}
+
+func (r *Ref) String() string {
+	ref := r.Location + refChecksumSeparator + r.Sha256
+	if r.JsonSha256 != "" {
+		ref += refJsonChecksumSeparator + r.JsonSha256
+	}
+	return ref
+}
+
+// ParseRef parses reference formatted as location#sha256=checksum,
+// optionally followed by &json_sha256=checksum.
+func ParseRef(ref string) (*Ref, error) {
+	invalid := fmt.Errorf("invalid artifact reference %q, expected location%schecksum", ref, refChecksumSeparator)
+	parts := strings.SplitN(ref, refChecksumSeparator, 2)
+	if len(parts) != 2 || parts[0] == "" {
+		return nil, invalid
+	}
+	checksums := strings.SplitN(parts[1], refJsonChecksumSeparator, 2)
+	if len(checksums[0]) != sha256.Size*2 || (len(checksums) == 2 && len(checksums[1]) != sha256.Size*2) {
+		return nil, invalid
+	}
+	parsed := &Ref{
+		Location: parts[0],
+		Sha256:   checksums[0],
+	}
+	if len(checksums) == 2 {
+		parsed.JsonSha256 = checksums[1]
+	}
+	return parsed, nil
+}
+
+func checksum(data []byte) string {
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+// Put stores data under key and returns its reference.
+func Put(store Store, key string, data []byte) (*Ref, error) {
+	location, err := store.Put(key, data)
+	if err != nil {
+		return nil, err
+	}
+	return &Ref{
+		Location: location,
+		Sha256:   checksum(data),
+	}, nil
+}
+
+// Get returns referenced artifact, failing when its content does not match
+// the checksum.
+func Get(store Store, ref *Ref) ([]byte, error) {
+	data, err := store.Get(ref.Location)
+	if err != nil {
+		return nil, err
+	}
+	if actual := checksum(data); actual != ref.Sha256 {
+		return nil, fmt.Errorf("checksum of %s is %s, expected %s, artifact was modified", ref.Location, actual, ref.Sha256)
+	}
+	return data, nil
+}
+
+// GetRef returns referenced artifact from store derived from its location.
+func GetRef(ref *Ref, client *aws.Client) ([]byte, error) {
+	store, err := NewStore(ref.Location, client)
+	if err != nil {
+		return nil, err
+	}
+	return Get(store, ref)
+}
+
+// PlanKey returns key of binary plan produced by the execution. Workspace
+// path must stay under the plans prefix.
+func PlanKey(workspacePath, executionArn string) (string, error) {
+	parts := strings.Split(executionArn, ":")
+	executionName := parts[len(parts)-1]
+	workspaceKey := path.Clean(strings.Trim(filepath.ToSlash(workspacePath), "/"))
+	if workspaceKey == "." || workspaceKey == ".." || strings.HasPrefix(workspaceKey, "../") {
+		return "", fmt.Errorf("workspace path %s escapes artifact store prefix", workspacePath)
+	}
+	if executionName == "" || executionName == "." || executionName == ".." || strings.Contains(executionName, "/") {
+		return "", fmt.Errorf("invalid execution name %q of %s", executionName, executionArn)
+	}
+	return fmt.Sprintf("plans/%s/%s/tfplan", workspaceKey, executionName), nil
+}
+
+// PutPlan stores plan with its plan json next to it, under key derived
+// from planKey, and returns reference holding checksums of both.
+func PutPlan(store Store, planKey string, plan, planJson []byte) (*Ref, error) {
+	jsonRef, err := Put(store, planKey+planJsonSuffix, planJson)
+	if err != nil {
+		return nil, err
+	}
+	ref, err := Put(store, planKey, plan)
+	if err != nil {
+		return nil, err
+	}
+	ref.JsonSha256 = jsonRef.Sha256
+	return ref, nil
+}
+
+// GetPlanJson returns plan json stored next to referenced plan, failing
+// when its content does not match the checksum of the reference.
+func GetPlanJson(ref *Ref, client *aws.Client) ([]byte, error) {
+	if ref.JsonSha256 == "" {
+		return nil, fmt.Errorf("reference of %s has no plan json checksum", ref.Location)
+	}
+	return GetRef(&Ref{
+		Location: ref.Location + planJsonSuffix,
+		Sha256:   ref.JsonSha256,
+	}, client)
+}
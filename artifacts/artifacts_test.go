@@ -0,0 +1,194 @@
+package artifacts
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/p0tr3c/terra-ci/aws"
+	"github.com/p0tr3c/terra-ci/aws/awstest"
+)
+
+func TestLocalStoreRoundTrip(t *testing.T) {
+	dir := t.TempDir()
+	store, err := NewStore("file://"+dir, nil)
+	if err != nil {
+		t.Fatalf("failed to create store: %s", err)
+	}
+	ref, err := Put(store, "plans/live/prod/vpc/exec/tfplan", []byte("plan"))
+	if err != nil {
+		t.Fatalf("failed to put artifact: %s", err)
+	}
+	if expected := "file://" + filepath.Join(dir, "plans", "live", "prod", "vpc", "exec", "tfplan"); ref.Location != expected {
+		t.Fatalf("expected location %s, got %s", expected, ref.Location)
+	}
+
+	parsed, err := ParseRef(ref.String())
+	if err != nil {
+		t.Fatalf("failed to parse reference %s: %s", ref, err)
+	}
+	data, err := GetRef(parsed, nil)
+	if err != nil {
+		t.Fatalf("failed to get artifact: %s", err)
+	}
+	if string(data) != "plan" {
+		t.Fatalf("expected %q, got %q", "plan", data)
+	}
+}
+
+func TestGetChecksumMismatch(t *testing.T) {
+	store, err := NewLocalStore(t.TempDir())
+	if err != nil {
+		t.Fatalf("failed to create store: %s", err)
+	}
+	ref, err := Put(store, "tfplan", []byte("plan"))
+	if err != nil {
+		t.Fatalf("failed to put artifact: %s", err)
+	}
+	if err := ioutil.WriteFile(strings.TrimPrefix(ref.Location, "file://"), []byte("modified"), 0644); err != nil {
+		t.Fatalf("failed to modify artifact: %s", err)
+	}
+	_, err = Get(store, ref)
+	if err == nil || !strings.Contains(err.Error(), "artifact was modified") {
+		t.Fatalf("expected checksum mismatch, got %v", err)
+	}
+}
+
+func TestS3StoreRoundTrip(t *testing.T) {
+	s3Client := awstest.NewFakeS3()
+	client := aws.NewClientWithAPI(awstest.NewFakeSfn(nil), awstest.NewFakeCloudwatch(), s3Client)
+	store, err := NewStore("s3://bucket/terra-ci/", client)
+	if err != nil {
+		t.Fatalf("failed to create store: %s", err)
+	}
+	ref, err := Put(store, "tfplan", []byte("plan"))
+	if err != nil {
+		t.Fatalf("failed to put artifact: %s", err)
+	}
+	if ref.Location != "s3://bucket/terra-ci/tfplan" {
+		t.Fatalf("unexpected location %s", ref.Location)
+	}
+	if _, ok := s3Client.Objects["bucket/terra-ci/tfplan"]; !ok {
+		t.Fatalf("artifact was not stored in bucket")
+	}
+	data, err := GetRef(ref, client)
+	if err != nil || string(data) != "plan" {
+		t.Fatalf("expected %q, got %q, %v", "plan", data, err)
+	}
+
+	if _, err := NewStore("s3://bucket", nil); err == nil {
+		t.Fatalf("expected s3 store without client to be rejected")
+	}
+}
+
+func TestParseRef(t *testing.T) {
+	checksum := strings.Repeat("a", 64)
+	tests := []struct {
+		ref      string
+		location string
+		valid    bool
+	}{
+		{ref: "s3://bucket/tfplan#sha256=" + checksum, location: "s3://bucket/tfplan", valid: true},
+		{ref: "/tmp/store/tfplan#sha256=" + checksum, location: "/tmp/store/tfplan", valid: true},
+		{ref: "s3://bucket/tfplan"},
+		{ref: "#sha256=" + checksum},
+		{ref: "s3://bucket/tfplan#sha256=abc"},
+		{ref: "s3://bucket/tfplan#md5=" + checksum},
+		{ref: "s3://bucket/tfplan#sha256=" + checksum + "&json_sha256=abc"},
+		{ref: "s3://bucket/tfplan#sha256=" + checksum + "&json_sha256=" + checksum, location: "s3://bucket/tfplan", valid: true},
+		{ref: ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.ref, func(t *testing.T) {
+			ref, err := ParseRef(tt.ref)
+			if !tt.valid {
+				if err == nil {
+					t.Fatalf("expected %q to be rejected", tt.ref)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %s", err)
+			}
+			if ref.Location != tt.location || ref.Sha256 != checksum {
+				t.Fatalf("unexpected reference %+v", ref)
+			}
+		})
+	}
+}
+
+func TestPlanKey(t *testing.T) {
+	arn := "arn:aws:states:eu-west-1:123:execution:plan:terra-ci-runner-plan-abc"
+	tests := []struct {
+		path string
+		arn  string
+		key  string
+	}{
+		{path: "/live/prod/vpc/", arn: arn, key: "plans/live/prod/vpc/terra-ci-runner-plan-abc/tfplan"},
+		{path: "live/prod/../dev/./vpc", arn: arn, key: "plans/live/dev/vpc/terra-ci-runner-plan-abc/tfplan"},
+		{path: "../x", arn: arn},
+		{path: "live/../../x", arn: arn},
+		{path: "..", arn: arn},
+		{path: "live/..", arn: arn},
+		{path: "live/prod/vpc", arn: "arn:aws:states:eu-west-1:123:execution:plan:.."},
+		{path: "live/prod/vpc", arn: "arn:aws:states:eu-west-1:123:execution:plan:"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.path+" "+tt.arn, func(t *testing.T) {
+			key, err := PlanKey(tt.path, tt.arn)
+			if tt.key == "" {
+				if err == nil {
+					t.Fatalf("expected %s to be rejected, got key %s", tt.path, key)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %s", err)
+			}
+			if key != tt.key {
+				t.Fatalf("expected key %s, got %s", tt.key, key)
+			}
+		})
+	}
+}
+
+func TestPlanJson(t *testing.T) {
+	dir := t.TempDir()
+	store, err := NewLocalStore(dir)
+	if err != nil {
+		t.Fatalf("failed to create store: %s", err)
+	}
+	ref, err := PutPlan(store, "plans/vpc/exec/tfplan", []byte("plan"), []byte(`{"format_version":"0.2"}`))
+	if err != nil {
+		t.Fatalf("failed to put plan: %s", err)
+	}
+	parsed, err := ParseRef(ref.String())
+	if err != nil {
+		t.Fatalf("failed to parse reference %s: %s", ref, err)
+	}
+	if parsed.JsonSha256 == "" || parsed.JsonSha256 != ref.JsonSha256 {
+		t.Fatalf("expected json checksum in reference %s", ref)
+	}
+	planJson, err := GetPlanJson(parsed, nil)
+	if err != nil || string(planJson) != `{"format_version":"0.2"}` {
+		t.Fatalf("unexpected plan json %q, %v", planJson, err)
+	}
+
+	// Plan json swapped in the store is rejected
+	if err := ioutil.WriteFile(filepath.Join(dir, "plans", "vpc", "exec", "tfplan.json"), []byte(`{"format_version":"0.2","resource_changes":[]}`), 0644); err != nil {
+		t.Fatalf("failed to tamper plan json: %s", err)
+	}
+	if _, err := GetPlanJson(parsed, nil); err == nil || !strings.Contains(err.Error(), "artifact was modified") {
+		t.Fatalf("expected tampered plan json to be rejected, got %v", err)
+	}
+	// Plan itself still matches
+	if _, err := GetRef(parsed, nil); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	// Reference without json checksum can not be used to read plan json
+	if _, err := GetPlanJson(&Ref{Location: ref.Location, Sha256: ref.Sha256}, nil); err == nil {
+		t.Fatalf("expected reference without json checksum to be rejected")
+	}
+}
@@ -0,0 +1,43 @@
+package artifacts
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+const (
+	defaultArtifactPermMode = 0644
+	defaultDirPermMode      = 0755
+)
+
+// LocalStore keeps artifacts in local directory.
+type LocalStore struct {
+	Dir string
+}
+
+func NewLocalStore(dir string) (*LocalStore, error) {
+	absDir, err := filepath.Abs(dir)
+	if err != nil {
+		return nil, err
+	}
+	return &LocalStore{
+		Dir: absDir,
+	}, nil
+}
+
+func (s *LocalStore) Put(key string, data []byte) (string, error) {
+	location := filepath.Join(s.Dir, filepath.FromSlash(key))
+	if err := os.MkdirAll(filepath.Dir(location), defaultDirPermMode); err != nil {
+		return "", err
+	}
+	if err := ioutil.WriteFile(location, data, defaultArtifactPermMode); err != nil {
+		return "", err
+	}
+	return "file://" + location, nil
+}
+
+func (s *LocalStore) Get(location string) ([]byte, error) {
+	return ioutil.ReadFile(strings.TrimPrefix(location, "file://"))
+}
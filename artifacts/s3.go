@@ -0,0 +1,43 @@
+package artifacts
+
+import (
+	"fmt"
+	"path"
+	"strings"
+
+	"github.com/p0tr3c/terra-ci/aws"
+)
+
+// S3Store keeps artifacts under prefix of S3 bucket.
+type S3Store struct {
+	*aws.S3
+	Bucket string
+	Prefix string
+}
+
+func NewS3Store(client *aws.S3, uri string) (*S3Store, error) {
+	bucketAndPrefix := strings.SplitN(strings.TrimPrefix(uri, "s3://"), "/", 2)
+	if bucketAndPrefix[0] == "" {
+		return nil, fmt.Errorf("invalid s3 artifact store %s", uri)
+	}
+	store := &S3Store{
+		S3:     client,
+		Bucket: bucketAndPrefix[0],
+	}
+	if len(bucketAndPrefix) == 2 {
+		store.Prefix = strings.Trim(bucketAndPrefix[1], "/")
+	}
+	return store, nil
+}
+
+func (s *S3Store) Put(key string, data []byte) (string, error) {
+	location := fmt.Sprintf("s3://%s/%s", s.Bucket, path.Join(s.Prefix, key))
+	if err := s.PutObject(location, data); err != nil {
+		return "", err
+	}
+	return location, nil
+}
+
+func (s *S3Store) Get(location string) ([]byte, error) {
+	return s.GetObject(location)
+}
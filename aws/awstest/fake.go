@@ -0,0 +1,439 @@
+// Package awstest provides in-memory fakes of AWS APIs used by terra-ci,
+// so remote executions can be tested offline.
+package awstest
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/p0tr3c/terra-ci/aws"
+
+	awssdk "github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/service/cloudwatchlogs"
+	"github.com/aws/aws-sdk-go/service/cloudwatchlogs/cloudwatchlogsiface"
+	"github.com/aws/aws-sdk-go/service/s3"
+	"github.com/aws/aws-sdk-go/service/s3/s3iface"
+	"github.com/aws/aws-sdk-go/service/sfn"
+	"github.com/aws/aws-sdk-go/service/sfn/sfniface"
+)
+
+const (
+	defaultFakeHistoryPageSize = 1000
+	defaultFakeLogsPageSize    = 100
+)
+
+// FakeSfn is in-memory implementation of SFN API. Every started execution
+// replays the scripted history, revealing EventsPerPoll more events each
+// time the last page of history is requested. Calls to APIs which are not
+// implemented panic through the embedded nil interface.
+type FakeSfn struct {
+	sfniface.SFNAPI
+
+	History       []*sfn.HistoryEvent
+	Output        string
+	EventsPerPoll int
+	PageSize      int
+
+	mu         sync.Mutex
+	Executions map[string]*FakeExecution
+	Started    []*sfn.StartExecutionInput
+}
+
+type FakeExecution struct {
+	Arn             string
+	Name            string
+	StateMachineArn string
+	Input           string
+	Output          string
+	StartDate       time.Time
+	History         []*sfn.HistoryEvent
+	Revealed        int
+}
+
+// Status returns execution status derived from revealed exit event.
+func (e *FakeExecution) Status() string {
+	for _, event := range e.History[:e.Revealed] {
+		switch *event.Type {
+		case "ExecutionSucceeded":
+			return sfn.ExecutionStatusSucceeded
+		case "ExecutionFailed":
+			return sfn.ExecutionStatusFailed
+		case "ExecutionTimedOut":
+			return sfn.ExecutionStatusTimedOut
+		case "ExecutionAborted":
+			return sfn.ExecutionStatusAborted
+		}
+	}
+	return sfn.ExecutionStatusRunning
+}
+
+func NewFakeSfn(history []*sfn.HistoryEvent) *FakeSfn {
+	return &FakeSfn{
+		History:       history,
+		EventsPerPoll: len(history),
+		PageSize:      defaultFakeHistoryPageSize,
+		Executions:    make(map[string]*FakeExecution),
+	}
+}
+
+func (f *FakeSfn) StartExecution(input *sfn.StartExecutionInput) (*sfn.StartExecutionOutput, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	arn := fmt.Sprintf("%s:%s", awssdk.StringValue(input.StateMachineArn), awssdk.StringValue(input.Name))
+	if _, ok := f.Executions[arn]; ok {
+		return nil, awserr.New(sfn.ErrCodeExecutionAlreadyExists,
+			fmt.Sprintf("execution %s already exists", arn), nil)
+	}
+	history := make([]*sfn.HistoryEvent, len(f.History))
+	copy(history, f.History)
+	f.Executions[arn] = &FakeExecution{
+		Arn:             arn,
+		Name:            awssdk.StringValue(input.Name),
+		StateMachineArn: awssdk.StringValue(input.StateMachineArn),
+		Input:           awssdk.StringValue(input.Input),
+		Output:          f.Output,
+		StartDate:       time.Now(),
+		History:         history,
+	}
+	f.Started = append(f.Started, input)
+	now := time.Now()
+	return &sfn.StartExecutionOutput{
+		ExecutionArn: awssdk.String(arn),
+		StartDate:    &now,
+	}, nil
+}
+
+func (f *FakeSfn) getExecution(arn *string) (*FakeExecution, error) {
+	execution, ok := f.Executions[awssdk.StringValue(arn)]
+	if !ok {
+		return nil, awserr.New(sfn.ErrCodeExecutionDoesNotExist,
+			fmt.Sprintf("execution %s does not exist", awssdk.StringValue(arn)), nil)
+	}
+	return execution, nil
+}
+
+func (f *FakeSfn) GetExecutionHistory(input *sfn.GetExecutionHistoryInput) (*sfn.GetExecutionHistoryOutput, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	execution, err := f.getExecution(input.ExecutionArn)
+	if err != nil {
+		return nil, err
+	}
+
+	start := 0
+	if input.NextToken != nil {
+		start, err = strconv.Atoi(*input.NextToken)
+		if err != nil {
+			return nil, fmt.Errorf("invalid token %s", *input.NextToken)
+		}
+	}
+	end := start + f.PageSize
+	if end >= execution.Revealed {
+		execution.Revealed += f.EventsPerPoll
+		if execution.Revealed > len(execution.History) {
+			execution.Revealed = len(execution.History)
+		}
+	}
+	if end > execution.Revealed {
+		end = execution.Revealed
+	}
+	output := &sfn.GetExecutionHistoryOutput{
+		Events: execution.History[start:end],
+	}
+	if end < execution.Revealed {
+		output.NextToken = awssdk.String(strconv.Itoa(end))
+	}
+	return output, nil
+}
+
+func (f *FakeSfn) DescribeExecution(input *sfn.DescribeExecutionInput) (*sfn.DescribeExecutionOutput, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	execution, err := f.getExecution(input.ExecutionArn)
+	if err != nil {
+		return nil, err
+	}
+	output := &sfn.DescribeExecutionOutput{
+		ExecutionArn:    awssdk.String(execution.Arn),
+		Name:            awssdk.String(execution.Name),
+		StateMachineArn: awssdk.String(execution.StateMachineArn),
+		Input:           awssdk.String(execution.Input),
+		StartDate:       awssdk.Time(execution.StartDate),
+		Status:          awssdk.String(execution.Status()),
+	}
+	if execution.Status() == sfn.ExecutionStatusSucceeded {
+		output.Output = awssdk.String(execution.Output)
+	}
+	return output, nil
+}
+
+func (f *FakeSfn) ListExecutions(input *sfn.ListExecutionsInput) (*sfn.ListExecutionsOutput, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	executions := []*FakeExecution{}
+	for _, execution := range f.Executions {
+		if execution.StateMachineArn != awssdk.StringValue(input.StateMachineArn) {
+			continue
+		}
+		if input.StatusFilter != nil && execution.Status() != *input.StatusFilter {
+			continue
+		}
+		executions = append(executions, execution)
+	}
+	sort.Slice(executions, func(i, j int) bool {
+		return executions[i].StartDate.After(executions[j].StartDate)
+	})
+
+	output := &sfn.ListExecutionsOutput{
+		Executions: []*sfn.ExecutionListItem{},
+	}
+	for _, execution := range executions {
+		output.Executions = append(output.Executions, &sfn.ExecutionListItem{
+			ExecutionArn:    awssdk.String(execution.Arn),
+			Name:            awssdk.String(execution.Name),
+			StateMachineArn: awssdk.String(execution.StateMachineArn),
+			StartDate:       awssdk.Time(execution.StartDate),
+			Status:          awssdk.String(execution.Status()),
+		})
+	}
+	return output, nil
+}
+
+// StopExecution discards not yet revealed events and schedules
+// ExecutionAborted event to be revealed with the next poll.
+func (f *FakeSfn) StopExecution(input *sfn.StopExecutionInput) (*sfn.StopExecutionOutput, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	execution, err := f.getExecution(input.ExecutionArn)
+	if err != nil {
+		return nil, err
+	}
+	if execution.Status() != sfn.ExecutionStatusRunning {
+		return nil, awserr.New(sfn.ErrCodeInvalidArn,
+			fmt.Sprintf("execution %s is not running", execution.Arn), nil)
+	}
+	lastEventId := int64(execution.Revealed)
+	execution.History = append(execution.History[:execution.Revealed:execution.Revealed], &sfn.HistoryEvent{
+		Id:              awssdk.Int64(lastEventId + 1),
+		PreviousEventId: awssdk.Int64(lastEventId),
+		Timestamp:       awssdk.Time(time.Now()),
+		Type:            awssdk.String("ExecutionAborted"),
+		ExecutionAbortedEventDetails: &sfn.ExecutionAbortedEventDetails{
+			Cause: input.Cause,
+		},
+	})
+	now := time.Now()
+	return &sfn.StopExecutionOutput{
+		StopDate: &now,
+	}, nil
+}
+
+// FakeCloudwatch is in-memory implementation of CloudWatch Logs API
+// serving scripted log streams.
+type FakeCloudwatch struct {
+	cloudwatchlogsiface.CloudWatchLogsAPI
+
+	PageSize int
+
+	mu      sync.Mutex
+	Streams map[string][]*cloudwatchlogs.OutputLogEvent
+}
+
+func NewFakeCloudwatch() *FakeCloudwatch {
+	return &FakeCloudwatch{
+		PageSize: defaultFakeLogsPageSize,
+		Streams:  make(map[string][]*cloudwatchlogs.OutputLogEvent),
+	}
+}
+
+func fakeStreamKey(groupName, streamName string) string {
+	return fmt.Sprintf("%s/%s", groupName, streamName)
+}
+
+// AddLogs appends messages to the log stream.
+func (f *FakeCloudwatch) AddLogs(groupName, streamName string, messages ...string) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	key := fakeStreamKey(groupName, streamName)
+	for _, message := range messages {
+		f.Streams[key] = append(f.Streams[key], &cloudwatchlogs.OutputLogEvent{
+			Message:   awssdk.String(message),
+			Timestamp: awssdk.Int64(time.Now().UnixNano() / int64(time.Millisecond)),
+		})
+	}
+}
+
+func (f *FakeCloudwatch) GetLogEvents(input *cloudwatchlogs.GetLogEventsInput) (*cloudwatchlogs.GetLogEventsOutput, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	events, ok := f.Streams[fakeStreamKey(awssdk.StringValue(input.LogGroupName), awssdk.StringValue(input.LogStreamName))]
+	if !ok {
+		return nil, awserr.New(cloudwatchlogs.ErrCodeResourceNotFoundException,
+			fmt.Sprintf("log stream %s does not exist", awssdk.StringValue(input.LogStreamName)), nil)
+	}
+
+	start := 0
+	if input.NextToken != nil {
+		var err error
+		start, err = parseLogsToken(*input.NextToken)
+		if err != nil {
+			return nil, err
+		}
+	}
+	if start > len(events) {
+		start = len(events)
+	}
+	end := start + f.PageSize
+	if end > len(events) {
+		end = len(events)
+	}
+	return &cloudwatchlogs.GetLogEventsOutput{
+		Events:            events[start:end],
+		NextForwardToken:  awssdk.String(fmt.Sprintf("f/%d", end)),
+		NextBackwardToken: awssdk.String(fmt.Sprintf("b/%d", start)),
+	}, nil
+}
+
+// parseLogsToken returns index of event referenced by f/<index> or
+// b/<index> token.
+func parseLogsToken(token string) (int, error) {
+	if !strings.HasPrefix(token, "f/") && !strings.HasPrefix(token, "b/") {
+		return 0, fmt.Errorf("invalid token %s", token)
+	}
+	index, err := strconv.Atoi(token[2:])
+	if err != nil || index < 0 {
+		return 0, fmt.Errorf("invalid token %s", token)
+	}
+	return index, nil
+}
+
+// FakeS3 is in-memory implementation of S3 API storing objects under
+// bucket/key.
+type FakeS3 struct {
+	s3iface.S3API
+
+	mu      sync.Mutex
+	Objects map[string][]byte
+}
+
+func NewFakeS3() *FakeS3 {
+	return &FakeS3{
+		Objects: make(map[string][]byte),
+	}
+}
+
+func fakeObjectKey(bucket, key string) string {
+	return fmt.Sprintf("%s/%s", bucket, key)
+}
+
+// AddObject stores object referenced by s3://bucket/key uri.
+func (f *FakeS3) AddObject(uri string, data []byte) error {
+	bucket, key, err := aws.ParseS3Uri(uri)
+	if err != nil {
+		return err
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.Objects[fakeObjectKey(bucket, key)] = data
+	return nil
+}
+
+func (f *FakeS3) PutObject(input *s3.PutObjectInput) (*s3.PutObjectOutput, error) {
+	data, err := ioutil.ReadAll(input.Body)
+	if err != nil {
+		return nil, err
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.Objects[fakeObjectKey(awssdk.StringValue(input.Bucket), awssdk.StringValue(input.Key))] = data
+	return &s3.PutObjectOutput{}, nil
+}
+
+func (f *FakeS3) GetObject(input *s3.GetObjectInput) (*s3.GetObjectOutput, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	data, ok := f.Objects[fakeObjectKey(awssdk.StringValue(input.Bucket), awssdk.StringValue(input.Key))]
+	if !ok {
+		return nil, awserr.New(s3.ErrCodeNoSuchKey,
+			fmt.Sprintf("object %s does not exist", awssdk.StringValue(input.Key)), nil)
+	}
+	return &s3.GetObjectOutput{
+		Body:          ioutil.NopCloser(bytes.NewReader(data)),
+		ContentLength: awssdk.Int64(int64(len(data))),
+	}, nil
+}
+
+// NewFakeTaskHistory scripts history of execution running single build
+// task which writes its logs into groupName/streamName.
+func NewFakeTaskHistory(taskName, groupName, streamName string, succeeded bool) []*sfn.HistoryEvent {
+	events := []*sfn.HistoryEvent{}
+	addEvent := func(event *sfn.HistoryEvent) {
+		event.Id = awssdk.Int64(int64(len(events) + 1))
+		event.PreviousEventId = awssdk.Int64(int64(len(events)))
+		event.Timestamp = awssdk.Time(time.Now())
+		events = append(events, event)
+	}
+	submittedOutput := fmt.Sprintf(`{"Build":{"Arn":"arn:aws:codebuild:fake:build/%s","Logs":{"GroupName":%q,"StreamName":%q}}}`,
+		streamName, groupName, streamName)
+	taskOutput := fmt.Sprintf(`{"taskresult":%s}`, submittedOutput)
+
+	addEvent(&sfn.HistoryEvent{
+		Type:                         awssdk.String("ExecutionStarted"),
+		ExecutionStartedEventDetails: &sfn.ExecutionStartedEventDetails{Input: awssdk.String("{}")},
+	})
+	addEvent(&sfn.HistoryEvent{
+		Type:                     awssdk.String("TaskStateEntered"),
+		StateEnteredEventDetails: &sfn.StateEnteredEventDetails{Name: awssdk.String(taskName), Input: awssdk.String("{}")},
+	})
+	addEvent(&sfn.HistoryEvent{
+		Type:                      awssdk.String("TaskScheduled"),
+		TaskScheduledEventDetails: &sfn.TaskScheduledEventDetails{Resource: awssdk.String("startBuild.sync"), ResourceType: awssdk.String("codebuild"), Region: awssdk.String("fake"), Parameters: awssdk.String("{}")},
+	})
+	addEvent(&sfn.HistoryEvent{
+		Type:                      awssdk.String("TaskSubmitted"),
+		TaskSubmittedEventDetails: &sfn.TaskSubmittedEventDetails{Resource: awssdk.String("startBuild.sync"), ResourceType: awssdk.String("codebuild"), Output: awssdk.String(submittedOutput)},
+	})
+	addEvent(&sfn.HistoryEvent{
+		Type:                    awssdk.String("TaskStarted"),
+		TaskStartedEventDetails: &sfn.TaskStartedEventDetails{Resource: awssdk.String("startBuild.sync"), ResourceType: awssdk.String("codebuild")},
+	})
+	if succeeded {
+		addEvent(&sfn.HistoryEvent{
+			Type:                      awssdk.String("TaskSucceeded"),
+			TaskSucceededEventDetails: &sfn.TaskSucceededEventDetails{Resource: awssdk.String("startBuild.sync"), ResourceType: awssdk.String("codebuild"), Output: awssdk.String(taskOutput)},
+		})
+		addEvent(&sfn.HistoryEvent{
+			Type:                    awssdk.String("TaskStateExited"),
+			StateExitedEventDetails: &sfn.StateExitedEventDetails{Name: awssdk.String(taskName), Output: awssdk.String(taskOutput)},
+		})
+		addEvent(&sfn.HistoryEvent{
+			Type:                           awssdk.String("ExecutionSucceeded"),
+			ExecutionSucceededEventDetails: &sfn.ExecutionSucceededEventDetails{Output: awssdk.String(taskOutput)},
+		})
+	} else {
+		addEvent(&sfn.HistoryEvent{
+			Type:                   awssdk.String("TaskFailed"),
+			TaskFailedEventDetails: &sfn.TaskFailedEventDetails{Resource: awssdk.String("startBuild.sync"), ResourceType: awssdk.String("codebuild"), Error: awssdk.String("States.TaskFailed"), Cause: awssdk.String(taskOutput)},
+		})
+		addEvent(&sfn.HistoryEvent{
+			Type:                        awssdk.String("ExecutionFailed"),
+			ExecutionFailedEventDetails: &sfn.ExecutionFailedEventDetails{Error: awssdk.String("States.TaskFailed"), Cause: awssdk.String(taskOutput)},
+		})
+	}
+	return events
+}
@@ -0,0 +1,48 @@
+package awstest
+
+import (
+	"testing"
+
+	awssdk "github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/cloudwatchlogs"
+)
+
+func TestFakeCloudwatchTokens(t *testing.T) {
+	cloudwatchClient := NewFakeCloudwatch()
+	cloudwatchClient.AddLogs("/g", "s1", "line1\n", "line2\n")
+	tests := []struct {
+		token  string
+		events int
+		valid  bool
+	}{
+		{token: "f/0", events: 2, valid: true},
+		{token: "f/1", events: 1, valid: true},
+		{token: "b/5", events: 0, valid: true},
+		{token: ""},
+		{token: "f"},
+		{token: "x/1"},
+		{token: "f/-1"},
+		{token: "f/one"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.token, func(t *testing.T) {
+			output, err := cloudwatchClient.GetLogEvents(&cloudwatchlogs.GetLogEventsInput{
+				LogGroupName:  awssdk.String("/g"),
+				LogStreamName: awssdk.String("s1"),
+				NextToken:     awssdk.String(tt.token),
+			})
+			if !tt.valid {
+				if err == nil {
+					t.Fatalf("expected error for token %q", tt.token)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %s", err)
+			}
+			if len(output.Events) != tt.events {
+				t.Fatalf("expected %d events, got %d", tt.events, len(output.Events))
+			}
+		})
+	}
+}
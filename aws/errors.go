@@ -0,0 +1,59 @@
+package aws
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/aws/aws-sdk-go/aws/awserr"
+)
+
+var (
+	// authErrorCodes are AWS error codes of missing, invalid or expired
+	// credentials and of denied access
+	authErrorCodes = map[string]bool{
+		"NoCredentialProviders":       true,
+		"UnrecognizedClientException": true,
+		"InvalidClientTokenId":        true,
+		"InvalidSignatureException":   true,
+		"ExpiredToken":                true,
+		"ExpiredTokenException":       true,
+		"AccessDenied":                true,
+		"AccessDeniedException":       true,
+	}
+)
+
+// TimeoutError is returned when execution did not reach final state before
+// the CLI stopped polling it. The execution itself may still be running.
+type TimeoutError string
+
+func (e TimeoutError) Error() string {
+	return string(e)
+}
+
+// InterruptedError is returned when monitoring was interrupted and the
+// execution was left running.
+type InterruptedError string
+
+func (e InterruptedError) Error() string {
+	return string(e)
+}
+
+// ExecutionStatusError is returned when execution completed with other
+// than ExecutionSucceeded status.
+type ExecutionStatusError struct {
+	Status string
+}
+
+func (e *ExecutionStatusError) Error() string {
+	return fmt.Sprintf("execution completed with %s status", e.Status)
+}
+
+// IsAuthError reports whether err was caused by AWS credentials or
+// permissions.
+func IsAuthError(err error) bool {
+	var aerr awserr.Error
+	if errors.As(err, &aerr) {
+		return authErrorCodes[aerr.Code()]
+	}
+	return false
+}
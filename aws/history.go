@@ -0,0 +1,48 @@
+package aws
+
+import (
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/sfn"
+)
+
+// ExecutionHistoryIterator fetches execution history incrementally. Each
+// call to Next follows NextToken to the last page and returns only events
+// newer than the last seen one. The token of the last page is kept, so
+// subsequent calls resume from it instead of the first page.
+type ExecutionHistoryIterator struct {
+	*Sfn
+	Arn         string
+	LastEventId int64
+	pageToken   *string
+}
+
+func NewExecutionHistoryIterator(s *Sfn, arn string) *ExecutionHistoryIterator {
+	return &ExecutionHistoryIterator{
+		Sfn: s,
+		Arn: arn,
+	}
+}
+
+func (it *ExecutionHistoryIterator) Next() ([]*sfn.HistoryEvent, error) {
+	events := []*sfn.HistoryEvent{}
+	for {
+		executionHistory, err := it.Client.GetExecutionHistory(&sfn.GetExecutionHistoryInput{
+			ExecutionArn: aws.String(it.Arn),
+			NextToken:    it.pageToken,
+		})
+		if err != nil {
+			return nil, err
+		}
+		for _, event := range executionHistory.Events {
+			if *event.Id <= it.LastEventId {
+				continue
+			}
+			events = append(events, event)
+			it.LastEventId = *event.Id
+		}
+		if executionHistory.NextToken == nil {
+			return events, nil
+		}
+		it.pageToken = executionHistory.NextToken
+	}
+}
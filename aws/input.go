@@ -0,0 +1,81 @@
+package aws
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+)
+
+// StateMachineInputSchemaVersion is bumped whenever fields of the
+// execution input are removed or change meaning. Adding new fields
+// does not require a new version.
+const StateMachineInputSchemaVersion = 1
+
+type StateMachineInput struct {
+	SchemaVersion int                    `json:"schema_version"`
+	Comment       string                 `json:"Comment"`
+	Build         StateMachineInputBuild `json:"build"`
+}
+
+type StateMachineInputBuild struct {
+	Action      string                       `json:"action"`
+	Environment StateMachineInputEnvironment `json:"environment"`
+}
+
+// StateMachineInputEnvironment is passed to the build as environment
+// variables, hence every value is encoded as a string.
+type StateMachineInputEnvironment struct {
+	Resource       string `json:"terra_ci_resource"`
+	RepositoryUrl  string `json:"terra_ci_source"`
+	RepositoryName string `json:"terra_ci_location"`
+	Run            string `json:"terra_ci_run"`
+	Ref            string `json:"terra_ci_ref"`
+	Branch         string `json:"terra_ci_branch"`
+	Destroy        bool   `json:"terra_ci_destroy,string"`
+	NoRefresh      bool   `json:"terra_ci_no_refresh,string"`
+	OutPlan        string `json:"terra_ci_out_plan"`
+	TestTimeout    string `json:"terra_ci_test_timeout"`
+	DisableCgo     bool   `json:"terra_ci_disable_cgo,string"`
+	PlanRef        string `json:"terra_ci_plan_ref,omitempty"`
+	PlanSha256     string `json:"terra_ci_plan_sha256,omitempty"`
+}
+
+func NewStateMachineInput(params *SfnInputParameters) *StateMachineInput {
+	return &StateMachineInput{
+		SchemaVersion: StateMachineInputSchemaVersion,
+		Comment:       "Run from CLI",
+		Build: StateMachineInputBuild{
+			Action: params.Action,
+			Environment: StateMachineInputEnvironment{
+				Resource:       params.Resource,
+				RepositoryUrl:  params.RepositoryUrl,
+				RepositoryName: params.RepositoryName,
+				Run:            params.Run,
+				Ref:            params.Ref,
+				Branch:         params.Branch,
+				Destroy:        params.Destroy,
+				NoRefresh:      params.NoRefresh,
+				OutPlan:        params.OutPlan,
+				TestTimeout:    params.TestTimeout,
+				DisableCgo:     params.DisableCgo,
+				PlanRef:        params.PlanRef,
+				PlanSha256:     params.PlanSha256,
+			},
+		},
+	}
+}
+
+// BuildStateMachineInput returns the exact payload used as input
+// of state machine execution.
+func BuildStateMachineInput(params *SfnInputParameters) ([]byte, error) {
+	return json.MarshalIndent(NewStateMachineInput(params), "", "  ")
+}
+
+func PrintStateMachineInput(inputParams *SfnInputParameters, out io.Writer) error {
+	executionInput, err := BuildStateMachineInput(inputParams)
+	if err != nil {
+		return err
+	}
+	fmt.Fprintf(out, "%s\n", executionInput)
+	return nil
+}
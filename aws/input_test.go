@@ -0,0 +1,82 @@
+package aws_test
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+
+	"github.com/p0tr3c/terra-ci/aws"
+)
+
+func TestBuildStateMachineInput(t *testing.T) {
+	tests := []struct {
+		name   string
+		params *aws.SfnInputParameters
+	}{
+		{
+			name:   "plain",
+			params: &aws.SfnInputParameters{Action: "plan", Resource: "live/prod/vpc", Branch: "main"},
+		},
+		{
+			name: "special characters",
+			params: &aws.SfnInputParameters{
+				Action:   "apply",
+				Resource: "live/\"prod\"\\vpc\nname\t<&>",
+				Branch:   `feature/"quoted"`,
+				OutPlan:  "plan\\out",
+				Destroy:  true,
+				PlanRef:  "s3://bucket/tfplan",
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			data, err := aws.BuildStateMachineInput(tt.params)
+			if err != nil {
+				t.Fatalf("unexpected error: %s", err)
+			}
+
+			var input aws.StateMachineInput
+			if err := json.Unmarshal(data, &input); err != nil {
+				t.Fatalf("input is not valid json: %s\n%s", err, data)
+			}
+			if expected := aws.NewStateMachineInput(tt.params); !reflect.DeepEqual(&input, expected) {
+				t.Fatalf("expected %+v, got %+v", expected, input)
+			}
+
+			// Contract of the payload consumed by the state machine
+			var raw struct {
+				SchemaVersion int `json:"schema_version"`
+				Build         struct {
+					Action      string                 `json:"action"`
+					Environment map[string]interface{} `json:"environment"`
+				} `json:"build"`
+			}
+			if err := json.Unmarshal(data, &raw); err != nil {
+				t.Fatalf("unexpected error: %s", err)
+			}
+			if raw.SchemaVersion != 1 || raw.Build.Action != tt.params.Action {
+				t.Fatalf("unexpected schema version %d or action %s", raw.SchemaVersion, raw.Build.Action)
+			}
+			environment := raw.Build.Environment
+			if environment["terra_ci_resource"] != tt.params.Resource || environment["terra_ci_branch"] != tt.params.Branch {
+				t.Fatalf("values were not preserved: %v", environment)
+			}
+			// Environment variables are strings, booleans included
+			for key, value := range environment {
+				if _, ok := value.(string); !ok {
+					t.Errorf("expected %s to be string, got %T", key, value)
+				}
+			}
+			if destroy := environment["terra_ci_destroy"]; destroy != map[bool]string{true: "true", false: "false"}[tt.params.Destroy] {
+				t.Errorf("unexpected terra_ci_destroy %v", destroy)
+			}
+			if _, ok := environment["terra_ci_plan_ref"]; ok != (tt.params.PlanRef != "") {
+				t.Errorf("expected terra_ci_plan_ref only when plan is referenced, got %v", environment)
+			}
+			if _, ok := environment["terra_ci_plan_sha256"]; ok {
+				t.Errorf("expected empty terra_ci_plan_sha256 to be omitted")
+			}
+		})
+	}
+}
@@ -0,0 +1,611 @@
+package aws
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"os/signal"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/sfn"
+)
+
+var (
+	taskEvents = []string{
+		"TaskStateEntered",
+		"TaskSubmitted",
+		"TaskSubmitFailed",
+		"TaskScheduled",
+		"TaskStarted",
+		"TaskStartFailed",
+		"TaskFailed",
+		"TaskSucceeded",
+		"TaskTimedOut",
+		"TaskStateAborted",
+		"TaskStateExited",
+	}
+	stateEvents = []string{
+		"ParallelStateEntered",
+		"ParallelStateFailed",
+		"ParallelStateAborted",
+		"ParallelStateExited",
+		"MapStateEntered",
+		"MapStateFailed",
+		"MapStateAborted",
+		"MapStateExited",
+		"MapIterationStarted",
+		"MapIterationFailed",
+		"MapIterationAborted",
+		"FailStateEntered",
+	}
+)
+
+type StateMachineMonitor struct {
+	*Sfn
+	*Cloudwatch
+	Arn              string
+	Confirm          ConfirmFunc
+	Out              io.Writer
+	OutErr           io.Writer
+	ExecutionTimeout time.Duration
+	RefreshRate      time.Duration
+	Ci               bool
+	AbortOnInterrupt bool
+	Interrupts       <-chan os.Signal
+	LogGroupFormat   string
+	*ExecutionEventHistory
+	EventBus    *SfnEventBus
+	Workers     sync.WaitGroup
+	Subscribers []SfnEventSubscriber
+}
+
+// SfnEventSubscriber receives every event of the monitored execution.
+// Events are queued per subscriber, so a slow subscriber does not block
+// polling of execution history. Close is called after the last event.
+type SfnEventSubscriber interface {
+	HandleEvent(event SfnEvent) error
+	Close() error
+}
+
+// ConfirmFunc asks user the question and reports whether it was confirmed.
+type ConfirmFunc func(message string) (bool, error)
+
+// SfnLogSubscriber is event subscriber which also receives lines of task
+// logs streamed by the monitor.
+type SfnLogSubscriber interface {
+	SfnEventSubscriber
+	HandleLog(line string) error
+}
+
+func (sm *StateMachineMonitor) WithSubscribers(subscribers ...SfnEventSubscriber) *StateMachineMonitor {
+	sm.Subscribers = append(sm.Subscribers, subscribers...)
+	return sm
+}
+
+// WithConfirm sets confirmation asked outside of CI before interrupted
+// execution is aborted. Without it the execution is left running.
+func (sm *StateMachineMonitor) WithConfirm(confirm ConfirmFunc) *StateMachineMonitor {
+	sm.Confirm = confirm
+	return sm
+}
+
+func (sm *StateMachineMonitor) WithOut(out io.Writer) *StateMachineMonitor {
+	sm.Out = out
+	return sm
+}
+
+func (sm *StateMachineMonitor) WithOutErr(outErr io.Writer) *StateMachineMonitor {
+	sm.OutErr = outErr
+	return sm
+}
+
+func (sm *StateMachineMonitor) WithCi(ci bool) *StateMachineMonitor {
+	sm.Ci = ci
+	return sm
+}
+
+func (sm *StateMachineMonitor) WithAbortOnInterrupt(abort bool) *StateMachineMonitor {
+	sm.AbortOnInterrupt = abort
+	return sm
+}
+
+// WithInterrupts replaces SIGINT and SIGTERM notifications with signals
+// received from interrupts.
+func (sm *StateMachineMonitor) WithInterrupts(interrupts <-chan os.Signal) *StateMachineMonitor {
+	sm.Interrupts = interrupts
+	return sm
+}
+
+func (sm *StateMachineMonitor) WithTimeout(timeout time.Duration) *StateMachineMonitor {
+	sm.ExecutionTimeout = timeout
+	return sm
+}
+
+func (sm *StateMachineMonitor) WithRefreshRate(rate time.Duration) *StateMachineMonitor {
+	sm.RefreshRate = rate
+	return sm
+}
+
+func (sm *StateMachineMonitor) WithLogGroupFormat(format string) *StateMachineMonitor {
+	sm.LogGroupFormat = format
+	return sm
+}
+
+func (sm *StateMachineMonitor) WithSfnClient(sfn *Sfn) *StateMachineMonitor {
+	sm.Sfn = sfn
+	return sm
+}
+
+func (sm *StateMachineMonitor) WithCloudwatchClient(cloudwatch *Cloudwatch) *StateMachineMonitor {
+	sm.Cloudwatch = cloudwatch
+	return sm
+}
+
+func NewStateMachineMonitor(arn string) *StateMachineMonitor {
+	sm := &StateMachineMonitor{
+		Arn:    arn,
+		Out:    ioutil.Discard,
+		OutErr: ioutil.Discard,
+	}
+	sm.EventBus = NewSfnEventBus()
+	sm.ExecutionEventHistory = &ExecutionEventHistory{
+		Events: make(map[int64]*sfn.HistoryEvent),
+	}
+	return sm
+}
+
+// MonitorStateMachineStatus follows execution until it reaches final
+// state, printing task transitions and build logs. It returns an error
+// unless the execution succeeded.
+func (c *Client) MonitorStateMachineStatus(arn string, refreshRate, executionTimeout time.Duration, isCi, abortOnInterrupt bool, confirm ConfirmFunc, out, outErr io.Writer, subscribers ...SfnEventSubscriber) error {
+	return NewStateMachineMonitor(arn).
+		WithSfnClient(c.Sfn).
+		WithCloudwatchClient(c.Cloudwatch).
+		WithLogGroupFormat(c.LogGroupFormat).
+		WithTimeout(executionTimeout).
+		WithRefreshRate(refreshRate).
+		WithCi(isCi).
+		WithAbortOnInterrupt(abortOnInterrupt).
+		WithConfirm(confirm).
+		WithOut(out).
+		WithOutErr(outErr).
+		WithSubscribers(subscribers...).
+		Run()
+}
+
+func (sm *StateMachineMonitor) Run() error {
+	if sm.Sfn == nil || sm.Cloudwatch == nil {
+		return InternalError("state machine monitor requires sfn and cloudwatch clients")
+	}
+
+	d := time.Now().Add(sm.ExecutionTimeout * time.Minute)
+	ctx, cancel := context.WithDeadline(context.Background(), d) // cancel execution after timeout
+	defer cancel()
+
+	interrupts := sm.Interrupts
+	if interrupts == nil {
+		signals := make(chan os.Signal, 1)
+		signal.Notify(signals, syscall.SIGINT, syscall.SIGTERM)
+		defer signal.Stop(signals)
+		interrupts = signals
+	}
+
+	// Workers subscribe before the history is polled, so no event is missed
+	sm.StartWorker(sm.HandleTaskEvents, taskEvents...)
+	sm.StartWorker(sm.HandleStateEvents, stateEvents...)
+	for _, subscriber := range sm.Subscribers {
+		ch := make(SfnEventChannel)
+		sm.EventBus.SubscribeAll(ch)
+		sm.Workers.Add(1)
+		go func(subscriber SfnEventSubscriber) {
+			defer sm.Workers.Done()
+			sm.HandleSubscriber(subscriber, ch)
+		}(subscriber)
+	}
+
+	fmt.Fprintf(sm.Out, "monitoring execution of %s\n", sm.Arn)
+	monitorErr := make(chan error, 1)
+	go func() {
+		monitorErr <- sm.EventHistoryMonitor(ctx)
+	}()
+
+	var err error
+	for waiting := true; waiting; {
+		select {
+		case err = <-monitorErr:
+			waiting = false
+		case sig := <-interrupts:
+			if interruptErr := sm.handleInterrupt(sig); interruptErr != nil {
+				cancel()
+				<-monitorErr
+				err = interruptErr
+				waiting = false
+			}
+			// Otherwise keep monitoring until the abort is reflected in execution history
+		}
+	}
+
+	sm.EventBus.Close()
+	sm.Workers.Wait()
+	if err != nil {
+		return err
+	}
+	fmt.Fprintf(sm.Out, "execution of state machine completed\n")
+	return returnExecutionStatus(sm.ExecutionEventHistory)
+}
+
+// StartWorker subscribes handler to events and runs it until the event
+// bus is closed.
+func (sm *StateMachineMonitor) StartWorker(handler func(SfnEventChannel), events ...string) {
+	ch := make(SfnEventChannel)
+	for _, event := range events {
+		sm.EventBus.Subscribe(event, ch)
+	}
+	sm.Workers.Add(1)
+	go func() {
+		defer sm.Workers.Done()
+		handler(ch)
+	}()
+}
+
+// EventHistoryMonitor publishes new history events until execution
+// reaches final state or the context is done.
+func (sm *StateMachineMonitor) EventHistoryMonitor(ctx context.Context) error {
+	history := NewExecutionHistoryIterator(sm.Sfn, sm.Arn)
+	for {
+		executionEvents, err := history.Next()
+		if err != nil {
+			return err
+		}
+		completed := false
+		for _, event := range executionEvents {
+			if _, ok := sm.Events[*event.Id]; ok {
+				continue
+			}
+			sm.AddEvent(event)
+			sm.EventBus.Publish(*event.Type, SfnEvent{Arn: sm.Arn, HistoryEvent: event})
+			if SfnExitEvents[*event.Type] {
+				completed = true
+			}
+		}
+		if completed {
+			return nil
+		}
+		select {
+		case <-ctx.Done():
+			if ctx.Err() == context.DeadlineExceeded {
+				return TimeoutError("cli execution timed out")
+			}
+			return ctx.Err()
+		case <-time.After(time.Second * sm.RefreshRate):
+		}
+	}
+}
+
+// handleInterrupt stops remote execution when the user confirms it with
+// Confirm, or in CI when AbortOnInterrupt is set. When the execution is left running
+// an error is returned to stop monitoring.
+func (sm *StateMachineMonitor) handleInterrupt(sig os.Signal) error {
+	abort := sm.AbortOnInterrupt
+	if !sm.Ci {
+		fmt.Fprintf(sm.Out, "\n")
+		abort = false
+		if sm.Confirm != nil {
+			confirmed, err := sm.Confirm("abort remote execution?")
+			if err != nil {
+				return err
+			}
+			abort = confirmed
+		}
+	}
+	if !abort {
+		fmt.Fprintf(sm.Out, "execution %s is still running, follow it with: terra-ci execution attach --arn %s\n", sm.Arn, sm.Arn)
+		return InterruptedError(fmt.Sprintf("monitoring interrupted by %s", sig))
+	}
+	if err := sm.StopExecution(sm.Arn, fmt.Sprintf("terra-ci received %s", sig)); err != nil {
+		return err
+	}
+	fmt.Fprintf(sm.Out, "aborting execution %s\n", sm.Arn)
+	return nil
+}
+
+// HandleTaskEvents prints task transitions and streams logs of builds
+// started by tasks. Logs of running builds are polled with refresh rate.
+func (sm *StateMachineMonitor) HandleTaskEvents(ch SfnEventChannel) {
+	taskLogs := NewTaskLogs(sm.Cloudwatch, sm.LogGroupFormat)
+	logOut := sm.taskLogOutput()
+	ticker := time.NewTicker(time.Second * sm.refreshRate())
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			if err := taskLogs.Poll(logOut); err != nil {
+				fmt.Fprintf(sm.Out, "failed to stream logs: %s\n", err.Error())
+			}
+		case d, ok := <-ch:
+			// Subscribed channel was closed by publisher
+			if !ok {
+				return
+			}
+			var logInformation ExecutionOutput
+			switch *d.Type {
+			case "TaskStateEntered":
+				fmt.Fprintf(sm.Out, "waiting for %s task to complete...\n", *d.StateEnteredEventDetails.Name)
+			case "TaskSubmitted":
+				taskLogs.Follow(aws.StringValue(d.TaskSubmittedEventDetails.Output))
+			case "TaskStateExited":
+				if err := json.Unmarshal([]byte(*d.StateExitedEventDetails.Output), &logInformation); err != nil {
+					fmt.Fprintf(sm.Out, "faild to get details: %s\n", err.Error())
+				}
+				if err := taskLogs.Finish(logOut, logInformation.TaskResults.Build); err != nil {
+					fmt.Fprintf(sm.Out, "failed to stream logs for %s:%s\n", logInformation.TaskResults.Build.Logs.GroupName, logInformation.TaskResults.Build.Logs.StreamName)
+					fmt.Fprintf(sm.Out, "error: %s\n", err.Error())
+				}
+				fmt.Fprintf(sm.Out, "task %s completed\n", *d.StateExitedEventDetails.Name)
+			case "TaskFailed":
+				if err := json.Unmarshal([]byte(*d.TaskFailedEventDetails.Cause), &logInformation); err != nil {
+					fmt.Fprintf(sm.Out, "faild to get details: %s\n", err.Error())
+				}
+				if err := taskLogs.Finish(logOut, logInformation.TaskResults.Build); err != nil {
+					fmt.Fprintf(sm.Out, "failed to stream logs for %s:%s\n", logInformation.TaskResults.Build.Logs.GroupName, logInformation.TaskResults.Build.Logs.StreamName)
+					fmt.Fprintf(sm.Out, "error: %s\n", err.Error())
+				}
+				fmt.Fprintf(sm.Out, "task failed\n")
+			case "TaskSubmitFailed", "TaskStartFailed":
+				fmt.Fprintf(sm.Out, "task failed to start\n")
+			case "TaskTimedOut":
+				fmt.Fprintf(sm.Out, "task timed out\n")
+			case "TaskStateAborted":
+				fmt.Fprintf(sm.Out, "task aborted\n")
+			case "TaskScheduled":
+			case "TaskStarted":
+			case "TaskSucceeded":
+			}
+		}
+	}
+}
+
+// taskLogOutput returns writer of task logs, which forwards complete log
+// lines to subscribers interested in them.
+func (sm *StateMachineMonitor) taskLogOutput() io.Writer {
+	subscribers := []SfnLogSubscriber{}
+	for _, subscriber := range sm.Subscribers {
+		if logSubscriber, ok := subscriber.(SfnLogSubscriber); ok {
+			subscribers = append(subscribers, logSubscriber)
+		}
+	}
+	if len(subscribers) == 0 {
+		return sm.Out
+	}
+	return &logLineWriter{
+		Out:         sm.Out,
+		OutErr:      sm.OutErr,
+		Subscribers: subscribers,
+	}
+}
+
+type logLineWriter struct {
+	Out         io.Writer
+	OutErr      io.Writer
+	Subscribers []SfnLogSubscriber
+	buffer      bytes.Buffer
+}
+
+func (w *logLineWriter) Write(p []byte) (int, error) {
+	if _, err := w.Out.Write(p); err != nil {
+		return 0, err
+	}
+	w.buffer.Write(p)
+	for {
+		i := bytes.IndexByte(w.buffer.Bytes(), '\n')
+		if i < 0 {
+			break
+		}
+		line := string(w.buffer.Next(i + 1))
+		for _, subscriber := range w.Subscribers {
+			if err := subscriber.HandleLog(strings.TrimSuffix(line, "\n")); err != nil {
+				fmt.Fprintf(w.OutErr, "event subscriber failed: %s\n", err.Error())
+			}
+		}
+	}
+	return len(p), nil
+}
+
+// HandleStateEvents prints transitions of parallel and map states.
+func (sm *StateMachineMonitor) HandleStateEvents(ch SfnEventChannel) {
+	for d := range ch {
+		switch *d.Type {
+		case "ParallelStateEntered", "MapStateEntered":
+			fmt.Fprintf(sm.Out, "entering %s state...\n", *d.StateEnteredEventDetails.Name)
+		case "ParallelStateExited", "MapStateExited":
+			fmt.Fprintf(sm.Out, "state %s completed\n", *d.StateExitedEventDetails.Name)
+		case "ParallelStateFailed", "MapStateFailed":
+			fmt.Fprintf(sm.Out, "state failed\n")
+		case "ParallelStateAborted", "MapStateAborted":
+			fmt.Fprintf(sm.Out, "state aborted\n")
+		case "MapIterationStarted":
+			fmt.Fprintf(sm.Out, "map iteration %d started\n", aws.Int64Value(d.MapIterationStartedEventDetails.Index))
+		case "MapIterationFailed":
+			fmt.Fprintf(sm.Out, "map iteration %d failed\n", aws.Int64Value(d.MapIterationFailedEventDetails.Index))
+		case "MapIterationAborted":
+			fmt.Fprintf(sm.Out, "map iteration %d aborted\n", aws.Int64Value(d.MapIterationAbortedEventDetails.Index))
+		case "FailStateEntered":
+			fmt.Fprintf(sm.Out, "state %s failed execution\n", *d.StateEnteredEventDetails.Name)
+		}
+	}
+}
+
+// HandleSubscriber hands events received from ch over to the subscriber
+// in order. Events are queued by the event bus, so a slow subscriber does
+// not block polling of execution history. After the subscriber failed the
+// remaining events are discarded.
+func (sm *StateMachineMonitor) HandleSubscriber(subscriber SfnEventSubscriber, ch SfnEventChannel) {
+	failed := false
+	for event := range ch {
+		if failed {
+			continue
+		}
+		if err := subscriber.HandleEvent(event); err != nil {
+			fmt.Fprintf(sm.OutErr, "event subscriber failed: %s\n", err.Error())
+			failed = true
+		}
+	}
+	if err := subscriber.Close(); err != nil {
+		fmt.Fprintf(sm.OutErr, "failed to close event subscriber: %s\n", err.Error())
+	}
+}
+
+func (sm *StateMachineMonitor) refreshRate() time.Duration {
+	if sm.RefreshRate <= 0 {
+		return 1
+	}
+	return sm.RefreshRate
+}
+
+// SfnEvent is history event of the execution identified by Arn.
+type SfnEvent struct {
+	Arn string
+	*sfn.HistoryEvent
+}
+
+// StateName returns name of the state entered or exited by the event.
+func (e SfnEvent) StateName() string {
+	if e.StateEnteredEventDetails != nil {
+		return aws.StringValue(e.StateEnteredEventDetails.Name)
+	}
+	if e.StateExitedEventDetails != nil {
+		return aws.StringValue(e.StateExitedEventDetails.Name)
+	}
+	return ""
+}
+
+type SfnEventChannel chan SfnEvent
+
+const (
+	// allEvents subscribes channel to every published event type
+	allEvents = "*"
+)
+
+// SfnEventBus delivers published events to channels subscribed to the
+// event type, in publishing order. Every channel has its own unbounded
+// queue, so Publish never waits for receivers and a slow receiver, such
+// as task worker fetching remaining logs of finished build, does not hold
+// back polling of execution history or other receivers. After Close no
+// more events are accepted, and every subscribed channel is closed exactly
+// once, after events published before Close were received.
+type SfnEventBus struct {
+	subscribers   map[string][]*sfnSubscription
+	subscriptions map[SfnEventChannel]*sfnSubscription
+	rm            sync.RWMutex
+	closed        bool
+}
+
+func NewSfnEventBus() *SfnEventBus {
+	return &SfnEventBus{
+		subscribers:   map[string][]*sfnSubscription{},
+		subscriptions: map[SfnEventChannel]*sfnSubscription{},
+	}
+}
+
+func (eb *SfnEventBus) Subscribe(eventType string, ch SfnEventChannel) {
+	eb.rm.Lock()
+	defer eb.rm.Unlock()
+	subscription, found := eb.subscriptions[ch]
+	if !found {
+		subscription = newSfnSubscription(ch)
+		eb.subscriptions[ch] = subscription
+		if eb.closed {
+			subscription.close()
+		}
+	}
+	eb.subscribers[eventType] = append(eb.subscribers[eventType], subscription)
+}
+
+func (eb *SfnEventBus) SubscribeAll(ch SfnEventChannel) {
+	eb.Subscribe(allEvents, ch)
+}
+
+func (eb *SfnEventBus) Publish(eventType string, data SfnEvent) {
+	eb.rm.RLock()
+	defer eb.rm.RUnlock()
+	if eb.closed {
+		return
+	}
+	for _, subscription := range eb.subscribers[eventType] {
+		subscription.push(data)
+	}
+	for _, subscription := range eb.subscribers[allEvents] {
+		subscription.push(data)
+	}
+}
+
+func (eb *SfnEventBus) Close() {
+	eb.rm.Lock()
+	defer eb.rm.Unlock()
+	if eb.closed {
+		return
+	}
+	eb.closed = true
+	for _, subscription := range eb.subscriptions {
+		subscription.close()
+	}
+}
+
+// sfnSubscription queues events for channel and forwards them in order
+// until it is closed and the queue is drained.
+type sfnSubscription struct {
+	ch     SfnEventChannel
+	queue  []SfnEvent
+	closed bool
+	cond   *sync.Cond
+}
+
+func newSfnSubscription(ch SfnEventChannel) *sfnSubscription {
+	subscription := &sfnSubscription{
+		ch:   ch,
+		cond: sync.NewCond(&sync.Mutex{}),
+	}
+	go subscription.forward()
+	return subscription
+}
+
+func (s *sfnSubscription) push(event SfnEvent) {
+	s.cond.L.Lock()
+	s.queue = append(s.queue, event)
+	s.cond.L.Unlock()
+	s.cond.Signal()
+}
+
+func (s *sfnSubscription) close() {
+	s.cond.L.Lock()
+	s.closed = true
+	s.cond.L.Unlock()
+	s.cond.Signal()
+}
+
+func (s *sfnSubscription) forward() {
+	for {
+		s.cond.L.Lock()
+		for len(s.queue) == 0 && !s.closed {
+			s.cond.Wait()
+		}
+		if len(s.queue) == 0 {
+			s.cond.L.Unlock()
+			close(s.ch)
+			return
+		}
+		event := s.queue[0]
+		s.queue = s.queue[1:]
+		s.cond.L.Unlock()
+		s.ch <- event
+	}
+}
@@ -0,0 +1,251 @@
+package aws_test
+
+import (
+	"bytes"
+	"errors"
+	"os"
+	"strings"
+	"sync"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/p0tr3c/terra-ci/aws"
+	"github.com/p0tr3c/terra-ci/aws/awstest"
+
+	awssdk "github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/sfn"
+)
+
+// syncBuffer is buffer safe for writes from monitor workers.
+type syncBuffer struct {
+	mu     sync.Mutex
+	buffer bytes.Buffer
+}
+
+func (b *syncBuffer) Write(p []byte) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buffer.Write(p)
+}
+
+func (b *syncBuffer) String() string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buffer.String()
+}
+
+type recordingSubscriber struct {
+	events []aws.SfnEvent
+	closed int
+}
+
+func (s *recordingSubscriber) HandleEvent(event aws.SfnEvent) error {
+	s.events = append(s.events, event)
+	return nil
+}
+
+func (s *recordingSubscriber) Close() error {
+	s.closed++
+	return nil
+}
+
+func startFakeExecution(t *testing.T, sfnClient *awstest.FakeSfn, cloudwatchClient *awstest.FakeCloudwatch) (*aws.Client, string) {
+	t.Helper()
+	client := aws.NewClientWithAPI(sfnClient, cloudwatchClient, awstest.NewFakeS3())
+	arn, err := client.StartStateMachine("arn:aws:states:eu-west-1:123:stateMachine:plan", &aws.SfnInputParameters{Action: "plan"})
+	if err != nil {
+		t.Fatalf("failed to start execution: %s", err)
+	}
+	return client, arn
+}
+
+func TestMonitorStateMachineStatus(t *testing.T) {
+	tests := []struct {
+		name      string
+		succeeded bool
+		status    string
+		output    []string
+	}{
+		{
+			name:      "succeeded",
+			succeeded: true,
+			output:    []string{"waiting for Plan task to complete...", "line1\nline2\n", "task Plan completed", "execution of state machine completed"},
+		},
+		{
+			name:   "failed",
+			status: "ExecutionFailed",
+			output: []string{"waiting for Plan task to complete...", "boom\n", "task failed"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cloudwatchClient := awstest.NewFakeCloudwatch()
+			cloudwatchClient.AddLogs("/g", "s1", "line1\n", "[Container] internal\n", "line2\n")
+			if !tt.succeeded {
+				cloudwatchClient = awstest.NewFakeCloudwatch()
+				cloudwatchClient.AddLogs("/g", "s1", "boom\n")
+			}
+			client, arn := startFakeExecution(t, awstest.NewFakeSfn(awstest.NewFakeTaskHistory("Plan", "/g", "s1", tt.succeeded)), cloudwatchClient)
+
+			var out syncBuffer
+			err := client.MonitorStateMachineStatus(arn, 0, 1, true, false, nil, &out, &out)
+			if tt.status == "" && err != nil {
+				t.Fatalf("unexpected error: %s", err)
+			}
+			if tt.status != "" {
+				var statusErr *aws.ExecutionStatusError
+				if !errors.As(err, &statusErr) || statusErr.Status != tt.status {
+					t.Fatalf("expected %s status error, got %v", tt.status, err)
+				}
+			}
+			for _, expected := range tt.output {
+				if !strings.Contains(out.String(), expected) {
+					t.Errorf("output does not contain %q:\n%s", expected, out.String())
+				}
+			}
+			if strings.Contains(out.String(), "[Container]") {
+				t.Errorf("output contains internal logs:\n%s", out.String())
+			}
+		})
+	}
+}
+
+func TestMonitorDeliversPaginatedHistoryToSubscribers(t *testing.T) {
+	history := awstest.NewFakeTaskHistory("Plan", "/g", "s1", true)
+	sfnClient := awstest.NewFakeSfn(history)
+	sfnClient.PageSize = 2
+	sfnClient.EventsPerPoll = 3
+	cloudwatchClient := awstest.NewFakeCloudwatch()
+	cloudwatchClient.AddLogs("/g", "s1", "line1\n")
+	client, arn := startFakeExecution(t, sfnClient, cloudwatchClient)
+
+	subscriber := &recordingSubscriber{}
+	err := client.MonitorStateMachineStatus(arn, 0, 1, true, false, nil, &syncBuffer{}, &syncBuffer{}, subscriber)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if len(subscriber.events) != len(history) {
+		t.Fatalf("expected %d events, got %d", len(history), len(subscriber.events))
+	}
+	for i, event := range subscriber.events {
+		if *event.Id != int64(i+1) || event.Arn != arn {
+			t.Errorf("unexpected event %d: %s %d", i, event.Arn, *event.Id)
+		}
+	}
+	if subscriber.closed != 1 {
+		t.Errorf("expected subscriber to be closed once, closed %d times", subscriber.closed)
+	}
+}
+
+func TestMonitorInterrupt(t *testing.T) {
+	tests := []struct {
+		name             string
+		ci               bool
+		abortOnInterrupt bool
+		confirmed        bool
+		status           string
+	}{
+		{name: "confirmed", confirmed: true, status: sfn.ExecutionStatusAborted},
+		{name: "declined", status: sfn.ExecutionStatusRunning},
+		{name: "ci abort", ci: true, abortOnInterrupt: true, status: sfn.ExecutionStatusAborted},
+		{name: "ci detach", ci: true, status: sfn.ExecutionStatusRunning},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			sfnClient := awstest.NewFakeSfn(awstest.NewFakeTaskHistory("Plan", "/g", "s1", true))
+			sfnClient.EventsPerPoll = 1
+			client, arn := startFakeExecution(t, sfnClient, awstest.NewFakeCloudwatch())
+
+			interrupts := make(chan os.Signal, 1)
+			interrupts <- syscall.SIGINT
+			asked := ""
+			err := aws.NewStateMachineMonitor(arn).
+				WithSfnClient(client.Sfn).
+				WithCloudwatchClient(client.Cloudwatch).
+				WithTimeout(1).
+				WithRefreshRate(1).
+				WithCi(tt.ci).
+				WithAbortOnInterrupt(tt.abortOnInterrupt).
+				WithInterrupts(interrupts).
+				WithConfirm(func(message string) (bool, error) {
+					asked = message
+					return tt.confirmed, nil
+				}).
+				WithOut(&syncBuffer{}).
+				Run()
+
+			if tt.status == sfn.ExecutionStatusAborted {
+				var statusErr *aws.ExecutionStatusError
+				if !errors.As(err, &statusErr) || statusErr.Status != "ExecutionAborted" {
+					t.Fatalf("expected aborted status error, got %v", err)
+				}
+			} else {
+				var interruptedErr aws.InterruptedError
+				if !errors.As(err, &interruptedErr) {
+					t.Fatalf("expected interrupted error, got %v", err)
+				}
+			}
+			if status := sfnClient.Executions[arn].Status(); status != tt.status {
+				t.Errorf("expected execution status %s, got %s", tt.status, status)
+			}
+			if tt.ci && asked != "" {
+				t.Errorf("expected no confirmation in CI, asked %q", asked)
+			}
+			if !tt.ci && asked != "abort remote execution?" {
+				t.Errorf("expected abort confirmation, asked %q", asked)
+			}
+		})
+	}
+}
+
+func TestSfnEventBusPublishDoesNotWaitForReceivers(t *testing.T) {
+	eventBus := aws.NewSfnEventBus()
+	started := make(aws.SfnEventChannel)
+	all := make(aws.SfnEventChannel)
+	eventBus.Subscribe("TaskStarted", started)
+	eventBus.SubscribeAll(all)
+
+	events := []string{}
+	for i := 0; i < 100; i++ {
+		events = append(events, []string{"TaskScheduled", "TaskStarted"}[i%2])
+	}
+	published := make(chan struct{})
+	go func() {
+		defer close(published)
+		for i, eventType := range events {
+			eventBus.Publish(eventType, aws.SfnEvent{Arn: "arn", HistoryEvent: &sfn.HistoryEvent{Id: awssdk.Int64(int64(i)), Type: awssdk.String(eventType)}})
+		}
+	}()
+	select {
+	case <-published:
+	case <-time.After(5 * time.Second):
+		t.Fatalf("publish waits for receivers")
+	}
+	eventBus.Close()
+	eventBus.Close()
+	eventBus.Publish("TaskStarted", aws.SfnEvent{Arn: "arn", HistoryEvent: &sfn.HistoryEvent{Id: awssdk.Int64(100), Type: awssdk.String("TaskStarted")}})
+
+	received := []int64{}
+	for event := range started {
+		received = append(received, *event.Id)
+	}
+	if len(received) != 50 {
+		t.Fatalf("expected 50 TaskStarted events, got %d", len(received))
+	}
+	for i, id := range received {
+		if id != int64(2*i+1) {
+			t.Fatalf("expected TaskStarted events in publishing order, got %v", received)
+		}
+	}
+	count := 0
+	for event := range all {
+		if *event.Id != int64(count) {
+			t.Fatalf("expected event %d, got %d", count, *event.Id)
+		}
+		count++
+	}
+	if count != len(events) {
+		t.Fatalf("expected %d events, got %d", len(events), count)
+	}
+}
@@ -0,0 +1,102 @@
+package aws
+
+import (
+	"sync"
+	"time"
+
+	"github.com/aws/aws-sdk-go/service/cloudwatchlogs"
+	"github.com/aws/aws-sdk-go/service/cloudwatchlogs/cloudwatchlogsiface"
+	"github.com/aws/aws-sdk-go/service/sfn"
+	"github.com/aws/aws-sdk-go/service/sfn/sfniface"
+)
+
+// RateLimiter spaces requests evenly, so concurrent executions sharing
+// the client stay within API throttling limits.
+type RateLimiter struct {
+	mu       sync.Mutex
+	interval time.Duration
+	next     time.Time
+}
+
+func NewRateLimiter(requestsPerSecond int) *RateLimiter {
+	return &RateLimiter{
+		interval: time.Second / time.Duration(requestsPerSecond),
+	}
+}
+
+// Wait blocks until the next request is allowed.
+func (r *RateLimiter) Wait() {
+	r.mu.Lock()
+	now := time.Now()
+	if r.next.Before(now) {
+		r.next = now
+	}
+	wait := r.next.Sub(now)
+	r.next = r.next.Add(r.interval)
+	r.mu.Unlock()
+	time.Sleep(wait)
+}
+
+type rateLimitedSfn struct {
+	sfniface.SFNAPI
+	limiter *RateLimiter
+}
+
+func (s *rateLimitedSfn) StartExecution(input *sfn.StartExecutionInput) (*sfn.StartExecutionOutput, error) {
+	s.limiter.Wait()
+	return s.SFNAPI.StartExecution(input)
+}
+
+func (s *rateLimitedSfn) StopExecution(input *sfn.StopExecutionInput) (*sfn.StopExecutionOutput, error) {
+	s.limiter.Wait()
+	return s.SFNAPI.StopExecution(input)
+}
+
+func (s *rateLimitedSfn) DescribeExecution(input *sfn.DescribeExecutionInput) (*sfn.DescribeExecutionOutput, error) {
+	s.limiter.Wait()
+	return s.SFNAPI.DescribeExecution(input)
+}
+
+func (s *rateLimitedSfn) ListExecutions(input *sfn.ListExecutionsInput) (*sfn.ListExecutionsOutput, error) {
+	s.limiter.Wait()
+	return s.SFNAPI.ListExecutions(input)
+}
+
+func (s *rateLimitedSfn) GetExecutionHistory(input *sfn.GetExecutionHistoryInput) (*sfn.GetExecutionHistoryOutput, error) {
+	s.limiter.Wait()
+	return s.SFNAPI.GetExecutionHistory(input)
+}
+
+type rateLimitedCloudwatch struct {
+	cloudwatchlogsiface.CloudWatchLogsAPI
+	limiter *RateLimiter
+}
+
+func (cw *rateLimitedCloudwatch) GetLogEvents(input *cloudwatchlogs.GetLogEventsInput) (*cloudwatchlogs.GetLogEventsOutput, error) {
+	cw.limiter.Wait()
+	return cw.CloudWatchLogsAPI.GetLogEvents(input)
+}
+
+// WithRateLimit returns client sharing APIs of c, which limits SFN and
+// CloudWatch requests to requestsPerSecond per service.
+func (c *Client) WithRateLimit(requestsPerSecond int) *Client {
+	if requestsPerSecond <= 0 {
+		return c
+	}
+	return &Client{
+		Sfn: &Sfn{
+			Client: &rateLimitedSfn{
+				SFNAPI:  c.Sfn.Client,
+				limiter: NewRateLimiter(requestsPerSecond),
+			},
+		},
+		Cloudwatch: &Cloudwatch{
+			Client: &rateLimitedCloudwatch{
+				CloudWatchLogsAPI: c.Cloudwatch.Client,
+				limiter:           NewRateLimiter(requestsPerSecond),
+			},
+		},
+		S3:             c.S3,
+		LogGroupFormat: c.LogGroupFormat,
+	}
+}
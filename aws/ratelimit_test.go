@@ -0,0 +1,77 @@
+package aws_test
+
+import (
+	"sort"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/p0tr3c/terra-ci/aws"
+	"github.com/p0tr3c/terra-ci/aws/awstest"
+
+	awssdk "github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/sfn"
+)
+
+func TestRateLimiterSpacing(t *testing.T) {
+	const (
+		requestsPerSecond = 50
+		requests          = 10
+		interval          = time.Second / requestsPerSecond
+	)
+	limiter := aws.NewRateLimiter(requestsPerSecond)
+	started := time.Now()
+	var wg sync.WaitGroup
+	var mu sync.Mutex
+	allowed := []time.Duration{}
+	for i := 0; i < requests; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			limiter.Wait()
+			mu.Lock()
+			allowed = append(allowed, time.Since(started))
+			mu.Unlock()
+		}()
+	}
+	wg.Wait()
+
+	// Request n is allowed no sooner than n intervals after the first one
+	sort.Slice(allowed, func(i, j int) bool { return allowed[i] < allowed[j] })
+	for n, elapsed := range allowed {
+		if earliest := time.Duration(n) * interval; elapsed < earliest {
+			t.Fatalf("request %d allowed after %s, expected at least %s", n, elapsed, earliest)
+		}
+	}
+
+	// Idle limiter does not accumulate requests
+	time.Sleep(3 * interval)
+	started = time.Now()
+	limiter.Wait()
+	limiter.Wait()
+	if elapsed := time.Since(started); elapsed < interval {
+		t.Fatalf("requests after idle period allowed within %s, expected at least %s", elapsed, interval)
+	}
+}
+
+func TestWithRateLimit(t *testing.T) {
+	client := aws.NewClientWithAPI(awstest.NewFakeSfn(nil), awstest.NewFakeCloudwatch(), awstest.NewFakeS3())
+	if limited := client.WithRateLimit(0); limited != client {
+		t.Fatalf("expected client without limit to be returned as is")
+	}
+
+	const requestsPerSecond = 100
+	limited := client.WithRateLimit(requestsPerSecond)
+	if limited.S3 != client.S3 {
+		t.Fatalf("expected S3 API to be shared")
+	}
+	started := time.Now()
+	for i := 0; i < 5; i++ {
+		if _, err := limited.Sfn.Client.ListExecutions(&sfn.ListExecutionsInput{StateMachineArn: awssdk.String("arn")}); err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+	}
+	if elapsed, earliest := time.Since(started), 4*time.Second/requestsPerSecond; elapsed < earliest {
+		t.Fatalf("5 requests completed in %s, expected at least %s", elapsed, earliest)
+	}
+}
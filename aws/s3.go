@@ -0,0 +1,61 @@
+package aws
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"net/url"
+	"strings"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/s3"
+	"github.com/aws/aws-sdk-go/service/s3/s3iface"
+)
+
+type S3 struct {
+	Client s3iface.S3API
+}
+
+// ParseS3Uri splits s3://bucket/key uri into bucket and key.
+func ParseS3Uri(uri string) (string, string, error) {
+	u, err := url.Parse(uri)
+	if err != nil {
+		return "", "", err
+	}
+	key := strings.TrimPrefix(u.Path, "/")
+	if u.Scheme != "s3" || u.Host == "" || key == "" {
+		return "", "", fmt.Errorf("invalid s3 uri %s", uri)
+	}
+	return u.Host, key, nil
+}
+
+// GetObject returns content of object referenced by s3://bucket/key uri.
+func (s *S3) GetObject(uri string) ([]byte, error) {
+	bucket, key, err := ParseS3Uri(uri)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := s.Client.GetObject(&s3.GetObjectInput{
+		Bucket: aws.String(bucket),
+		Key:    aws.String(key),
+	})
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	return ioutil.ReadAll(resp.Body)
+}
+
+// PutObject stores data as object referenced by s3://bucket/key uri.
+func (s *S3) PutObject(uri string, data []byte) error {
+	bucket, key, err := ParseS3Uri(uri)
+	if err != nil {
+		return err
+	}
+	_, err = s.Client.PutObject(&s3.PutObjectInput{
+		Bucket: aws.String(bucket),
+		Key:    aws.String(key),
+		Body:   bytes.NewReader(data),
+	})
+	return err
+}
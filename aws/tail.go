@@ -0,0 +1,160 @@
+package aws
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"regexp"
+	"strings"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/service/cloudwatchlogs"
+)
+
+const (
+	// DefaultLogGroupFormat is CodeBuild naming convention of log groups,
+	// formatted with the build project name.
+	DefaultLogGroupFormat = "/aws/codebuild/%s"
+)
+
+var (
+	excludeInternalLogsPattern = regexp.MustCompile(`^\[Container\]`)
+)
+
+// LogTailer follows single log stream, remembering the forward token so
+// each Poll prints only events which were not printed before.
+type LogTailer struct {
+	*Cloudwatch
+	GroupName  string
+	StreamName string
+	Verbose    bool
+	nextToken  *string
+}
+
+func NewLogTailer(cloudwatch *Cloudwatch, groupName, streamName string, verbose bool) *LogTailer {
+	return &LogTailer{
+		Cloudwatch: cloudwatch,
+		GroupName:  groupName,
+		StreamName: streamName,
+		Verbose:    verbose,
+	}
+}
+
+// Poll prints all events appended to the stream since the previous Poll.
+func (t *LogTailer) Poll(out io.Writer) error {
+	for {
+		resp, err := t.Client.GetLogEvents(&cloudwatchlogs.GetLogEventsInput{
+			LogGroupName:  aws.String(t.GroupName),
+			LogStreamName: aws.String(t.StreamName),
+			StartFromHead: aws.Bool(true),
+			NextToken:     t.nextToken,
+		})
+		if err != nil {
+			return err
+		}
+		for _, event := range resp.Events {
+			if !t.Verbose && excludeInternalLogsPattern.MatchString(*event.Message) {
+				continue
+			}
+			fmt.Fprintf(out, "%s", *event.Message)
+		}
+		// Forward token does not change once the end of stream is reached
+		if t.nextToken != nil && aws.StringValue(t.nextToken) == aws.StringValue(resp.NextForwardToken) {
+			return nil
+		}
+		t.nextToken = resp.NextForwardToken
+	}
+}
+
+func isResourceNotFound(err error) bool {
+	if aerr, ok := err.(awserr.Error); ok {
+		return aerr.Code() == cloudwatchlogs.ErrCodeResourceNotFoundException
+	}
+	return false
+}
+
+// TaskLogs tracks log streams of builds started by execution tasks.
+type TaskLogs struct {
+	*Cloudwatch
+	LogGroupFormat string
+	tailers        map[string]*LogTailer
+	order          []string
+}
+
+func NewTaskLogs(cloudwatch *Cloudwatch, logGroupFormat string) *TaskLogs {
+	if logGroupFormat == "" {
+		logGroupFormat = DefaultLogGroupFormat
+	}
+	return &TaskLogs{
+		Cloudwatch:     cloudwatch,
+		LogGroupFormat: logGroupFormat,
+		tailers:        make(map[string]*LogTailer),
+	}
+}
+
+// resolve returns log group and stream of the build. Build logs are not
+// yet known when task is submitted, in that case names are derived from
+// the build id using the log group naming convention.
+func (l *TaskLogs) resolve(build ExecutionOutputBuild) (string, string) {
+	if build.Logs.GroupName != "" && build.Logs.StreamName != "" {
+		return build.Logs.GroupName, build.Logs.StreamName
+	}
+	buildId := strings.SplitN(build.Id, ":", 2)
+	if len(buildId) != 2 {
+		return "", ""
+	}
+	return fmt.Sprintf(l.LogGroupFormat, buildId[0]), buildId[1]
+}
+
+func (l *TaskLogs) tailer(build ExecutionOutputBuild) *LogTailer {
+	groupName, streamName := l.resolve(build)
+	if groupName == "" {
+		return nil
+	}
+	key := fmt.Sprintf("%s:%s", groupName, streamName)
+	if tailer, ok := l.tailers[key]; ok {
+		return tailer
+	}
+	tailer := NewLogTailer(l.Cloudwatch, groupName, streamName, false)
+	l.tailers[key] = tailer
+	l.order = append(l.order, key)
+	return tailer
+}
+
+// Follow starts tailing logs of build submitted by the task.
+func (l *TaskLogs) Follow(taskOutput string) {
+	var submitted TaskResultOutput
+	if err := json.Unmarshal([]byte(taskOutput), &submitted); err != nil {
+		return
+	}
+	l.tailer(submitted.Build)
+}
+
+// Finish prints remaining logs of the build and stops tailing it.
+func (l *TaskLogs) Finish(out io.Writer, build ExecutionOutputBuild) error {
+	tailer := l.tailer(build)
+	if tailer == nil {
+		return fmt.Errorf("no logs reference in task output")
+	}
+	key := fmt.Sprintf("%s:%s", tailer.GroupName, tailer.StreamName)
+	delete(l.tailers, key)
+	for i := range l.order {
+		if l.order[i] == key {
+			l.order = append(l.order[:i], l.order[i+1:]...)
+			break
+		}
+	}
+	return tailer.Poll(out)
+}
+
+// Poll prints new events of all followed builds. Streams which were not
+// created yet are skipped until the next Poll.
+func (l *TaskLogs) Poll(out io.Writer) error {
+	for _, key := range l.order {
+		if err := l.tailers[key].Poll(out); err != nil && !isResourceNotFound(err) {
+			return err
+		}
+	}
+	return nil
+}
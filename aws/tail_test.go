@@ -0,0 +1,94 @@
+package aws_test
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/p0tr3c/terra-ci/aws"
+	"github.com/p0tr3c/terra-ci/aws/awstest"
+)
+
+func TestLogTailerPoll(t *testing.T) {
+	tests := []struct {
+		name     string
+		verbose  bool
+		pageSize int
+		expected string
+	}{
+		{name: "single page", pageSize: 100, expected: "line1\nline2\n"},
+		{name: "paginated", pageSize: 1, expected: "line1\nline2\n"},
+		{name: "verbose", verbose: true, pageSize: 1, expected: "line1\n[Container] internal\nline2\n"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cloudwatchClient := awstest.NewFakeCloudwatch()
+			cloudwatchClient.PageSize = tt.pageSize
+			cloudwatchClient.AddLogs("/g", "s1", "line1\n", "[Container] internal\n", "line2\n")
+			tailer := aws.NewLogTailer(&aws.Cloudwatch{Client: cloudwatchClient}, "/g", "s1", tt.verbose)
+
+			var out bytes.Buffer
+			if err := tailer.Poll(&out); err != nil {
+				t.Fatalf("unexpected error: %s", err)
+			}
+			if out.String() != tt.expected {
+				t.Fatalf("expected %q, got %q", tt.expected, out.String())
+			}
+
+			out.Reset()
+			if err := tailer.Poll(&out); err != nil {
+				t.Fatalf("unexpected error: %s", err)
+			}
+			if out.String() != "" {
+				t.Fatalf("expected no output without new events, got %q", out.String())
+			}
+
+			cloudwatchClient.AddLogs("/g", "s1", "line3\n")
+			if err := tailer.Poll(&out); err != nil {
+				t.Fatalf("unexpected error: %s", err)
+			}
+			if out.String() != "line3\n" {
+				t.Fatalf("expected only new events, got %q", out.String())
+			}
+		})
+	}
+}
+
+func TestTaskLogs(t *testing.T) {
+	cloudwatchClient := awstest.NewFakeCloudwatch()
+	taskLogs := aws.NewTaskLogs(&aws.Cloudwatch{Client: cloudwatchClient}, "")
+	// Logs of submitted build are derived from build id
+	taskLogs.Follow(`{"Build":{"Id":"project:1234"}}`)
+
+	var out bytes.Buffer
+	if err := taskLogs.Poll(&out); err != nil {
+		t.Fatalf("expected missing stream to be skipped, got %s", err)
+	}
+
+	cloudwatchClient.AddLogs("/aws/codebuild/project", "1234", "line1\n")
+	if err := taskLogs.Poll(&out); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	cloudwatchClient.AddLogs("/aws/codebuild/project", "1234", "line2\n")
+	build := aws.ExecutionOutputBuild{
+		Logs: aws.ExecutionOutputBuildLogs{GroupName: "/aws/codebuild/project", StreamName: "1234"},
+	}
+	if err := taskLogs.Finish(&out, build); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if out.String() != "line1\nline2\n" {
+		t.Fatalf("expected %q, got %q", "line1\nline2\n", out.String())
+	}
+
+	cloudwatchClient.AddLogs("/aws/codebuild/project", "1234", "line3\n")
+	out.Reset()
+	if err := taskLogs.Poll(&out); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if out.String() != "" {
+		t.Fatalf("expected finished build not to be followed, got %q", out.String())
+	}
+
+	if err := taskLogs.Finish(&out, aws.ExecutionOutputBuild{}); err == nil {
+		t.Fatalf("expected error for build without logs reference")
+	}
+}
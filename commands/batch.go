@@ -0,0 +1,238 @@
+package commands
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"sync"
+
+	"github.com/p0tr3c/terra-ci/config"
+	"github.com/p0tr3c/terra-ci/logs"
+	"github.com/p0tr3c/terra-ci/plans"
+	"github.com/p0tr3c/terra-ci/reports"
+	"github.com/p0tr3c/terra-ci/workspaces"
+
+	"github.com/spf13/cobra"
+)
+
+func isBatchCommand(cmd *cobra.Command) bool {
+	return cmd.Use == "plan-all" || cmd.Use == "apply-all"
+}
+
+func addBatchFlags(command *cobra.Command) {
+	command.Flags().String("root", "live", "Directory searched for workspaces when no workspace paths are given")
+	command.Flags().Bool("changed", false, "Execute workspaces affected by changes between git revisions")
+	command.Flags().String("base", "", "Base git revision of --changed, defaults to origin/<default workspace prod branch>")
+	command.Flags().String("head", "HEAD", "Git revision of --changed compared with merge base of base revision")
+	command.Flags().Int("parallelism", 1, "Number of remote executions running at once")
+}
+
+// getBatchGraph returns dependency graph of workspaces given as arguments,
+// affected by changes with --changed or found under --root.
+func getBatchGraph(cmd *cobra.Command, args []string) (*workspaces.DependencyGraph, error) {
+	changed, err := cmd.Flags().GetBool("changed")
+	if err != nil {
+		return nil, err
+	}
+	paths := args
+	switch {
+	case len(args) > 0 && changed:
+		return nil, &UsageError{Err: fmt.Errorf("workspace paths can not be combined with --changed")}
+	case changed:
+		changedWorkspaces, err := getChangedWorkspaces(cmd)
+		if err != nil {
+			return nil, err
+		}
+		paths = []string{}
+		for _, workspace := range changedWorkspaces {
+			paths = append(paths, workspace.Path)
+		}
+	case len(args) == 0:
+		root, err := cmd.Flags().GetString("root")
+		if err != nil {
+			return nil, err
+		}
+		configs, err := workspaces.FindTerragruntConfigs(root)
+		if err != nil {
+			return nil, err
+		}
+		return workspaces.NewDependencyGraph(configs), nil
+	}
+
+	configs := []*workspaces.TerragruntConfig{}
+	for _, path := range paths {
+		terragruntConfig, err := workspaces.ReadTerragruntConfig(path)
+		if err != nil {
+			return nil, err
+		}
+		configs = append(configs, terragruntConfig)
+	}
+	return workspaces.NewDependencyGraph(configs), nil
+}
+
+func printBatchResults(cmd *cobra.Command, format string, results []*workspaces.BatchResult) error {
+	switch format {
+	case reports.OutputJson:
+		encoder := json.NewEncoder(cmd.OutOrStdout())
+		encoder.SetIndent("", "  ")
+		return encoder.Encode(results)
+	case reports.OutputNdjson:
+		encoder := json.NewEncoder(cmd.OutOrStdout())
+		for _, result := range results {
+			if err := encoder.Encode(result); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	return workspaces.PrintBatchResults(cmd.OutOrStdout(), results)
+}
+
+// runBatch executes action on workspaces in dependency order and prints
+// result table. In structured output modes progress of workspaces is
+// written to stderr.
+func runBatch(cmd *cobra.Command, args []string, action string) error {
+	format := config.Configuration.GetString("output")
+	if format != reports.OutputText && format != reports.OutputJson && format != reports.OutputNdjson {
+		cmd.PrintErrf("invalid execution input")
+		return &UsageError{Err: fmt.Errorf("unsupported output format %q", format)}
+	}
+	reportSpecs, err := cmd.Flags().GetStringArray("report")
+	if err != nil {
+		return err
+	}
+	if len(reportSpecs) > 0 {
+		cmd.PrintErrf("invalid execution input")
+		return &UsageError{Err: fmt.Errorf("--report is not supported by %s", cmd.Use)}
+	}
+	baseInput, err := getExecutionInput(cmd, args)
+	if err != nil {
+		logs.Logger.Errorw("error while accessing flags",
+			"error", err)
+		cmd.PrintErrf("invalid execution input")
+		return err
+	}
+	baseInput.Action = action
+	parallelism, err := cmd.Flags().GetInt("parallelism")
+	if err != nil {
+		return err
+	}
+	if parallelism > 1 {
+		if baseInput.Local {
+			cmd.PrintErrf("invalid execution input")
+			return &UsageError{Err: fmt.Errorf("--parallelism is only supported for remote execution")}
+		}
+		// Executions share the client and can not prompt on interrupt
+		baseInput.Client = baseInput.Client.WithRateLimit(config.Configuration.GetInt("api_rate_limit"))
+		baseInput.IsCi = true
+	}
+	if action == "plan" {
+		// Local plans report changes with terraform exit code, remote
+		// plans with the summary of the plan artifact
+		baseInput.DetailedExitCode = baseInput.Local
+	}
+	if action == "apply" {
+		baseInput.ForceStalePlan, err = cmd.Flags().GetBool("force-stale-plan")
+		if err != nil {
+			return err
+		}
+	}
+
+	graph, err := getBatchGraph(cmd, args)
+	if err != nil {
+		logs.Logger.Errorw("failed to resolve workspaces",
+			"error", err)
+		cmd.PrintErrf("failed to resolve workspaces")
+		return err
+	}
+
+	out := cmd.OutOrStdout()
+	if format != reports.OutputText {
+		out = cmd.ErrOrStderr()
+	}
+	var outputLock sync.Mutex
+	results, err := workspaces.ExecuteBatch(graph, parallelism, func(path string) (*plans.Summary, error) {
+		executionInput := *baseInput
+		executionInput.Path = path
+		protection, err := getDestroyProtection(cmd, path)
+		if err != nil {
+			return nil, err
+		}
+		executionInput.DestroyProtection = protection
+
+		workspaceOut, workspaceOutErr := out, cmd.ErrOrStderr()
+		if parallelism > 1 {
+			prefixedOut := workspaces.NewPrefixedWriter(out, &outputLock, "["+path+"] ")
+			prefixedOutErr := workspaces.NewPrefixedWriter(cmd.ErrOrStderr(), &outputLock, "["+path+"] ")
+			defer prefixedOut.Flush()    //nolint
+			defer prefixedOutErr.Flush() //nolint
+			workspaceOut, workspaceOutErr = prefixedOut, prefixedOutErr
+		}
+
+		fmt.Fprintf(workspaceOut, "==> %s %s\n", action, path)
+		if action == "plan" {
+			return workspaces.PlanWorkspaceWithOutput(&executionInput, cmd.InOrStdin(), workspaceOut, workspaceOutErr)
+		}
+		return nil, workspaces.ExecuteWorkspaceWithOutput(&executionInput, cmd.InOrStdin(), workspaceOut, workspaceOutErr)
+	})
+	if results != nil {
+		if printErr := printBatchResults(cmd, format, results); printErr != nil && err == nil {
+			err = printErr
+		}
+	}
+	var planChanges *workspaces.PlanChangesError
+	if errors.As(err, &planChanges) {
+		return err
+	}
+	if err != nil {
+		logs.Logger.Errorw("failed to execute workspaces",
+			"error", err)
+		cmd.PrintErrf("failed to execute workspaces")
+		return err
+	}
+	return nil
+}
+
+/*************************** PLAN-ALL ***************************************/
+
+func NewWorkspacePlanAllCommand(in io.Reader, out, outErr io.Writer) *cobra.Command {
+	command := &cobra.Command{
+		Use:          "plan-all",
+		Short:        "Run terraform plan on workspaces in dependency order",
+		Long:         "Run terraform plan on workspaces given as arguments, affected by changes with --changed or found under --root",
+		RunE:         runWorkspacePlanAll,
+		SilenceUsage: true,
+	}
+	SetCommandBuffers(command, in, out, outErr)
+	addBatchFlags(command)
+	command.Flags().String("branch", "main", "Branch to execute workspace action")
+	command.Flags().String("out", "", "Name of plan file to generate in each workspace")
+	command.Flags().Bool("no-refresh", false, "Disable state synchronization")
+	return command
+}
+
+func runWorkspacePlanAll(cmd *cobra.Command, args []string) error {
+	return runBatch(cmd, args, "plan")
+}
+
+/*************************** APPLY-ALL ***************************************/
+
+func NewWorkspaceApplyAllCommand(in io.Reader, out, outErr io.Writer) *cobra.Command {
+	command := &cobra.Command{
+		Use:          "apply-all",
+		Short:        "Run terraform apply on workspaces in dependency order",
+		Long:         "Run terraform apply on workspaces given as arguments, affected by changes with --changed or found under --root",
+		RunE:         runWorkspaceApplyAll,
+		SilenceUsage: true,
+	}
+	SetCommandBuffers(command, in, out, outErr)
+	addBatchFlags(command)
+	command.Flags().String("plan-file", "", "Name of plan file in each workspace to apply")
+	command.Flags().Bool("force-stale-plan", false, "Apply plan files even if they were produced from different commit or source")
+	return command
+}
+
+func runWorkspaceApplyAll(cmd *cobra.Command, args []string) error {
+	return runBatch(cmd, args, "apply")
+}
@@ -0,0 +1,112 @@
+package commands_test
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/p0tr3c/terra-ci/aws"
+	"github.com/p0tr3c/terra-ci/aws/awstest"
+	"github.com/p0tr3c/terra-ci/commands"
+	"github.com/p0tr3c/terra-ci/logs"
+)
+
+// setupBatch creates workspaces under live in temporary directory, which
+// becomes the current directory, and replaces AWS clients with fakes.
+func setupBatch(t *testing.T, workspaces map[string]string) *awstest.FakeSfn {
+	t.Helper()
+	if err := logs.Init(); err != nil {
+		t.Fatalf("failed to init logs: %s", err)
+	}
+	dir := t.TempDir()
+	for path, config := range workspaces {
+		workspaceDir := filepath.Join(dir, "live", path)
+		if err := os.MkdirAll(workspaceDir, 0755); err != nil {
+			t.Fatalf("failed to create %s: %s", workspaceDir, err)
+		}
+		if err := ioutil.WriteFile(filepath.Join(workspaceDir, "terragrunt.hcl"), []byte(config), 0644); err != nil {
+			t.Fatalf("failed to write config of %s: %s", path, err)
+		}
+	}
+	wd, err := os.Getwd()
+	if err != nil {
+		t.Fatalf("failed to get current directory: %s", err)
+	}
+	if err := os.Chdir(dir); err != nil {
+		t.Fatalf("failed to change directory: %s", err)
+	}
+	os.Setenv("TERRA_CI_PLAN_SFN_ARN", "arn:aws:states:eu-west-1:123:stateMachine:plan")
+
+	sfnClient := awstest.NewFakeSfn(awstest.NewFakeTaskHistory("Plan", "/aws/codebuild/plan", "stream", true))
+	cloudwatchClient := awstest.NewFakeCloudwatch()
+	cloudwatchClient.AddLogs("/aws/codebuild/plan", "stream", "Initializing modules\nPlan: 0 to add\n")
+	newAwsClient := commands.NewAwsClient
+	commands.NewAwsClient = func() (*aws.Client, error) {
+		return aws.NewClientWithAPI(sfnClient, cloudwatchClient, awstest.NewFakeS3()), nil
+	}
+	t.Cleanup(func() {
+		commands.NewAwsClient = newAwsClient
+		os.Unsetenv("TERRA_CI_PLAN_SFN_ARN")
+		os.Chdir(wd)
+	})
+	return sfnClient
+}
+
+func TestParallelBatch(t *testing.T) {
+	for _, parallelism := range []string{"1", "3"} {
+		t.Run("parallelism "+parallelism, func(t *testing.T) {
+			sfnClient := setupBatch(t, map[string]string{
+				"prod/vpc": `terraform { source = "../../../modules//vpc" }`,
+				"prod/dns": `terraform { source = "../../../modules//dns" }`,
+				"prod/app": "dependency \"vpc\" {\n  config_path = \"../vpc\"\n}\n",
+			})
+			var out, outErr bytes.Buffer
+			cmd := commands.NewTerraCICommand(strings.NewReader(""), &out, &outErr)
+			cmd.SetArgs([]string{"workspace", "plan-all", "--refresh-rate", "0", "--parallelism", parallelism, "--api-rate-limit", "50", "-o", "text"})
+			if err := cmd.Execute(); err != nil {
+				t.Fatalf("unexpected error: %s\n%s", err, outErr.String())
+			}
+
+			if len(sfnClient.Started) != 3 {
+				t.Fatalf("expected 3 executions, got %d", len(sfnClient.Started))
+			}
+			// app waits for vpc
+			started := []string{}
+			for _, input := range sfnClient.Started {
+				started = append(started, *input.Input)
+			}
+			vpc, app := -1, -1
+			for i, input := range started {
+				switch {
+				case strings.Contains(input, "live/prod/vpc"):
+					vpc = i
+				case strings.Contains(input, "live/prod/app"):
+					app = i
+				}
+			}
+			if vpc < 0 || app < vpc {
+				t.Fatalf("expected app to start after vpc, got %v", started)
+			}
+
+			output := out.String()
+			for _, path := range []string{"live/prod/vpc", "live/prod/dns", "live/prod/app"} {
+				prefix := ""
+				if parallelism != "1" {
+					prefix = "[" + path + "] "
+				}
+				if !strings.Contains(output, prefix+"==> plan "+path+"\n") {
+					t.Errorf("expected output of %s with prefix %q, got\n%s", path, prefix, output)
+				}
+				if !strings.Contains(output, prefix+"Initializing modules\n") {
+					t.Errorf("expected logs of %s with prefix %q, got\n%s", path, prefix, output)
+				}
+			}
+			if !strings.Contains(output, "WORKSPACE") || strings.Count(output, "succeeded") != 3 {
+				t.Errorf("expected result table with 3 succeeded workspaces, got\n%s", output)
+			}
+		})
+	}
+}
@@ -4,13 +4,64 @@ import (
 	"io"
 	"os"
 
+	"github.com/p0tr3c/terra-ci/aws"
 	"github.com/p0tr3c/terra-ci/config"
-	"github.com/p0tr3c/terra-ci/fflags"
 	"github.com/p0tr3c/terra-ci/logs"
+	"github.com/p0tr3c/terra-ci/plans"
+	"github.com/p0tr3c/terra-ci/prompt"
+	"github.com/p0tr3c/terra-ci/reports"
 
 	"github.com/spf13/cobra"
 )
 
+// NewAwsClient creates AWS clients passed down to remote executions.
+// It can be replaced to run commands against fake AWS APIs.
+var NewAwsClient = func() (*aws.Client, error) {
+	client, err := aws.NewClient()
+	if err != nil {
+		return nil, err
+	}
+	client.LogGroupFormat = config.Configuration.GetString("codebuild_log_group_format")
+	return client, nil
+}
+
+const (
+	reportFlagUsage = "Report execution events as kind=target, where kind is one of json, timing or webhook"
+)
+
+// getReportSubscribers creates event subscribers requested with --report.
+func getReportSubscribers(cmd *cobra.Command) ([]aws.SfnEventSubscriber, error) {
+	specs, err := cmd.Flags().GetStringArray("report")
+	if err != nil {
+		return nil, err
+	}
+	return reports.NewSubscribers(specs)
+}
+
+// executeWithOutput runs execute in output mode selected with --output.
+// Text output is written to stdout. In structured modes human readable
+// progress is written to stderr, while the execution result is recorded
+// by subscriber and written to stdout.
+func executeWithOutput(cmd *cobra.Command, action, path string, subscribers *[]aws.SfnEventSubscriber, execute func(out io.Writer) (*plans.Summary, error)) error {
+	format := config.Configuration.GetString("output")
+	// Printed state machine input is already machine readable
+	printInput, _ := cmd.Flags().GetBool("print-input")
+	if format == reports.OutputText || printInput {
+		_, err := execute(cmd.OutOrStdout())
+		return err
+	}
+	recorder, err := reports.NewExecutionRecorder(format, cmd.OutOrStdout(), action, path)
+	if err != nil {
+		return err
+	}
+	*subscribers = append(*subscribers, recorder)
+	recorder.Result.Plan, err = execute(cmd.ErrOrStderr())
+	if recordErr := recorder.Finish(err); recordErr != nil && err == nil {
+		return recordErr
+	}
+	return err
+}
+
 func NewDefaultTerraCICommand() *cobra.Command {
 	return NewTerraCICommand(os.Stdin, os.Stdout, os.Stderr)
 }
@@ -25,21 +76,23 @@ func NewTerraCICommand(in io.Reader, out, outErr io.Writer) *cobra.Command {
 	command := &cobra.Command{
 		Use:              "terra-ci",
 		Short:            "Manages and executes terragrunt remote actions",
+		Version:          config.Version,
 		PersistentPreRun: readConfig,
+		Args:             usageArgs(cobra.NoArgs),
 		Run:              runHelp,
+		// Errors are printed by main, which maps them to exit codes
+		SilenceErrors: true,
 	}
 	SetCommandBuffers(command, in, out, outErr)
+	command.SetFlagErrorFunc(flagError)
 
 	// Global flags
 	config.AddConfigFlags(command)
 
 	// Subcommands
-	if fflags.IsEnabled("SFN_MONITOR") {
-		command.AddCommand(NewWorkspaceWithMontiorCommand(in, out, outErr))
-	} else {
-		command.AddCommand(NewWorkspaceCommand(in, out, outErr))
-		command.AddCommand(NewModuleCommand(in, out, outErr))
-	}
+	command.AddCommand(NewWorkspaceCommand(in, out, outErr))
+	command.AddCommand(NewModuleCommand(in, out, outErr))
+	command.AddCommand(NewExecutionCommand(in, out, outErr))
 	return command
 }
 
@@ -52,6 +105,13 @@ func readConfig(cmd *cobra.Command, args []string) {
 	logs.UpdateLoggerConfig()
 }
 
+// confirm returns confirmation asked on input and output of the command.
+func confirm(cmd *cobra.Command) aws.ConfirmFunc {
+	return func(message string) (bool, error) {
+		return prompt.Confirm(cmd.InOrStdin(), cmd.OutOrStdout(), message)
+	}
+}
+
 func runHelp(cmd *cobra.Command, args []string) {
 	if err := cmd.Help(); err != nil {
 		os.Exit(1)
@@ -14,6 +14,7 @@ func NewConfigCommand(in io.Reader, out, outErr io.Writer) *cobra.Command {
 	command := &cobra.Command{
 		Use:   "config",
 		Short: "Manage configuration file",
+		Args:  usageArgs(cobra.NoArgs),
 		Run:   runHelp,
 	}
 	SetCommandBuffers(command, in, out, outErr)
@@ -0,0 +1,287 @@
+package commands
+
+import (
+	"fmt"
+	"io"
+	"text/tabwriter"
+	"time"
+
+	"github.com/p0tr3c/terra-ci/aws"
+	"github.com/p0tr3c/terra-ci/config"
+	"github.com/p0tr3c/terra-ci/logs"
+	"github.com/p0tr3c/terra-ci/prompt"
+
+	awssdk "github.com/aws/aws-sdk-go/aws"
+	"github.com/spf13/cobra"
+)
+
+var (
+	executionStateMachineKeys = []string{
+		"plan_sfn_arn",
+		"apply_sfn_arn",
+		"destroy_sfn_arn",
+		"test_sfn_arn",
+	}
+)
+
+func NewExecutionCommand(in io.Reader, out, outErr io.Writer) *cobra.Command {
+	command := &cobra.Command{
+		Use:   "execution",
+		Short: "Manage remote executions",
+		Args:  usageArgs(cobra.NoArgs),
+		Run:   runHelp,
+	}
+	SetCommandBuffers(command, in, out, outErr)
+
+	command.AddCommand(NewExecutionListCommand(in, out, outErr))
+	command.AddCommand(NewExecutionStatusCommand(in, out, outErr))
+	command.AddCommand(NewExecutionAttachCommand(in, out, outErr))
+	command.AddCommand(NewExecutionAbortCommand(in, out, outErr))
+	return command
+}
+
+// getExecutionStateMachines returns unique state machine arns from
+// configuration.
+func getExecutionStateMachines() []string {
+	seen := make(map[string]bool)
+	stateMachines := []string{}
+	for _, key := range executionStateMachineKeys {
+		arn := config.Configuration.GetString(key)
+		if arn == "" || seen[arn] {
+			continue
+		}
+		seen[arn] = true
+		stateMachines = append(stateMachines, arn)
+	}
+	return stateMachines
+}
+
+func formatExecutionTime(t *time.Time) string {
+	if t == nil {
+		return "-"
+	}
+	return t.Format(time.RFC3339)
+}
+
+/*************************** LIST ***************************************/
+
+func NewExecutionListCommand(in io.Reader, out, outErr io.Writer) *cobra.Command {
+	command := &cobra.Command{
+		Use:          "list",
+		Short:        "List recent terra-ci executions",
+		RunE:         runExecutionList,
+		SilenceUsage: true,
+	}
+	SetCommandBuffers(command, in, out, outErr)
+	command.Flags().Int("limit", 20, "Maximum number of executions listed per state machine")
+	command.Flags().String("status", "", "List only executions with status, e.g. RUNNING")
+	return command
+}
+
+func runExecutionList(cmd *cobra.Command, args []string) error {
+	limit, err := cmd.Flags().GetInt("limit")
+	if err != nil {
+		return err
+	}
+	status, err := cmd.Flags().GetString("status")
+	if err != nil {
+		return err
+	}
+	client, err := NewAwsClient()
+	if err != nil {
+		logs.Logger.Errorw("failed to create aws client",
+			"error", err)
+		cmd.PrintErrf("failed to create aws client")
+		return err
+	}
+
+	stateMachines := getExecutionStateMachines()
+	if len(stateMachines) == 0 {
+		cmd.PrintErrf("no state machine configured\n")
+		return fmt.Errorf("no state machine configured")
+	}
+
+	w := tabwriter.NewWriter(cmd.OutOrStdout(), 0, 4, 2, ' ', 0)
+	fmt.Fprintf(w, "NAME\tSTATUS\tSTARTED\tSTOPPED\tARN\n")
+	for _, stateMachine := range stateMachines {
+		executions, err := client.ListExecutions(stateMachine, status, limit)
+		if err != nil {
+			logs.Logger.Errorw("failed to list executions",
+				"stateMachine", stateMachine,
+				"error", err)
+			cmd.PrintErrf("failed to list executions of %s", stateMachine)
+			return err
+		}
+		for _, execution := range executions {
+			fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\n",
+				awssdk.StringValue(execution.Name),
+				awssdk.StringValue(execution.Status),
+				formatExecutionTime(execution.StartDate),
+				formatExecutionTime(execution.StopDate),
+				awssdk.StringValue(execution.ExecutionArn))
+		}
+	}
+	return w.Flush()
+}
+
+/*************************** STATUS ***************************************/
+
+func NewExecutionStatusCommand(in io.Reader, out, outErr io.Writer) *cobra.Command {
+	command := &cobra.Command{
+		Use:          "status",
+		Short:        "Show status of remote execution",
+		PreRunE:      requireFlags("arn"),
+		RunE:         runExecutionStatus,
+		SilenceUsage: true,
+	}
+	SetCommandBuffers(command, in, out, outErr)
+	command.Flags().String("arn", "", "Execution arn")
+	return command
+}
+
+func runExecutionStatus(cmd *cobra.Command, args []string) error {
+	arn, err := cmd.Flags().GetString("arn")
+	if err != nil {
+		return err
+	}
+	client, err := NewAwsClient()
+	if err != nil {
+		logs.Logger.Errorw("failed to create aws client",
+			"error", err)
+		cmd.PrintErrf("failed to create aws client")
+		return err
+	}
+
+	execution, err := client.DescribeExecution(arn)
+	if err != nil {
+		logs.Logger.Errorw("failed to describe execution",
+			"arn", arn,
+			"error", err)
+		cmd.PrintErrf("failed to describe execution %s", arn)
+		return err
+	}
+
+	w := tabwriter.NewWriter(cmd.OutOrStdout(), 0, 4, 2, ' ', 0)
+	fmt.Fprintf(w, "Name:\t%s\n", awssdk.StringValue(execution.Name))
+	fmt.Fprintf(w, "Arn:\t%s\n", awssdk.StringValue(execution.ExecutionArn))
+	fmt.Fprintf(w, "State machine:\t%s\n", awssdk.StringValue(execution.StateMachineArn))
+	fmt.Fprintf(w, "Status:\t%s\n", awssdk.StringValue(execution.Status))
+	fmt.Fprintf(w, "Started:\t%s\n", formatExecutionTime(execution.StartDate))
+	fmt.Fprintf(w, "Stopped:\t%s\n", formatExecutionTime(execution.StopDate))
+	if execution.Output != nil {
+		if logInformation, err := aws.GetCloudwatchLogsReference(execution); err == nil && logInformation.TaskResults.Build.Logs.DeepLink != "" {
+			fmt.Fprintf(w, "Logs:\t%s\n", logInformation.TaskResults.Build.Logs.DeepLink)
+		}
+	}
+	return w.Flush()
+}
+
+/*************************** ATTACH ***************************************/
+
+func NewExecutionAttachCommand(in io.Reader, out, outErr io.Writer) *cobra.Command {
+	command := &cobra.Command{
+		Use:          "attach",
+		Short:        "Follow remote execution and replay its task logs",
+		PreRunE:      requireFlags("arn"),
+		RunE:         runExecutionAttach,
+		SilenceUsage: true,
+	}
+	SetCommandBuffers(command, in, out, outErr)
+	command.Flags().String("arn", "", "Execution arn")
+	command.Flags().StringArray("report", []string{}, reportFlagUsage)
+	return command
+}
+
+func runExecutionAttach(cmd *cobra.Command, args []string) error {
+	arn, err := cmd.Flags().GetString("arn")
+	if err != nil {
+		return err
+	}
+	client, err := NewAwsClient()
+	if err != nil {
+		logs.Logger.Errorw("failed to create aws client",
+			"error", err)
+		cmd.PrintErrf("failed to create aws client")
+		return err
+	}
+	subscribers, err := getReportSubscribers(cmd)
+	if err != nil {
+		logs.Logger.Errorw("failed to create report subscribers",
+			"error", err)
+		cmd.PrintErrf("invalid report")
+		return err
+	}
+
+	if err := client.MonitorStateMachineStatus(arn,
+		config.Configuration.GetDuration("refresh_rate"),
+		config.Configuration.GetDuration("sfn_execution_timeout"),
+		config.Configuration.GetBool("ci_mode"),
+		config.Configuration.GetBool("ci_abort_on_interrupt"),
+		confirm(cmd), cmd.OutOrStdout(), cmd.OutOrStderr(), subscribers...); err != nil {
+		logs.Logger.Errorw("failed to monitor execution",
+			"arn", arn,
+			"error", err)
+		cmd.PrintErrf("failed to monitor execution %s", arn)
+		return err
+	}
+	return nil
+}
+
+/*************************** ABORT ***************************************/
+
+func NewExecutionAbortCommand(in io.Reader, out, outErr io.Writer) *cobra.Command {
+	command := &cobra.Command{
+		Use:          "abort",
+		Short:        "Stop running remote execution",
+		PreRunE:      requireFlags("arn"),
+		RunE:         runExecutionAbort,
+		SilenceUsage: true,
+	}
+	SetCommandBuffers(command, in, out, outErr)
+	command.Flags().String("arn", "", "Execution arn")
+	command.Flags().String("cause", "aborted with terra-ci", "Cause recorded on the stopped execution")
+	return command
+}
+
+func runExecutionAbort(cmd *cobra.Command, args []string) error {
+	arn, err := cmd.Flags().GetString("arn")
+	if err != nil {
+		return err
+	}
+	cause, err := cmd.Flags().GetString("cause")
+	if err != nil {
+		return err
+	}
+	client, err := NewAwsClient()
+	if err != nil {
+		logs.Logger.Errorw("failed to create aws client",
+			"error", err)
+		cmd.PrintErrf("failed to create aws client")
+		return err
+	}
+
+	if !config.Configuration.GetBool("ci_mode") {
+		confirmed, err := prompt.Confirm(cmd.InOrStdin(), cmd.OutOrStdout(),
+			fmt.Sprintf("abort remote execution %s?", arn))
+		if err != nil {
+			logs.Logger.Errorw("failed to read confirmation",
+				"error", err)
+			cmd.PrintErrf("failed to read confirmation")
+			return err
+		}
+		if !confirmed {
+			cmd.Printf("abort cancelled\n")
+			return nil
+		}
+	}
+
+	if err := client.StopExecution(arn, cause); err != nil {
+		logs.Logger.Errorw("failed to stop execution",
+			"arn", arn,
+			"error", err)
+		cmd.PrintErrf("failed to abort execution %s", arn)
+		return err
+	}
+	cmd.Printf("execution %s aborted\n", arn)
+	return nil
+}
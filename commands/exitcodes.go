@@ -0,0 +1,114 @@
+package commands
+
+import (
+	"errors"
+	"fmt"
+	"os/exec"
+	"strings"
+
+	"github.com/p0tr3c/terra-ci/aws"
+	"github.com/p0tr3c/terra-ci/policy"
+	"github.com/p0tr3c/terra-ci/workspaces"
+
+	"github.com/spf13/cobra"
+)
+
+// Process exit codes, documented in README.md
+const (
+	ExitOk               = 0
+	ExitError            = 1
+	ExitPlanChanges      = 2
+	ExitUsage            = 3
+	ExitAuth             = 4
+	ExitTimeout          = 5
+	ExitExecutionFailed  = 6
+	ExitExecutionAborted = 7
+	ExitLocalCommand     = 8
+	ExitPolicy           = 9
+	ExitProtected        = 10
+	ExitInterrupted      = 130
+)
+
+// UsageError is returned for invalid flags and arguments.
+type UsageError struct {
+	Err error
+}
+
+func (e *UsageError) Error() string {
+	return e.Err.Error()
+}
+
+func (e *UsageError) Unwrap() error {
+	return e.Err
+}
+
+func flagError(cmd *cobra.Command, err error) error {
+	return &UsageError{Err: err}
+}
+
+// usageArgs reports errors of positional arguments validator as usage errors.
+// Commands with subcommands use it with cobra.NoArgs to refuse unknown
+// subcommands.
+func usageArgs(validate cobra.PositionalArgs) cobra.PositionalArgs {
+	return func(cmd *cobra.Command, args []string) error {
+		if err := validate(cmd, args); err != nil {
+			return &UsageError{Err: err}
+		}
+		return nil
+	}
+}
+
+// requireFlags returns PreRunE refusing to run command without named flags.
+func requireFlags(names ...string) func(cmd *cobra.Command, args []string) error {
+	return func(cmd *cobra.Command, args []string) error {
+		missing := []string{}
+		for _, name := range names {
+			if !cmd.Flags().Changed(name) {
+				missing = append(missing, name)
+			}
+		}
+		if len(missing) > 0 {
+			return &UsageError{Err: fmt.Errorf(`required flag(s) "%s" not set`, strings.Join(missing, `", "`))}
+		}
+		return nil
+	}
+}
+
+// ExitCode returns process exit code for error returned by command.
+func ExitCode(err error) int {
+	if err == nil {
+		return ExitOk
+	}
+	var planChanges *workspaces.PlanChangesError
+	var usage *UsageError
+	var executionStatus *aws.ExecutionStatusError
+	var timeout aws.TimeoutError
+	var interrupted aws.InterruptedError
+	var policyErr *policy.PolicyError
+	var protectionErr *workspaces.DestroyProtectionError
+	var exitErr *exec.ExitError
+	switch {
+	case errors.As(err, &planChanges):
+		return ExitPlanChanges
+	case errors.As(err, &usage):
+		return ExitUsage
+	case aws.IsAuthError(err):
+		return ExitAuth
+	case errors.As(err, &timeout):
+		return ExitTimeout
+	case errors.As(err, &interrupted):
+		return ExitInterrupted
+	case errors.As(err, &executionStatus):
+		if executionStatus.Status == "ExecutionAborted" {
+			return ExitExecutionAborted
+		}
+		return ExitExecutionFailed
+	case errors.As(err, &policyErr):
+		return ExitPolicy
+	case errors.As(err, &protectionErr):
+		return ExitProtected
+	case errors.As(err, &exitErr):
+		return ExitLocalCommand
+	}
+	return ExitError
+}
@@ -0,0 +1,94 @@
+package commands_test
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"os/exec"
+	"strings"
+	"testing"
+
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/p0tr3c/terra-ci/aws"
+	"github.com/p0tr3c/terra-ci/commands"
+	"github.com/p0tr3c/terra-ci/policy"
+	"github.com/p0tr3c/terra-ci/workspaces"
+)
+
+func TestExitCode(t *testing.T) {
+	exitErr := exec.Command("sh", "-c", "exit 3").Run()
+	if exitErr == nil {
+		t.Fatalf("expected command to fail")
+	}
+
+	tests := []struct {
+		name string
+		err  error
+		code int
+	}{
+		{"success", nil, commands.ExitOk},
+		{"generic", errors.New("failed"), commands.ExitError},
+		{"plan changes", &workspaces.PlanChangesError{Path: "live/prod/vpc"}, commands.ExitPlanChanges},
+		{"usage", &commands.UsageError{Err: errors.New("invalid flag")}, commands.ExitUsage},
+		{"auth", awserr.New("ExpiredToken", "token expired", nil), commands.ExitAuth},
+		{"wrapped auth", fmt.Errorf("failed to start: %w", awserr.New("AccessDeniedException", "denied", nil)), commands.ExitAuth},
+		{"other aws error", awserr.New("ThrottlingException", "slow down", nil), commands.ExitError},
+		{"timeout", aws.TimeoutError("timed out"), commands.ExitTimeout},
+		{"interrupted", aws.InterruptedError("interrupted"), commands.ExitInterrupted},
+		{"execution aborted", &aws.ExecutionStatusError{Status: "ExecutionAborted"}, commands.ExitExecutionAborted},
+		{"execution failed", &aws.ExecutionStatusError{Status: "ExecutionFailed"}, commands.ExitExecutionFailed},
+		{"execution timed out", &aws.ExecutionStatusError{Status: "ExecutionTimedOut"}, commands.ExitExecutionFailed},
+		{"policy", &policy.PolicyError{Reason: "destroy can not be checked"}, commands.ExitPolicy},
+		{"protected", &workspaces.DestroyProtectionError{Workspace: "live/prod/vpc", Reason: "destroy"}, commands.ExitProtected},
+		{"local command", exitErr, commands.ExitLocalCommand},
+		{"wrapped local command", fmt.Errorf("terragrunt failed: %w", exitErr), commands.ExitLocalCommand},
+		{"batch", &workspaces.BatchError{Failed: 1, Err: errors.New("failed")}, commands.ExitError},
+		{"batch of failed executions", &workspaces.BatchError{Failed: 2, Err: &aws.ExecutionStatusError{Status: "ExecutionFailed"}}, commands.ExitExecutionFailed},
+		{"batch of protected workspace", &workspaces.BatchError{Failed: 1, Skipped: 2, Err: &workspaces.DestroyProtectionError{Workspace: "live/prod/vpc"}}, commands.ExitProtected},
+		{"wrapped batch", fmt.Errorf("apply-all: %w", &workspaces.BatchError{Failed: 1, Err: aws.InterruptedError("interrupted")}), commands.ExitInterrupted},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if code := commands.ExitCode(tt.err); code != tt.code {
+				t.Fatalf("expected exit code %d, got %d", tt.code, code)
+			}
+		})
+	}
+}
+
+func TestUsageErrors(t *testing.T) {
+	setupBatch(t, map[string]string{})
+
+	tests := []struct {
+		name    string
+		args    []string
+		message string
+	}{
+		{"unknown command", []string{"bogus"}, `unknown command "bogus" for "terra-ci"`},
+		{"unknown subcommand", []string{"workspace", "bogus"}, `unknown command "bogus" for "terra-ci workspace"`},
+		{"unknown nested subcommand", []string{"workspace", "policy", "bogus"}, `unknown command "bogus" for "terra-ci workspace policy"`},
+		{"unknown flag", []string{"workspace", "plan", "--bogus"}, "unknown flag: --bogus"},
+		{"required flag", []string{"execution", "status"}, `required flag(s) "arn" not set`},
+		{"required flag of revert", []string{"workspace", "revert", "--path", "live/prod/vpc"}, `required flag(s) "ref" not set`},
+		{"required flag of create", []string{"workspace", "create"}, `required flag(s) "path" not set`},
+		{"too many arguments", []string{"workspace", "apply", "--path", "live/prod/vpc", "a.tfplan", "b.tfplan"}, "accepts at most 1 arg(s), received 2"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var out, outErr bytes.Buffer
+			cmd := commands.NewTerraCICommand(strings.NewReader(""), &out, &outErr)
+			cmd.SetArgs(tt.args)
+			err := cmd.Execute()
+			var usage *commands.UsageError
+			if !errors.As(err, &usage) {
+				t.Fatalf("expected usage error, got %v", err)
+			}
+			if !strings.Contains(err.Error(), tt.message) {
+				t.Fatalf("expected error %q, got %q", tt.message, err.Error())
+			}
+			if code := commands.ExitCode(err); code != commands.ExitUsage {
+				t.Fatalf("expected exit code %d, got %d", commands.ExitUsage, code)
+			}
+		})
+	}
+}
@@ -7,6 +7,7 @@ import (
 	"github.com/p0tr3c/terra-ci/config"
 	"github.com/p0tr3c/terra-ci/logs"
 	"github.com/p0tr3c/terra-ci/modules"
+	"github.com/p0tr3c/terra-ci/plans"
 
 	"github.com/spf13/cobra"
 )
@@ -20,6 +21,7 @@ var (
 			"disable-cgo",
 			"timeout",
 			"run",
+			"print-input",
 		},
 	}
 )
@@ -42,6 +44,8 @@ func (w ModuleFlags) Get(cmd *cobra.Command, args []string, flag string) (interf
 		return cmd.Flags().GetString("timeout")
 	case "run":
 		return cmd.Flags().GetString("run")
+	case "print-input":
+		return cmd.Flags().GetBool("print-input")
 	default:
 		return nil, fmt.Errorf("unsupported flag %s", flag)
 	}
@@ -51,6 +55,7 @@ func NewModuleCommand(in io.Reader, out, outErr io.Writer) *cobra.Command {
 	command := &cobra.Command{
 		Use:   "module",
 		Short: "Manage terraform modules",
+		Args:  usageArgs(cobra.NoArgs),
 		Run:   runHelp,
 	}
 	SetCommandBuffers(command, in, out, outErr)
@@ -59,6 +64,7 @@ func NewModuleCommand(in io.Reader, out, outErr io.Writer) *cobra.Command {
 
 	command.PersistentFlags().Bool("local", false, "Run action with localy")
 	command.PersistentFlags().Bool("disable-cgo", false, "Disable CGO")
+	command.PersistentFlags().StringArray("report", []string{}, reportFlagUsage)
 
 	command.AddCommand(NewModuleTestCommand(in, out, outErr))
 	return command
@@ -70,7 +76,7 @@ func getModuleExecutionInput(cmd *cobra.Command, args []string) (*modules.Module
 	for _, flag := range moduleFlags.Flags {
 		inputConfig[flag], err = moduleFlags.Get(cmd, args, flag)
 		if err != nil {
-			return nil, err
+			return nil, &UsageError{Err: err}
 		}
 	}
 
@@ -85,8 +91,21 @@ func getModuleExecutionInput(cmd *cobra.Command, args []string) (*modules.Module
 		ExecutionTimeout: config.Configuration.GetDuration("sfn_execution_timeout"),
 		RefreshRate:      config.Configuration.GetDuration("refresh_rate"),
 		IsCi:             config.Configuration.GetBool("ci_mode"),
+		AbortOnInterrupt: config.Configuration.GetBool("ci_abort_on_interrupt"),
+		Confirm:          confirm(cmd),
 		Local:            inputConfig["local"].(bool),
 		DisableCgo:       inputConfig["disable-cgo"].(bool),
+		PrintInput:       inputConfig["print-input"].(bool),
+	}
+	if !input.Local {
+		input.Client, err = NewAwsClient()
+		if err != nil {
+			return nil, err
+		}
+		input.Subscribers, err = getReportSubscribers(cmd)
+		if err != nil {
+			return nil, &UsageError{Err: err}
+		}
 	}
 
 	return input, nil
@@ -105,6 +124,7 @@ func NewModuleTestCommand(in io.Reader, out, outErr io.Writer) *cobra.Command {
 	command.Flags().String("branch", "main", "Branch to execute module test on")
 	command.Flags().String("timeout", "5m", "Test timeout, default '5m'")
 	command.Flags().String("run", "", "Specific test to run")
+	command.Flags().Bool("print-input", false, "Print state machine input without starting execution")
 	return command
 }
 
@@ -119,7 +139,9 @@ func runModuleTest(cmd *cobra.Command, args []string) error {
 
 	executionInput.Action = "test"
 
-	if err := modules.ExecuteModuleWithOutput(executionInput, cmd.InOrStdin(), cmd.OutOrStdout(), cmd.OutOrStderr()); err != nil {
+	if err := executeWithOutput(cmd, executionInput.Action, executionInput.Path, &executionInput.Subscribers, func(out io.Writer) (*plans.Summary, error) {
+		return nil, modules.ExecuteModuleWithOutput(executionInput, cmd.InOrStdin(), out, cmd.OutOrStderr())
+	}); err != nil {
 		logs.Logger.Errorw("failed to execute workspace",
 			"executionInput", executionInput,
 			"error", err)
@@ -1,12 +1,21 @@
 package commands
 
 import (
+	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
+	"io/ioutil"
 	"path/filepath"
+	"text/tabwriter"
 
+	"github.com/p0tr3c/terra-ci/artifacts"
 	"github.com/p0tr3c/terra-ci/config"
 	"github.com/p0tr3c/terra-ci/logs"
+	"github.com/p0tr3c/terra-ci/plans"
+	"github.com/p0tr3c/terra-ci/policy"
+	"github.com/p0tr3c/terra-ci/prompt"
+	"github.com/p0tr3c/terra-ci/reports"
 	"github.com/p0tr3c/terra-ci/workspaces"
 
 	"github.com/spf13/cobra"
@@ -23,6 +32,7 @@ var (
 			"out",
 			"no-refresh",
 			"ci-path",
+			"print-input",
 		},
 	}
 )
@@ -36,7 +46,7 @@ func (w WorkspaceFlags) Get(cmd *cobra.Command, args []string, flag string) (int
 	case "path":
 		return cmd.Flags().GetString("path")
 	case "branch":
-		if cmd.Use == "plan" || cmd.Use == "create" {
+		if cmd.Use == "plan" || cmd.Use == "plan-all" || cmd.Use == "create" {
 			return cmd.Flags().GetString("branch")
 		} else {
 			return "", nil
@@ -55,7 +65,7 @@ func (w WorkspaceFlags) Get(cmd *cobra.Command, args []string, flag string) (int
 		return destroy, nil
 	case "no-refresh":
 		noRefresh := false
-		if cmd.Use == "plan" {
+		if cmd.Use == "plan" || cmd.Use == "plan-all" {
 			return cmd.Flags().GetBool("no-refresh")
 		}
 		return noRefresh, nil
@@ -64,6 +74,11 @@ func (w WorkspaceFlags) Get(cmd *cobra.Command, args []string, flag string) (int
 			return cmd.Flags().GetString("ci-path")
 		}
 		return "", nil
+	case "print-input":
+		if cmd.Use == "plan" || cmd.Use == "apply" {
+			return cmd.Flags().GetBool("print-input")
+		}
+		return false, nil
 	default:
 		return nil, fmt.Errorf("unsupported flag %s", flag)
 	}
@@ -73,6 +88,7 @@ func NewWorkspaceCommand(in io.Reader, out, outErr io.Writer) *cobra.Command {
 	command := &cobra.Command{
 		Use:   "workspace",
 		Short: "Manage terraform workspace",
+		Args:  usageArgs(cobra.NoArgs),
 		Run:   runHelp,
 	}
 	SetCommandBuffers(command, in, out, outErr)
@@ -81,33 +97,73 @@ func NewWorkspaceCommand(in io.Reader, out, outErr io.Writer) *cobra.Command {
 
 	command.PersistentFlags().Bool("local", false, "Run action with localy")
 	command.PersistentFlags().String("source", "", "Full path to local modules")
+	command.PersistentFlags().StringArray("report", []string{}, reportFlagUsage)
+	command.PersistentFlags().String("i-understand-destroy", "", "Path of protected workspace, confirms destroying its resources")
 
 	command.AddCommand(NewWorkspacePlanCommand(in, out, outErr))
 	command.AddCommand(NewWorkspaceApplyCommand(in, out, outErr))
+	command.AddCommand(NewWorkspaceDestroyCommand(in, out, outErr))
+	command.AddCommand(NewWorkspaceDeleteCommand(in, out, outErr))
+	command.AddCommand(NewWorkspaceRevertCommand(in, out, outErr))
 	command.AddCommand(NewWorkspaceCreateCommand(in, out, outErr))
+	command.AddCommand(NewWorkspacePolicyCommand(in, out, outErr))
+	command.AddCommand(NewWorkspaceListCommand(in, out, outErr))
+	command.AddCommand(NewWorkspaceChangedCommand(in, out, outErr))
+	command.AddCommand(NewWorkspacePlanAllCommand(in, out, outErr))
+	command.AddCommand(NewWorkspaceApplyAllCommand(in, out, outErr))
+	command.AddCommand(NewWorkspaceGraphCommand(in, out, outErr))
 	return command
 }
 
+// getPolicy loads policy configured with policy_file, if any.
+func getPolicy() (*policy.Policy, error) {
+	policyFile := config.Configuration.GetString("policy_file")
+	if policyFile == "" {
+		return nil, nil
+	}
+	return policy.LoadPolicy(policyFile)
+}
+
+// getDestroyProtection resolves protection of workspace at path. Batch
+// commands take confirmation naming one of their workspaces.
+func getDestroyProtection(cmd *cobra.Command, path string) (*workspaces.DestroyProtection, error) {
+	confirmation, err := cmd.Flags().GetString("i-understand-destroy")
+	if err != nil {
+		return nil, err
+	}
+	if isBatchCommand(cmd) && filepath.Clean(confirmation) != filepath.Clean(path) {
+		confirmation = ""
+	}
+	return workspaces.NewDestroyProtection(path,
+		config.Configuration.GetStringSlice("protected_paths"),
+		config.Configuration.GetInt("protected_max_destroy"),
+		confirmation)
+}
+
 func getOutPlan(cmd *cobra.Command, args []string) (string, error) {
 	var outPlan string
 	var err error
 	switch cmd.Use {
-	case "plan":
+	case "plan", "plan-all":
 		outPlan, err = cmd.Flags().GetString("out")
 	case "apply":
 		if len(args) == 1 {
 			outPlan = args[0]
 		}
+	case "apply-all":
+		outPlan, err = cmd.Flags().GetString("plan-file")
 	}
 	return outPlan, err
 }
 
 func getExecutionArn(cmd *cobra.Command, args []string) string {
 	switch cmd.Use {
-	case "apply":
+	case "apply", "apply-all":
 		return config.Configuration.GetString("apply_sfn_arn")
-	case "plan":
+	case "plan", "plan-all":
 		return config.Configuration.GetString("plan_sfn_arn")
+	case "destroy":
+		return config.Configuration.GetString("destroy_sfn_arn")
 	default:
 		return ""
 	}
@@ -119,7 +175,7 @@ func getExecutionInput(cmd *cobra.Command, args []string) (*workspaces.Workspace
 	for _, flag := range workspaceFlags.Flags {
 		inputConfig[flag], err = workspaceFlags.Get(cmd, args, flag)
 		if err != nil {
-			return nil, err
+			return nil, &UsageError{Err: err}
 		}
 	}
 
@@ -135,8 +191,38 @@ func getExecutionInput(cmd *cobra.Command, args []string) (*workspaces.Workspace
 		ExecutionTimeout:    config.Configuration.GetDuration("sfn_execution_timeout"),
 		RefreshRate:         config.Configuration.GetDuration("refresh_rate"),
 		IsCi:                config.Configuration.GetBool("ci_mode"),
+		AbortOnInterrupt:    config.Configuration.GetBool("ci_abort_on_interrupt"),
+		Confirm:             confirm(cmd),
 		Local:               inputConfig["local"].(bool),
 		LocalModules:        inputConfig["source"].(string),
+		PrintInput:          inputConfig["print-input"].(bool),
+	}
+	input.Policy, err = getPolicy()
+	if err != nil {
+		return nil, &UsageError{Err: err}
+	}
+	// Batch commands resolve protection of each workspace separately
+	if !isBatchCommand(cmd) {
+		input.DestroyProtection, err = getDestroyProtection(cmd, input.Path)
+		if err != nil {
+			return nil, &UsageError{Err: err}
+		}
+	}
+	if !input.Local {
+		input.Client, err = NewAwsClient()
+		if err != nil {
+			return nil, err
+		}
+		input.Subscribers, err = getReportSubscribers(cmd)
+		if err != nil {
+			return nil, &UsageError{Err: err}
+		}
+		if storeUri := config.Configuration.GetString("artifact_store"); storeUri != "" {
+			input.ArtifactStore, err = artifacts.NewStore(storeUri, input.Client)
+			if err != nil {
+				return nil, err
+			}
+		}
 	}
 
 	return input, nil
@@ -156,6 +242,9 @@ func NewWorkspacePlanCommand(in io.Reader, out, outErr io.Writer) *cobra.Command
 	command.Flags().String("out", "", "Name of plan file to generate")
 	command.Flags().Bool("destroy", false, "Generate destroy plan")
 	command.Flags().Bool("no-refresh", false, "Disable state synchronization")
+	command.Flags().Bool("print-input", false, "Print state machine input without starting execution")
+	command.Flags().Bool("detailed-exitcode", false, "Exit with 2 when plan succeeded with changes")
+	command.Flags().String("report-markdown", "", "Write markdown report of the plan for pull request comments")
 	return command
 }
 
@@ -169,8 +258,22 @@ func runWorkspacePlan(cmd *cobra.Command, args []string) error {
 	}
 
 	executionInput.Action = "plan"
+	executionInput.DetailedExitCode, err = cmd.Flags().GetBool("detailed-exitcode")
+	if err != nil {
+		return err
+	}
+	executionInput.ReportMarkdown, err = cmd.Flags().GetString("report-markdown")
+	if err != nil {
+		return err
+	}
 
-	if err := workspaces.ExecuteWorkspaceWithOutput(executionInput, cmd.InOrStdin(), cmd.OutOrStdout(), cmd.OutOrStderr()); err != nil {
+	if err := executeWithOutput(cmd, executionInput.Action, executionInput.Path, &executionInput.Subscribers, func(out io.Writer) (*plans.Summary, error) {
+		return workspaces.PlanWorkspaceWithOutput(executionInput, cmd.InOrStdin(), out, cmd.OutOrStderr())
+	}); err != nil {
+		var planChanges *workspaces.PlanChangesError
+		if errors.As(err, &planChanges) {
+			return err
+		}
 		logs.Logger.Errorw("failed to execute workspace",
 			"executionInput", executionInput,
 			"error", err)
@@ -186,10 +289,14 @@ func NewWorkspaceApplyCommand(in io.Reader, out, outErr io.Writer) *cobra.Comman
 	command := &cobra.Command{
 		Use:          "apply",
 		Short:        "Run terraform apply on workspace",
+		Args:         usageArgs(cobra.MaximumNArgs(1)),
 		RunE:         runWorkspaceApply,
 		SilenceUsage: true,
 	}
 	SetCommandBuffers(command, in, out, outErr)
+	command.Flags().Bool("print-input", false, "Print state machine input without starting execution")
+	command.Flags().String("plan-ref", "", "Reference of plan stored by remote plan, applied instead of planning again")
+	command.Flags().Bool("force-stale-plan", false, "Apply plan file even if it was produced from different commit or source")
 	return command
 }
 
@@ -203,29 +310,579 @@ func runWorkspaceApply(cmd *cobra.Command, args []string) error {
 	}
 
 	executionInput.Action = "apply"
+	executionInput.PlanRef, err = cmd.Flags().GetString("plan-ref")
+	if err != nil {
+		return err
+	}
+	executionInput.ForceStalePlan, err = cmd.Flags().GetBool("force-stale-plan")
+	if err != nil {
+		return err
+	}
+
+	if err := executeWithOutput(cmd, executionInput.Action, executionInput.Path, &executionInput.Subscribers, func(out io.Writer) (*plans.Summary, error) {
+		return nil, workspaces.ExecuteWorkspaceWithOutput(executionInput, cmd.InOrStdin(), out, cmd.OutOrStderr())
+	}); err != nil {
+		logs.Logger.Errorw("failed to execute workspace",
+			"executionInput", executionInput,
+			"error", err)
+		cmd.PrintErrf("failed to execute workspace")
+		return err
+	}
+	return nil
+}
+
+/*************************** DESTROY ***************************************/
+
+func NewWorkspaceDestroyCommand(in io.Reader, out, outErr io.Writer) *cobra.Command {
+	command := &cobra.Command{
+		Use:          "destroy",
+		Short:        "Run terraform destroy on workspace",
+		RunE:         runWorkspaceDestroy,
+		SilenceUsage: true,
+	}
+	SetCommandBuffers(command, in, out, outErr)
+	return command
+}
+
+func runWorkspaceDestroy(cmd *cobra.Command, args []string) error {
+	executionInput, err := getExecutionInput(cmd, args)
+	if err != nil {
+		logs.Logger.Errorw("error while accessing flags",
+			"error", err)
+		cmd.PrintErrf("invalid execution input")
+		return err
+	}
+
+	if _, err := destroyWorkspace(cmd, executionInput); err != nil {
+		return err
+	}
+	return nil
+}
+
+// destroyWorkspace asks for confirmation outside of CI and runs destroy
+// action. It reports whether destroy was executed successfully. Destroy
+// of protected workspace is refused before asking.
+func destroyWorkspace(cmd *cobra.Command, executionInput *workspaces.WorkspaceExecutionInput) (bool, error) {
+	executionInput.Action = "destroy"
+	executionInput.Arn = config.Configuration.GetString("destroy_sfn_arn")
+
+	if err := workspaces.CheckDestroyProtection(executionInput, cmd.OutOrStderr()); err != nil {
+		logs.Logger.Errorw("refused to destroy protected workspace",
+			"path", executionInput.Path,
+			"error", err)
+		cmd.PrintErrf("refused to destroy protected workspace")
+		return false, err
+	}
+	if !executionInput.IsCi {
+		confirmed, err := prompt.Confirm(cmd.InOrStdin(), cmd.OutOrStdout(),
+			fmt.Sprintf("destroy all resources in workspace %s?", executionInput.Path))
+		if err != nil {
+			logs.Logger.Errorw("failed to read confirmation",
+				"error", err)
+			cmd.PrintErrf("failed to read confirmation")
+			return false, err
+		}
+		if !confirmed {
+			cmd.Printf("destroy cancelled\n")
+			return false, nil
+		}
+	}
+	executionInput.AutoApprove = true
 
 	if err := workspaces.ExecuteWorkspaceWithOutput(executionInput, cmd.InOrStdin(), cmd.OutOrStdout(), cmd.OutOrStderr()); err != nil {
 		logs.Logger.Errorw("failed to execute workspace",
 			"executionInput", executionInput,
 			"error", err)
 		cmd.PrintErrf("failed to execute workspace")
+		return false, err
+	}
+	return true, nil
+}
+
+/*************************** DELETE ***************************************/
+
+func NewWorkspaceDeleteCommand(in io.Reader, out, outErr io.Writer) *cobra.Command {
+	command := &cobra.Command{
+		Use:          "delete",
+		Short:        "Removes terragrunt workspace and its CI workflow",
+		RunE:         runWorkspaceDelete,
+		SilenceUsage: true,
+	}
+	SetCommandBuffers(command, in, out, outErr)
+	command.Flags().String("ci-path", ".github/workflows", "Path to github action of the workspace")
+	command.Flags().Bool("dry-run", false, "List files which would be removed")
+	command.Flags().Bool("destroy", false, "Destroy workspace resources before removing it")
+	return command
+}
+
+func runWorkspaceDelete(cmd *cobra.Command, args []string) error {
+	executionInput, err := getExecutionInput(cmd, args)
+	if err != nil {
+		logs.Logger.Errorw("error while accessing flags",
+			"error", err)
+		cmd.PrintErrf("invalid execution input")
+		return err
+	}
+	ciPath, err := cmd.Flags().GetString("ci-path")
+	if err != nil {
+		return err
+	}
+	dryRun, err := cmd.Flags().GetBool("dry-run")
+	if err != nil {
+		return err
+	}
+	destroy, err := cmd.Flags().GetBool("destroy")
+	if err != nil {
+		return err
+	}
+	deleteInput := &workspaces.WorkspaceDeleteInput{
+		Path:         executionInput.Path,
+		CiPath:       ciPath,
+		LocalModules: executionInput.LocalModules,
+		DryRun:       dryRun,
+	}
+
+	if !dryRun {
+		destroyed := false
+		if destroy {
+			destroyed, err = destroyWorkspace(cmd, executionInput)
+			if err != nil {
+				return err
+			}
+			if !destroyed {
+				return nil
+			}
+		}
+		if !destroyed {
+			empty, err := workspaces.IsWorkspaceStateEmpty(deleteInput.Path, deleteInput.LocalModules, cmd.OutOrStderr())
+			if err != nil {
+				logs.Logger.Errorw("failed to list workspace state",
+					"error", err)
+				cmd.PrintErrf("failed to verify workspace state")
+				return err
+			}
+			if !empty {
+				cmd.PrintErrf("workspace %s still manages resources, run destroy first or use --destroy\n", deleteInput.Path)
+				return fmt.Errorf("workspace state is not empty")
+			}
+		}
+	}
+
+	if err := workspaces.DeleteWorkspace(deleteInput, cmd.OutOrStdout()); err != nil {
+		logs.Logger.Errorw("failed to delete workspace",
+			"error", err)
+		cmd.PrintErrf("failed to delete workspace")
+		return err
+	}
+	return nil
+}
+
+/*************************** REVERT ***************************************/
+
+func NewWorkspaceRevertCommand(in io.Reader, out, outErr io.Writer) *cobra.Command {
+	command := &cobra.Command{
+		Use:          "revert",
+		Short:        "Re-apply workspace at previous git revision",
+		PreRunE:      requireFlags("ref"),
+		RunE:         runWorkspaceRevert,
+		SilenceUsage: true,
+	}
+	SetCommandBuffers(command, in, out, outErr)
+	command.Flags().String("ref", "", "Git revision to revert workspace to")
+	return command
+}
+
+func runWorkspaceRevert(cmd *cobra.Command, args []string) error {
+	executionInput, err := getExecutionInput(cmd, args)
+	if err != nil {
+		logs.Logger.Errorw("error while accessing flags",
+			"error", err)
+		cmd.PrintErrf("invalid execution input")
+		return err
+	}
+	ref, err := cmd.Flags().GetString("ref")
+	if err != nil {
+		return err
+	}
+
+	revertInput := *executionInput
+	revertInput.Ref = ref
+	if executionInput.Local {
+		worktree, err := workspaces.NewRevisionWorktree(ref)
+		if err != nil {
+			logs.Logger.Errorw("failed to check out revision",
+				"ref", ref,
+				"error", err)
+			cmd.PrintErrf("failed to check out %s", ref)
+			return err
+		}
+		defer func() {
+			if err := worktree.Remove(); err != nil {
+				logs.Logger.Warnw("failed to remove worktree",
+					"path", worktree.Dir,
+					"error", err)
+			}
+		}()
+		localInput, err := workspaces.NewRevertExecutionInput(executionInput, worktree)
+		if err != nil {
+			logs.Logger.Errorw("failed to prepare revert input",
+				"error", err)
+			cmd.PrintErrf("invalid execution input")
+			return err
+		}
+		revertInput = *localInput
+	}
+
+	revertInput.Action = "plan"
+	revertInput.Arn = config.Configuration.GetString("plan_sfn_arn")
+	if err := workspaces.ExecuteWorkspaceWithOutput(&revertInput, cmd.InOrStdin(), cmd.OutOrStdout(), cmd.OutOrStderr()); err != nil {
+		logs.Logger.Errorw("failed to execute workspace",
+			"executionInput", revertInput,
+			"error", err)
+		cmd.PrintErrf("failed to execute workspace")
+		return err
+	}
+
+	if !revertInput.IsCi {
+		confirmed, err := prompt.Confirm(cmd.InOrStdin(), cmd.OutOrStdout(),
+			fmt.Sprintf("apply workspace %s at %s?", executionInput.Path, ref))
+		if err != nil {
+			logs.Logger.Errorw("failed to read confirmation",
+				"error", err)
+			cmd.PrintErrf("failed to read confirmation")
+			return err
+		}
+		if !confirmed {
+			cmd.Printf("revert cancelled\n")
+			return nil
+		}
+	}
+
+	revertInput.Action = "apply"
+	revertInput.Arn = config.Configuration.GetString("apply_sfn_arn")
+	if err := workspaces.ExecuteWorkspaceWithOutput(&revertInput, cmd.InOrStdin(), cmd.OutOrStdout(), cmd.OutOrStderr()); err != nil {
+		logs.Logger.Errorw("failed to execute workspace",
+			"executionInput", revertInput,
+			"error", err)
+		cmd.PrintErrf("failed to execute workspace")
 		return err
 	}
 	return nil
 }
 
+/*************************** POLICY ***************************************/
+
+func NewWorkspacePolicyCommand(in io.Reader, out, outErr io.Writer) *cobra.Command {
+	command := &cobra.Command{
+		Use:   "policy",
+		Short: "Evaluate policy rules against workspace plans",
+		Args:  usageArgs(cobra.NoArgs),
+		Run:   runHelp,
+	}
+	SetCommandBuffers(command, in, out, outErr)
+
+	command.AddCommand(NewWorkspacePolicyCheckCommand(in, out, outErr))
+	return command
+}
+
+func NewWorkspacePolicyCheckCommand(in io.Reader, out, outErr io.Writer) *cobra.Command {
+	command := &cobra.Command{
+		Use:          "check [plan file]",
+		Short:        "Check plan of workspace against policy file",
+		Args:         usageArgs(cobra.MaximumNArgs(1)),
+		RunE:         runWorkspacePolicyCheck,
+		SilenceUsage: true,
+	}
+	SetCommandBuffers(command, in, out, outErr)
+	command.Flags().String("plan-json", "", "Plan rendered by terraform show -json, instead of plan file")
+	return command
+}
+
+func runWorkspacePolicyCheck(cmd *cobra.Command, args []string) error {
+	planJsonPath, err := cmd.Flags().GetString("plan-json")
+	if err != nil {
+		return err
+	}
+	if (planJsonPath == "") == (len(args) == 0) {
+		cmd.PrintErrf("either plan file or --plan-json is required\n")
+		return &UsageError{Err: fmt.Errorf("either plan file or --plan-json is required")}
+	}
+	checkPolicy, err := getPolicy()
+	if err != nil {
+		logs.Logger.Errorw("failed to load policy",
+			"error", err)
+		cmd.PrintErrf("failed to load policy")
+		return &UsageError{Err: err}
+	}
+	if checkPolicy == nil {
+		cmd.PrintErrf("no policy file configured\n")
+		return &UsageError{Err: fmt.Errorf("no policy file configured, set policy_file or --policy-file")}
+	}
+
+	var planJson []byte
+	if planJsonPath != "" {
+		planJson, err = ioutil.ReadFile(planJsonPath)
+	} else {
+		executionInput := &workspaces.WorkspaceExecutionInput{
+			OutPlan: args[0],
+		}
+		executionInput.Path, err = cmd.Flags().GetString("path")
+		if err != nil {
+			return err
+		}
+		executionInput.LocalModules, err = cmd.Flags().GetString("source")
+		if err != nil {
+			return err
+		}
+		planJson, err = workspaces.ShowLocalPlan(executionInput, cmd.ErrOrStderr())
+	}
+	if err != nil {
+		logs.Logger.Errorw("failed to read plan",
+			"error", err)
+		cmd.PrintErrf("failed to read plan")
+		return err
+	}
+	plan, err := plans.ParsePlan(planJson)
+	if err != nil {
+		logs.Logger.Errorw("failed to parse plan",
+			"error", err)
+		cmd.PrintErrf("failed to parse plan")
+		return err
+	}
+	return policy.Check(cmd.OutOrStdout(), checkPolicy, plan)
+}
+
+/*************************** LIST ***************************************/
+
+func NewWorkspaceListCommand(in io.Reader, out, outErr io.Writer) *cobra.Command {
+	command := &cobra.Command{
+		Use:          "list",
+		Short:        "List workspaces found in the live tree",
+		RunE:         runWorkspaceList,
+		SilenceUsage: true,
+	}
+	SetCommandBuffers(command, in, out, outErr)
+	command.Flags().String("root", "live", "Directory searched for workspaces")
+	command.Flags().String("ci-path", ".github/workflows", "Path to github actions of workspaces")
+	return command
+}
+
+func runWorkspaceList(cmd *cobra.Command, args []string) error {
+	root, err := cmd.Flags().GetString("root")
+	if err != nil {
+		return err
+	}
+	ciPath, err := cmd.Flags().GetString("ci-path")
+	if err != nil {
+		return err
+	}
+	workspaceList, err := workspaces.ListWorkspaces(root, ciPath)
+	if err != nil {
+		logs.Logger.Errorw("failed to list workspaces",
+			"root", root,
+			"error", err)
+		cmd.PrintErrf("failed to list workspaces")
+		return err
+	}
+	return printWorkspaceList(cmd, workspaceList)
+}
+
+func printWorkspaceList(cmd *cobra.Command, workspaceList []*workspaces.Workspace) error {
+	switch format := config.Configuration.GetString("output"); format {
+	case reports.OutputText:
+		w := tabwriter.NewWriter(cmd.OutOrStdout(), 0, 4, 2, ' ', 0)
+		fmt.Fprintf(w, "PATH\tSOURCE\tREF\tCI\n")
+		for _, workspace := range workspaceList {
+			fmt.Fprintf(w, "%s\t%s\t%s\t%t\n",
+				workspace.Path,
+				valueOrDash(workspace.Source),
+				valueOrDash(workspace.Ref),
+				workspace.CiWorkflow)
+		}
+		return w.Flush()
+	case reports.OutputJson:
+		encoder := json.NewEncoder(cmd.OutOrStdout())
+		encoder.SetIndent("", "  ")
+		return encoder.Encode(workspaceList)
+	case reports.OutputNdjson:
+		encoder := json.NewEncoder(cmd.OutOrStdout())
+		for _, workspace := range workspaceList {
+			if err := encoder.Encode(workspace); err != nil {
+				return err
+			}
+		}
+		return nil
+	default:
+		return &UsageError{Err: fmt.Errorf("unsupported output format %q", format)}
+	}
+}
+
+func valueOrDash(value string) string {
+	if value == "" {
+		return "-"
+	}
+	return value
+}
+
+/*************************** CHANGED ***************************************/
+
+func NewWorkspaceChangedCommand(in io.Reader, out, outErr io.Writer) *cobra.Command {
+	command := &cobra.Command{
+		Use:          "changed",
+		Short:        "List workspaces affected by changes between git revisions",
+		RunE:         runWorkspaceChanged,
+		SilenceUsage: true,
+	}
+	SetCommandBuffers(command, in, out, outErr)
+	command.Flags().String("root", "live", "Directory searched for workspaces")
+	command.Flags().String("base", "", "Base git revision, defaults to origin/<default workspace prod branch>")
+	command.Flags().String("head", "HEAD", "Git revision compared with merge base of base revision")
+	return command
+}
+
+func getChangedWorkspaces(cmd *cobra.Command) ([]*workspaces.ChangedWorkspace, error) {
+	root, err := cmd.Flags().GetString("root")
+	if err != nil {
+		return nil, err
+	}
+	base, err := cmd.Flags().GetString("base")
+	if err != nil {
+		return nil, err
+	}
+	if base == "" {
+		base = "origin/" + config.Configuration.GetString("default_workspace_prod_branch")
+	}
+	head, err := cmd.Flags().GetString("head")
+	if err != nil {
+		return nil, err
+	}
+	changedFiles, repository, err := workspaces.ChangedFiles(base, head)
+	if err != nil {
+		return nil, err
+	}
+	return workspaces.ChangedWorkspaces(root, changedFiles, repository)
+}
+
+func runWorkspaceChanged(cmd *cobra.Command, args []string) error {
+	changed, err := getChangedWorkspaces(cmd)
+	if err != nil {
+		logs.Logger.Errorw("failed to detect changed workspaces",
+			"error", err)
+		cmd.PrintErrf("failed to detect changed workspaces")
+		return err
+	}
+
+	switch format := config.Configuration.GetString("output"); format {
+	case reports.OutputText:
+		// Paths only, so the list can be passed to other commands
+		for _, workspace := range changed {
+			cmd.Println(workspace.Path)
+		}
+		return nil
+	case reports.OutputJson:
+		encoder := json.NewEncoder(cmd.OutOrStdout())
+		encoder.SetIndent("", "  ")
+		return encoder.Encode(changed)
+	case reports.OutputNdjson:
+		encoder := json.NewEncoder(cmd.OutOrStdout())
+		for _, workspace := range changed {
+			if err := encoder.Encode(workspace); err != nil {
+				return err
+			}
+		}
+		return nil
+	default:
+		return &UsageError{Err: fmt.Errorf("unsupported output format %q", format)}
+	}
+}
+
+/*************************** GRAPH ***************************************/
+
+func NewWorkspaceGraphCommand(in io.Reader, out, outErr io.Writer) *cobra.Command {
+	command := &cobra.Command{
+		Use:          "graph",
+		Short:        "Print dependency graph of workspaces and modules in DOT or JSON format",
+		RunE:         runWorkspaceGraph,
+		SilenceUsage: true,
+	}
+	SetCommandBuffers(command, in, out, outErr)
+	command.Flags().String("root", "live", "Directory searched for workspaces")
+	command.Flags().StringArray("highlight", []string{}, "Path of workspace or module to highlight")
+	command.Flags().Bool("changed", false, "Highlight workspaces affected by changes between git revisions")
+	command.Flags().String("base", "", "Base git revision of --changed, defaults to origin/<default workspace prod branch>")
+	command.Flags().String("head", "HEAD", "Git revision of --changed compared with merge base of base revision")
+	return command
+}
+
+func runWorkspaceGraph(cmd *cobra.Command, args []string) error {
+	format := config.Configuration.GetString("output")
+	if format != reports.OutputText && format != reports.OutputJson {
+		cmd.PrintErrf("invalid graph input")
+		return &UsageError{Err: fmt.Errorf("unsupported output format %q, use text for DOT or json", format)}
+	}
+	root, err := cmd.Flags().GetString("root")
+	if err != nil {
+		return err
+	}
+	highlight, err := cmd.Flags().GetStringArray("highlight")
+	if err != nil {
+		return err
+	}
+	changed, err := cmd.Flags().GetBool("changed")
+	if err != nil {
+		return err
+	}
+
+	configs, err := workspaces.FindTerragruntConfigs(root)
+	if err != nil {
+		logs.Logger.Errorw("failed to list workspaces",
+			"root", root,
+			"error", err)
+		cmd.PrintErrf("failed to list workspaces")
+		return err
+	}
+	// Outside of git repository modules are resolved against current directory
+	repoRoot, err := workspaces.RepositoryRoot()
+	if err != nil {
+		repoRoot = "."
+	}
+	if changed {
+		changedWorkspaces, err := getChangedWorkspaces(cmd)
+		if err != nil {
+			logs.Logger.Errorw("failed to detect changed workspaces",
+				"error", err)
+			cmd.PrintErrf("failed to detect changed workspaces")
+			return err
+		}
+		for _, workspace := range changedWorkspaces {
+			highlight = append(highlight, workspace.Path)
+		}
+	}
+
+	graph := workspaces.NewWorkspaceGraph(configs, repoRoot)
+	for _, missing := range graph.Highlight(highlight) {
+		cmd.PrintErrf("%s is not part of the graph\n", missing)
+	}
+	if format == reports.OutputJson {
+		encoder := json.NewEncoder(cmd.OutOrStdout())
+		encoder.SetIndent("", "  ")
+		return encoder.Encode(graph)
+	}
+	return graph.WriteDot(cmd.OutOrStdout())
+}
+
 /*************************** CREATE ***************************************/
 
 func NewWorkspaceCreateCommand(in io.Reader, out, outErr io.Writer) *cobra.Command {
 	command := &cobra.Command{
-		Use:   "create",
-		Short: "Creates new terragrunt workspace",
-		RunE:  runWorkspaceCreate,
+		Use:     "create",
+		Short:   "Creates new terragrunt workspace",
+		PreRunE: requireFlags("path"),
+		RunE:    runWorkspaceCreate,
 	}
 	SetCommandBuffers(command, in, out, outErr)
 
 	command.Flags().String("path", "", "Full path to the workspace")
-	command.MarkFlagRequired("path") //nolint
 	command.Flags().String("branch", "main", "Branch to execute workspace action")
 	command.Flags().String("ci-path", ".github/workflows", "Path to create github action")
 	return command
@@ -270,49 +927,3 @@ func runWorkspaceCreate(cmd *cobra.Command, args []string) error {
 	}
 	return nil
 }
-
-/*************************** FF SFN_MONITOR ***************************************/
-
-func NewWorkspaceWithMontiorCommand(in io.Reader, out, outErr io.Writer) *cobra.Command {
-	command := &cobra.Command{
-		Use:          "workspace",
-		Short:        "Manage terraform workspace",
-		RunE:         workspaceMonitorPoC,
-		SilenceUsage: true,
-	}
-	SetCommandBuffers(command, in, out, outErr)
-	command.PersistentFlags().String("path", "", "Full path to the workspace")
-	command.MarkFlagRequired("path") //nolint
-
-	command.PersistentFlags().Bool("local", false, "Run action with localy")
-	command.PersistentFlags().String("source", "", "Full path to local modules")
-	command.Flags().String("branch", "main", "Branch to execute workspace action")
-	command.Flags().String("out", "", "Name of plan file to generate")
-	command.Flags().Bool("destroy", false, "Generate destroy plan")
-	command.Flags().Bool("no-refresh", false, "Disable state synchronization")
-	return command
-}
-
-func workspaceMonitorPoC(cmd *cobra.Command, args []string) error {
-	executionInput, err := getExecutionInput(cmd, args)
-	if err != nil {
-		logs.Logger.Errorw("error while accessing flags",
-			"error", err)
-		cmd.PrintErrf("invalid execution input")
-		return err
-	}
-
-	executionInput.Arn = config.Configuration.GetString("plan_sfn_arn")
-	executionInput.Action = "plan"
-
-	if err := workspaces.FFExecuteWorkspaceWithOutput(executionInput, cmd.InOrStdin(), cmd.OutOrStdout(), cmd.OutOrStderr()); err != nil {
-		logs.Logger.Errorw("failed to execute workspace",
-			"executionInput", executionInput,
-			"error", err)
-		cmd.PrintErrf("failed to execute workspace")
-		return err
-	}
-	return nil
-}
-
-/*************************** FF SFN_MONITOR - END  ***************************************/
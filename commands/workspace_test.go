@@ -0,0 +1,261 @@
+package commands_test
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/p0tr3c/terra-ci/commands"
+)
+
+const destroyQuestion = "destroy all resources in workspace live/prod/vpc? [y/N]: "
+
+// setupTerragrunt puts fake terragrunt exiting with exitCode on PATH. It
+// records its arguments, and its working directory followed by first line
+// of terragrunt.hcl found there. Paths of both recordings are returned.
+func setupTerragrunt(t *testing.T, exitCode int) (string, string) {
+	t.Helper()
+	dir := t.TempDir()
+	recordedArgs := filepath.Join(dir, "args")
+	recordedDirs := filepath.Join(dir, "dirs")
+	script := fmt.Sprintf("#!/bin/sh\necho \"$@\" >> %s\necho \"$(pwd) $(head -n 1 terragrunt.hcl)\" >> %s\nexit %d\n",
+		recordedArgs, recordedDirs, exitCode)
+	if err := ioutil.WriteFile(filepath.Join(dir, "terragrunt"), []byte(script), 0755); err != nil {
+		t.Fatalf("failed to write fake terragrunt: %s", err)
+	}
+	path := os.Getenv("PATH")
+	os.Setenv("PATH", dir+string(os.PathListSeparator)+path)
+	t.Cleanup(func() {
+		os.Setenv("PATH", path)
+	})
+	return recordedArgs, recordedDirs
+}
+
+func TestWorkspaceDestroy(t *testing.T) {
+	tests := []struct {
+		name      string
+		args      []string
+		answer    string
+		asked     bool
+		destroyed bool
+		code      int
+		output    string
+	}{
+		{name: "confirmed", answer: "y\n", asked: true, destroyed: true},
+		{name: "confirmed with yes", answer: "YES\n", asked: true, destroyed: true},
+		{name: "declined", answer: "n\n", asked: true, output: "destroy cancelled"},
+		{name: "no answer", answer: "", asked: true, output: "destroy cancelled"},
+		{name: "ci mode", args: []string{"--ci-mode"}, destroyed: true},
+		{name: "protected", args: []string{"--protected-paths", "live/prod/**"}, answer: "y\n", code: commands.ExitProtected},
+		{name: "protected in ci mode", args: []string{"--protected-paths", "live/prod/**", "--ci-mode"}, code: commands.ExitProtected},
+		{name: "protected other workspace confirmed", args: []string{"--protected-paths", "live/prod/**", "--i-understand-destroy", "live/prod/dns"}, answer: "y\n", code: commands.ExitUsage},
+		{name: "protected confirmed", args: []string{"--protected-paths", "live/prod/**", "--i-understand-destroy", "live/prod/vpc"}, answer: "y\n", asked: true, destroyed: true},
+		{name: "protected confirmed declined", args: []string{"--protected-paths", "live/prod/**", "--i-understand-destroy", "live/prod/vpc/"}, answer: "n\n", asked: true, output: "destroy cancelled"},
+	}
+	for _, tt := range tests {
+		for _, local := range []bool{false, true} {
+			name := tt.name
+			if local {
+				name += " local"
+			}
+			t.Run(name, func(t *testing.T) {
+				sfnClient := setupBatch(t, map[string]string{
+					"prod/vpc": `terraform { source = "../../../modules//vpc" }`,
+				})
+				recorded, _ := setupTerragrunt(t, 0)
+				os.Setenv("TERRA_CI_DESTROY_SFN_ARN", "arn:aws:states:eu-west-1:123:stateMachine:destroy")
+				defer os.Unsetenv("TERRA_CI_DESTROY_SFN_ARN")
+
+				var out, outErr bytes.Buffer
+				cmd := commands.NewTerraCICommand(strings.NewReader(tt.answer), &out, &outErr)
+				args := []string{"workspace", "destroy", "--path", "live/prod/vpc", "--refresh-rate", "0"}
+				if local {
+					args = append(args, "--local")
+				}
+				cmd.SetArgs(append(args, tt.args...))
+				err := cmd.Execute()
+
+				if code := commands.ExitCode(err); code != tt.code {
+					t.Fatalf("expected exit code %d, got %d: %v\n%s", tt.code, code, err, outErr.String())
+				}
+				if asked := strings.Contains(out.String(), destroyQuestion); asked != tt.asked {
+					t.Errorf("expected asked %t, got output\n%s", tt.asked, out.String())
+				}
+				if !strings.Contains(out.String(), tt.output) {
+					t.Errorf("expected output %q, got\n%s", tt.output, out.String())
+				}
+
+				terragruntArgs, _ := ioutil.ReadFile(recorded)
+				if !local {
+					if destroyed := len(sfnClient.Started) == 1; destroyed != tt.destroyed {
+						t.Fatalf("expected destroyed %t, started %d executions", tt.destroyed, len(sfnClient.Started))
+					}
+					if tt.destroyed {
+						if arn := *sfnClient.Started[0].StateMachineArn; !strings.HasSuffix(arn, ":destroy") {
+							t.Errorf("expected destroy state machine, got %s", arn)
+						}
+						if input := *sfnClient.Started[0].Input; !strings.Contains(input, `"action": "destroy"`) {
+							t.Errorf("expected destroy action, got %s", input)
+						}
+					}
+					if len(terragruntArgs) > 0 {
+						t.Errorf("expected remote destroy, terragrunt ran with %s", terragruntArgs)
+					}
+					return
+				}
+				if len(sfnClient.Started) != 0 {
+					t.Fatalf("expected local destroy, started %d executions", len(sfnClient.Started))
+				}
+				// Confirmed destroy is approved for terragrunt, which would
+				// otherwise ask again
+				expected := ""
+				if tt.destroyed {
+					expected = "destroy -auto-approve\n"
+				}
+				if string(terragruntArgs) != expected {
+					t.Errorf("expected terragrunt arguments %q, got %q", expected, terragruntArgs)
+				}
+			})
+		}
+	}
+}
+
+// commitAll commits the whole tree of repository in dir, initializing it
+// first if needed.
+func commitAll(t *testing.T, dir, message string) {
+	t.Helper()
+	for _, args := range [][]string{
+		{"init", "-q"},
+		{"add", "-A"},
+		{"-c", "user.name=test", "-c", "user.email=test@example.com", "-c", "commit.gpgsign=false", "commit", "-q", "-m", message},
+	} {
+		command := exec.Command("git", args...)
+		command.Dir = dir
+		if output, err := command.CombinedOutput(); err != nil {
+			t.Fatalf("git %s: %s: %s", strings.Join(args, " "), err, output)
+		}
+	}
+}
+
+func TestWorkspaceRevertLocal(t *testing.T) {
+	tests := []struct {
+		name     string
+		ref      string
+		answer   string
+		exitCode int
+		code     int
+		args     string
+		output   string
+	}{
+		{
+			name:   "confirmed",
+			ref:    "HEAD~1",
+			answer: "y\n",
+			args:   "plan -out terra-ci-revert.tfplan\napply terra-ci-revert.tfplan\n",
+			output: "apply workspace live/prod/vpc at HEAD~1? [y/N]: ",
+		},
+		{
+			name:   "declined",
+			ref:    "HEAD~1",
+			answer: "n\n",
+			args:   "plan -out terra-ci-revert.tfplan\n",
+			output: "revert cancelled",
+		},
+		{
+			name:     "plan failed",
+			ref:      "HEAD~1",
+			answer:   "y\n",
+			exitCode: 1,
+			code:     commands.ExitLocalCommand,
+			args:     "plan -out terra-ci-revert.tfplan\n",
+		},
+		{
+			name:   "unknown ref",
+			ref:    "unknown",
+			answer: "y\n",
+			code:   commands.ExitError,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			setupBatch(t, map[string]string{"prod/vpc": "# v1"})
+			wd, err := os.Getwd()
+			if err != nil {
+				t.Fatalf("failed to get current directory: %s", err)
+			}
+			commitAll(t, wd, "v1")
+			if err := ioutil.WriteFile(filepath.Join(wd, "live", "prod", "vpc", "terragrunt.hcl"), []byte("# v2"), 0644); err != nil {
+				t.Fatalf("failed to write config: %s", err)
+			}
+			commitAll(t, wd, "v2")
+			recordedArgs, recordedDirs := setupTerragrunt(t, tt.exitCode)
+			tmpDir := t.TempDir()
+			os.Setenv("TMPDIR", tmpDir)
+			defer os.Unsetenv("TMPDIR")
+
+			// Terragrunt shares input with the prompt, as it does when both
+			// read standard input of terra-ci
+			in, answer, err := os.Pipe()
+			if err != nil {
+				t.Fatalf("failed to create input: %s", err)
+			}
+			defer in.Close()
+			if _, err := answer.WriteString(tt.answer); err != nil {
+				t.Fatalf("failed to write answer: %s", err)
+			}
+			answer.Close()
+
+			var out, outErr bytes.Buffer
+			cmd := commands.NewTerraCICommand(in, &out, &outErr)
+			cmd.SetArgs([]string{"workspace", "revert", "--local", "--path", "live/prod/vpc", "--ref", tt.ref})
+			err = cmd.Execute()
+			if code := commands.ExitCode(err); code != tt.code {
+				t.Fatalf("expected exit code %d, got %d: %v\n%s", tt.code, code, err, outErr.String())
+			}
+			if !strings.Contains(out.String(), tt.output) {
+				t.Errorf("expected output %q, got\n%s", tt.output, out.String())
+			}
+
+			args, _ := ioutil.ReadFile(recordedArgs)
+			if string(args) != tt.args {
+				t.Errorf("expected terragrunt arguments %q, got %q", tt.args, args)
+			}
+			// Plan and apply run in the same worktree at the revision
+			dirs, _ := ioutil.ReadFile(recordedDirs)
+			for _, dir := range strings.Split(strings.TrimSpace(string(dirs)), "\n") {
+				if dir == "" {
+					continue
+				}
+				if !strings.HasPrefix(dir, tmpDir) || !strings.HasSuffix(dir, filepath.Join("live", "prod", "vpc")+" # v1") {
+					t.Errorf("expected terragrunt in worktree at revision, ran in %s", dir)
+				}
+				if first := strings.SplitN(string(dirs), "\n", 2)[0]; dir != first {
+					t.Errorf("expected plan and apply in the same worktree, ran in %s and %s", first, dir)
+				}
+			}
+
+			// Worktree is removed whether revert succeeded or not
+			command := exec.Command("git", "worktree", "list", "--porcelain")
+			command.Dir = wd
+			worktrees, err := command.Output()
+			if err != nil {
+				t.Fatalf("failed to list worktrees: %s", err)
+			}
+			if count := strings.Count(string(worktrees), "worktree "); count != 1 {
+				t.Errorf("expected only main worktree, got\n%s", worktrees)
+			}
+			entries, err := ioutil.ReadDir(tmpDir)
+			if err != nil {
+				t.Fatalf("failed to read %s: %s", tmpDir, err)
+			}
+			for _, entry := range entries {
+				t.Errorf("expected temporary directory to be removed, found %s", entry.Name())
+			}
+		})
+	}
+}
@@ -8,6 +8,9 @@ import (
 )
 
 var (
+	// Version is set at build time with -ldflags "-X github.com/p0tr3c/terra-ci/config.Version=..."
+	Version = "dev"
+
 	Configuration              *viper.Viper
 	ConfigFilePath             = "config.yaml"
 	LogLevel                   = "ERROR"
@@ -17,12 +20,21 @@ var (
 	StateMachineArn            = ""
 	PlanStateMachineArn        = ""
 	TestStateMachineArn        = ""
+	DestroyStateMachineArn     = ""
 	SfnExecutionTimeout        = 30
 	RefreshRate                = 15
 	CiMode                     = false
+	CiAbortOnInterrupt         = false
 	ExperimentalFlow           = false
 	RepositoryUrl              = ""
 	RepositoryName             = ""
+	CodebuildLogGroupFormat    = "/aws/codebuild/%s"
+	Output                     = "text"
+	ArtifactStore              = ""
+	PolicyFile                 = ""
+	ProtectedPaths             = []string{}
+	ProtectedMaxDestroy        = 0
+	ApiRateLimit               = 10
 )
 
 func init() {
@@ -40,12 +52,21 @@ func init() {
 	Configuration.SetDefault("state_machine_arn", StateMachineArn)
 	Configuration.SetDefault("sfn_execution_timeout", SfnExecutionTimeout)
 	Configuration.SetDefault("ci_mode", CiMode)
+	Configuration.SetDefault("ci_abort_on_interrupt", CiAbortOnInterrupt)
 	Configuration.SetDefault("refresh_rate", RefreshRate)
 	Configuration.SetDefault("experimental_flow", ExperimentalFlow)
 	Configuration.SetDefault("plan_sfn_arn", PlanStateMachineArn)
 	Configuration.SetDefault("test_sfn_arn", TestStateMachineArn)
+	Configuration.SetDefault("destroy_sfn_arn", DestroyStateMachineArn)
 	Configuration.SetDefault("repository_url", RepositoryUrl)
 	Configuration.SetDefault("repository_name", RepositoryName)
+	Configuration.SetDefault("codebuild_log_group_format", CodebuildLogGroupFormat)
+	Configuration.SetDefault("output", Output)
+	Configuration.SetDefault("artifact_store", ArtifactStore)
+	Configuration.SetDefault("policy_file", PolicyFile)
+	Configuration.SetDefault("protected_paths", ProtectedPaths)
+	Configuration.SetDefault("protected_max_destroy", ProtectedMaxDestroy)
+	Configuration.SetDefault("api_rate_limit", ApiRateLimit)
 }
 
 func AddConfigFlags(cmd *cobra.Command) {
@@ -65,6 +86,8 @@ func AddConfigFlags(cmd *cobra.Command) {
 	Configuration.BindPFlag("sfn_execution_timeout", cmd.PersistentFlags().Lookup("sfn-execution-timeout")) //nolint
 	cmd.PersistentFlags().BoolVarP(&CiMode, "ci-mode", "i", CiMode, "Determine if runs in CI. Disables spinners")
 	Configuration.BindPFlag("ci_mode", cmd.PersistentFlags().Lookup("ci-mode")) //nolint
+	cmd.PersistentFlags().BoolVarP(&CiAbortOnInterrupt, "ci-abort-on-interrupt", "", CiAbortOnInterrupt, "Abort remote execution when interrupted in CI mode")
+	Configuration.BindPFlag("ci_abort_on_interrupt", cmd.PersistentFlags().Lookup("ci-abort-on-interrupt")) //nolint
 	cmd.PersistentFlags().IntVarP(&RefreshRate, "refresh-rate", "r", RefreshRate, "Refresh rate of sfn execution status update")
 	Configuration.BindPFlag("refresh_rate", cmd.PersistentFlags().Lookup("refresh-rate")) //nolint
 	cmd.PersistentFlags().BoolVarP(&ExperimentalFlow, "experimental-flow", "e", ExperimentalFlow, "Use experimental code flow. Assume broken")
@@ -73,6 +96,18 @@ func AddConfigFlags(cmd *cobra.Command) {
 	Configuration.BindPFlag("repository_url", cmd.PersistentFlags().Lookup("repository-url")) //nolint
 	cmd.PersistentFlags().StringVarP(&RepositoryName, "repository-name", "", RepositoryName, "Name of repository")
 	Configuration.BindPFlag("repository_name", cmd.PersistentFlags().Lookup("repository-name")) //nolint
+	cmd.PersistentFlags().StringVarP(&Output, "output", "o", Output, "Output format of plan, apply and test: text, json or ndjson")
+	Configuration.BindPFlag("output", cmd.PersistentFlags().Lookup("output")) //nolint
+	cmd.PersistentFlags().StringVarP(&ArtifactStore, "artifact-store", "", ArtifactStore, "Location of plans handed over from remote plan to remote apply, s3://bucket/prefix or local directory")
+	Configuration.BindPFlag("artifact_store", cmd.PersistentFlags().Lookup("artifact-store")) //nolint
+	cmd.PersistentFlags().StringVarP(&PolicyFile, "policy-file", "", PolicyFile, "YAML policy evaluated against plans before apply")
+	Configuration.BindPFlag("policy_file", cmd.PersistentFlags().Lookup("policy-file")) //nolint
+	cmd.PersistentFlags().StringSliceVarP(&ProtectedPaths, "protected-paths", "", ProtectedPaths, "Glob patterns of workspaces protected from destroying resources, e.g. live/prod/**")
+	Configuration.BindPFlag("protected_paths", cmd.PersistentFlags().Lookup("protected-paths")) //nolint
+	cmd.PersistentFlags().IntVarP(&ProtectedMaxDestroy, "protected-max-destroy", "", ProtectedMaxDestroy, "Number of resources apply may delete in protected workspace")
+	Configuration.BindPFlag("protected_max_destroy", cmd.PersistentFlags().Lookup("protected-max-destroy")) //nolint
+	cmd.PersistentFlags().IntVarP(&ApiRateLimit, "api-rate-limit", "", ApiRateLimit, "Requests per second to SFN and CloudWatch APIs shared by parallel executions, 0 disables the limit")
+	Configuration.BindPFlag("api_rate_limit", cmd.PersistentFlags().Lookup("api-rate-limit")) //nolint
 }
 
 func LoadConfig(cmd *cobra.Command) error {
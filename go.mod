@@ -4,8 +4,10 @@ go 1.15
 
 require (
 	github.com/aws/aws-sdk-go v1.37.6
+	github.com/hashicorp/hcl/v2 v2.10.0
 	github.com/spf13/cobra v1.1.1
 	github.com/spf13/viper v1.7.0
+	github.com/zclconf/go-cty v1.8.0
 	go.uber.org/zap v1.10.0
 	gopkg.in/yaml.v2 v2.2.8
 )
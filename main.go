@@ -20,6 +20,10 @@ func main() {
 	defer logs.Flush()
 
 	if err := command.Execute(); err != nil {
-		os.Exit(1)
+		code := commands.ExitCode(err)
+		if code != commands.ExitPlanChanges {
+			command.PrintErrln("Error:", err.Error())
+		}
+		os.Exit(code)
 	}
 }
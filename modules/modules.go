@@ -25,6 +25,11 @@ type ModuleExecutionInput struct {
 	IsCi             bool
 	Local            bool
 	DisableCgo       bool
+	PrintInput       bool
+	AbortOnInterrupt bool
+	Confirm          aws.ConfirmFunc `json:"-"`
+	Client           *aws.Client
+	Subscribers      []aws.SfnEventSubscriber
 }
 
 func ExecuteLocalModuleWithOutput(executionInput *ModuleExecutionInput, in io.Reader, out, outErr io.Writer) error {
@@ -65,23 +70,33 @@ func ExecuteLocalModuleWithOutput(executionInput *ModuleExecutionInput, in io.Re
 	return nil
 }
 
-func ExecuteRemoteModuleWithOutput(executionInput *ModuleExecutionInput, out, outErr io.Writer) error {
-	executionArn, err := aws.StartStateMachine(executionInput.Path,
-		executionInput.Arn,
-		executionInput.Source,
-		executionInput.Location,
-		executionInput.Run,
-		executionInput.Action)
+func ExecuteRemoteModuleWithOutput(executionInput *ModuleExecutionInput, in io.Reader, out, outErr io.Writer) error {
+	inputParams := &aws.SfnInputParameters{
+		Resource:       executionInput.Path,
+		Action:         executionInput.Action,
+		RepositoryUrl:  executionInput.Source,
+		RepositoryName: executionInput.Location,
+		Run:            executionInput.Run,
+		Branch:         executionInput.Branch,
+		TestTimeout:    executionInput.TestTimeout,
+		DisableCgo:     executionInput.DisableCgo,
+	}
+	if executionInput.PrintInput {
+		return aws.PrintStateMachineInput(inputParams, out)
+	}
+	executionArn, err := executionInput.Client.StartStateMachine(executionInput.Arn, inputParams)
 	if err != nil {
 		return err
 	}
 
 	fmt.Fprintf(out, "execution %s started\n", executionArn)
 
-	err = aws.MonitorStateMachineStatus(executionArn,
+	err = executionInput.Client.MonitorStateMachineStatus(executionArn,
 		executionInput.RefreshRate,
 		executionInput.ExecutionTimeout,
-		executionInput.IsCi, out, outErr)
+		executionInput.IsCi,
+		executionInput.AbortOnInterrupt, executionInput.Confirm, out, outErr,
+		executionInput.Subscribers...)
 	if err != nil {
 		return err
 	}
@@ -89,12 +104,15 @@ func ExecuteRemoteModuleWithOutput(executionInput *ModuleExecutionInput, out, ou
 }
 
 func ExecuteModuleWithOutput(executionInput *ModuleExecutionInput, in io.Reader, out, outErr io.Writer) error {
+	if executionInput.Local && executionInput.PrintInput {
+		return fmt.Errorf("--print-input is only supported for remote execution")
+	}
 	if executionInput.Local {
 		if err := ExecuteLocalModuleWithOutput(executionInput, in, out, outErr); err != nil {
 			return err
 		}
 	} else {
-		if err := ExecuteRemoteModuleWithOutput(executionInput, out, outErr); err != nil {
+		if err := ExecuteRemoteModuleWithOutput(executionInput, in, out, outErr); err != nil {
 			return err
 		}
 	}
@@ -0,0 +1,168 @@
+package plans
+
+import (
+	"encoding/json"
+	"fmt"
+	"html"
+	"io"
+	"sort"
+	"strings"
+)
+
+var (
+	markdownSections = []struct {
+		Action string
+		Title  string
+	}{
+		{ActionCreate, "Create"},
+		{ActionUpdate, "Update"},
+		{ActionReplace, "Replace"},
+		{ActionDelete, "Destroy"},
+	}
+)
+
+// MarkdownReport describes plan rendered by RenderMarkdown.
+type MarkdownReport struct {
+	Path         string
+	ExecutionArn string
+	ExecutionUrl string
+	Plan         *Plan
+}
+
+// RenderMarkdown writes GitHub flavoured markdown report of the plan,
+// suitable for pull request comments.
+func RenderMarkdown(out io.Writer, report *MarkdownReport) error {
+	summary := report.Plan.Summary()
+	var b strings.Builder
+	fmt.Fprintf(&b, "## terra-ci plan: %s\n\n", codeSpan(report.Path))
+	fmt.Fprintf(&b, "**%s**\n\n", summary.String())
+	if report.ExecutionUrl != "" {
+		fmt.Fprintf(&b, "Execution: [%s](%s)\n\n", codeSpan(report.ExecutionArn), report.ExecutionUrl)
+	}
+
+	for _, section := range markdownSections {
+		resources := []*ResourceChange{}
+		for _, resource := range report.Plan.ResourceChanges {
+			if resource.Change.Action() == section.Action {
+				resources = append(resources, resource)
+			}
+		}
+		if len(resources) == 0 {
+			continue
+		}
+		fmt.Fprintf(&b, "### %s (%d)\n\n", section.Title, len(resources))
+		for _, resource := range resources {
+			renderResource(&b, resource)
+		}
+	}
+
+	if len(report.Plan.ResourceDrift) > 0 {
+		fmt.Fprintf(&b, "### Drift\n\n")
+		fmt.Fprintf(&b, "> Objects below were changed outside of Terraform since the last apply.\n\n")
+		for _, resource := range report.Plan.ResourceDrift {
+			fmt.Fprintf(&b, "- %s (%s)\n", codeSpan(resource.Address), resource.Change.Action())
+		}
+		fmt.Fprintf(&b, "\n")
+	}
+
+	_, err := io.WriteString(out, b.String())
+	return err
+}
+
+func renderResource(b *strings.Builder, resource *ResourceChange) {
+	fmt.Fprintf(b, "<details><summary><code>%s</code></summary>\n\n", html.EscapeString(resource.Address))
+	lines := diffAttributes(&resource.Change)
+	fence := codeFence(strings.Join(lines, "\n"), 3)
+	fmt.Fprintf(b, "%sdiff\n", fence)
+	for _, line := range lines {
+		fmt.Fprintf(b, "%s\n", line)
+	}
+	fmt.Fprintf(b, "%s\n\n</details>\n\n", fence)
+}
+
+// codeFence returns run of backticks longer than any run in content, and
+// at least minimum long, so content can not close the code.
+func codeFence(content string, minimum int) string {
+	longest, run := 0, 0
+	for _, c := range content {
+		if c == '`' {
+			run++
+			if run > longest {
+				longest = run
+			}
+		} else {
+			run = 0
+		}
+	}
+	if longest+1 > minimum {
+		minimum = longest + 1
+	}
+	return strings.Repeat("`", minimum)
+}
+
+// codeSpan returns text as inline code, delimited by backticks which do
+// not occur in the text.
+func codeSpan(text string) string {
+	fence := codeFence(text, 1)
+	if strings.HasPrefix(text, "`") || strings.HasSuffix(text, "`") {
+		text = " " + text + " "
+	}
+	return fence + text + fence
+}
+
+// diffAttributes returns diff lines of top level attributes which differ
+// between before and after state of the resource.
+func diffAttributes(change *Change) []string {
+	before, _ := change.Before.(map[string]interface{})
+	after, _ := change.After.(map[string]interface{})
+	unknown, _ := change.AfterUnknown.(map[string]interface{})
+
+	keys := map[string]bool{}
+	for key := range before {
+		keys[key] = true
+	}
+	for key := range after {
+		keys[key] = true
+	}
+	for key, value := range unknown {
+		if value == true {
+			keys[key] = true
+		}
+	}
+	sortedKeys := []string{}
+	for key := range keys {
+		sortedKeys = append(sortedKeys, key)
+	}
+	sort.Strings(sortedKeys)
+
+	lines := []string{}
+	for _, key := range sortedKeys {
+		beforeValue, inBefore := before[key]
+		afterValue, inAfter := after[key]
+		if unknown[key] == true {
+			afterValue, inAfter = UnknownValue, true
+		}
+		oldValue, newValue := formatValue(beforeValue), formatValue(afterValue)
+		if inBefore && inAfter && oldValue == newValue {
+			continue
+		}
+		if inBefore && beforeValue != nil {
+			lines = append(lines, fmt.Sprintf("- %s = %s", key, oldValue))
+		}
+		if inAfter && afterValue != nil {
+			lines = append(lines, fmt.Sprintf("+ %s = %s", key, newValue))
+		}
+	}
+	return lines
+}
+
+func formatValue(value interface{}) string {
+	if s, ok := value.(string); ok && (s == SensitiveValue || s == UnknownValue) {
+		return s
+	}
+	data, err := json.Marshal(value)
+	if err != nil {
+		return fmt.Sprintf("%v", value)
+	}
+	return string(data)
+}
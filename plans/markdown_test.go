@@ -0,0 +1,85 @@
+package plans
+
+import (
+	"bytes"
+	"flag"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+var update = flag.Bool("update", false, "update golden files")
+
+func TestRenderMarkdown(t *testing.T) {
+	tests := []struct {
+		name   string
+		report *MarkdownReport
+		plan   string
+	}{
+		{
+			name: "changes",
+			report: &MarkdownReport{
+				Path:         "live/prod/vpc",
+				ExecutionArn: "arn:aws:states:eu-west-1:123:execution:plan:abc",
+				ExecutionUrl: "https://console.aws.amazon.com/states/home?region=eu-west-1#/executions/details/arn:aws:states:eu-west-1:123:execution:plan:abc",
+			},
+			plan: `{
+  "resource_changes": [
+    {"address": "aws_vpc.main", "change": {"actions": ["create"], "before": null, "after": {"cidr_block": "10.0.0.0/16", "tags": {"Name": "main"}}, "after_unknown": {"id": true}}},
+    {"address": "aws_subnet.a", "change": {"actions": ["update"], "before": {"cidr_block": "10.0.1.0/24", "map_public_ip_on_launch": false}, "after": {"cidr_block": "10.0.1.0/24", "map_public_ip_on_launch": true}}},
+    {"address": "aws_db_instance.main", "change": {"actions": ["delete", "create"], "before": {"password": "old", "engine_version": "13"}, "after": {"password": "new", "engine_version": "14"}, "before_sensitive": {"password": true}, "after_sensitive": {"password": true}}},
+    {"address": "aws_instance.old", "change": {"actions": ["delete"], "before": {"ami": "ami-1"}, "after": null}},
+    {"address": "aws_s3_bucket.logs", "change": {"actions": ["no-op"], "before": {}, "after": {}}}
+  ],
+  "resource_drift": [
+    {"address": "aws_security_group.web", "change": {"actions": ["update"]}}
+  ]
+}`,
+		},
+		{
+			name:   "no changes",
+			report: &MarkdownReport{Path: "live/prod/dns"},
+			plan:   `{"resource_changes": []}`,
+		},
+		{
+			name:   "quoting",
+			report: &MarkdownReport{Path: "live/`prod`"},
+			plan: `{
+  "resource_changes": [
+    {"address": "aws_instance.web[\"<script>alert(1)</script>\"]", "change": {"actions": ["create"], "after": {"user_data": "` + "```" + `\n</details>\n<img src=x>", "name": "a` + "````" + `b"}}}
+  ],
+  "resource_drift": [
+    {"address": "aws_instance.x[\"` + "``" + `\"]", "change": {"actions": ["delete"]}}
+  ]
+}`,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			plan, err := ParsePlan([]byte(tt.plan))
+			if err != nil {
+				t.Fatalf("failed to parse plan: %s", err)
+			}
+			tt.report.Plan = plan
+			var out bytes.Buffer
+			if err := RenderMarkdown(&out, tt.report); err != nil {
+				t.Fatalf("unexpected error: %s", err)
+			}
+
+			golden := filepath.Join("testdata", "markdown-"+strings.Replace(tt.name, " ", "-", -1)+".golden")
+			if *update {
+				if err := ioutil.WriteFile(golden, out.Bytes(), 0644); err != nil {
+					t.Fatalf("failed to update %s: %s", golden, err)
+				}
+			}
+			expected, err := ioutil.ReadFile(golden)
+			if err != nil {
+				t.Fatalf("failed to read %s: %s", golden, err)
+			}
+			if !bytes.Equal(out.Bytes(), expected) {
+				t.Fatalf("output does not match %s, expected\n%s\ngot\n%s", golden, expected, out.String())
+			}
+		})
+	}
+}
@@ -0,0 +1,177 @@
+package plans
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"text/tabwriter"
+)
+
+const (
+	ActionNoop    = "no-op"
+	ActionCreate  = "create"
+	ActionRead    = "read"
+	ActionUpdate  = "update"
+	ActionDelete  = "delete"
+	ActionReplace = "replace"
+
+	// SensitiveValue replaces values marked as sensitive in the plan
+	SensitiveValue = "(sensitive)"
+	// UnknownValue replaces values which are known only after apply
+	UnknownValue = "(known after apply)"
+)
+
+// Plan is subset of terraform plan representation produced by
+// terraform show -json.
+type Plan struct {
+	FormatVersion    string            `json:"format_version"`
+	TerraformVersion string            `json:"terraform_version"`
+	ResourceChanges  []*ResourceChange `json:"resource_changes"`
+	ResourceDrift    []*ResourceChange `json:"resource_drift"`
+}
+
+type ResourceChange struct {
+	Address       string `json:"address"`
+	ModuleAddress string `json:"module_address"`
+	Mode          string `json:"mode"`
+	Type          string `json:"type"`
+	Name          string `json:"name"`
+	Change        Change `json:"change"`
+}
+
+type Change struct {
+	Actions         []string    `json:"actions"`
+	Before          interface{} `json:"before"`
+	After           interface{} `json:"after"`
+	AfterUnknown    interface{} `json:"after_unknown"`
+	BeforeSensitive interface{} `json:"before_sensitive"`
+	AfterSensitive  interface{} `json:"after_sensitive"`
+}
+
+// Action returns single action of the change, create and delete pair is
+// reported as replace.
+func (c *Change) Action() string {
+	switch len(c.Actions) {
+	case 0:
+		return ActionNoop
+	case 1:
+		return c.Actions[0]
+	}
+	return ActionReplace
+}
+
+// ParsePlan parses output of terraform show -json. Values marked as
+// sensitive are masked, so they never leave the parser.
+func ParsePlan(data []byte) (*Plan, error) {
+	var plan Plan
+	if err := json.Unmarshal(data, &plan); err != nil {
+		return nil, fmt.Errorf("failed to parse plan: %s", err.Error())
+	}
+	for _, changes := range [][]*ResourceChange{plan.ResourceChanges, plan.ResourceDrift} {
+		for _, resource := range changes {
+			resource.Change.Before = maskSensitive(resource.Change.Before, resource.Change.BeforeSensitive)
+			resource.Change.After = maskSensitive(resource.Change.After, resource.Change.AfterSensitive)
+		}
+	}
+	return &plan, nil
+}
+
+// maskSensitive replaces parts of value marked in sensitive. Sensitive
+// marks mirror structure of the value, with true on masked elements.
+func maskSensitive(value, sensitive interface{}) interface{} {
+	switch marks := sensitive.(type) {
+	case bool:
+		if marks && value != nil {
+			return SensitiveValue
+		}
+	case map[string]interface{}:
+		if object, ok := value.(map[string]interface{}); ok {
+			for key, mark := range marks {
+				if element, ok := object[key]; ok {
+					object[key] = maskSensitive(element, mark)
+				}
+			}
+		}
+	case []interface{}:
+		if list, ok := value.([]interface{}); ok {
+			for i := range marks {
+				if i < len(list) {
+					list[i] = maskSensitive(list[i], marks[i])
+				}
+			}
+		}
+	}
+	return value
+}
+
+type ResourceSummary struct {
+	Address string `json:"address"`
+	Action  string `json:"action"`
+}
+
+// Summary counts planned changes the way terraform does, replaced
+// resources are counted both as added and destroyed.
+type Summary struct {
+	Add       int                `json:"add"`
+	Change    int                `json:"change"`
+	Destroy   int                `json:"destroy"`
+	Replace   int                `json:"replace"`
+	Resources []*ResourceSummary `json:"resources"`
+	// Ref references stored binary plan, which can be applied remotely
+	Ref string `json:"ref,omitempty"`
+}
+
+func (p *Plan) Summary() *Summary {
+	summary := &Summary{
+		Resources: []*ResourceSummary{},
+	}
+	for _, resource := range p.ResourceChanges {
+		action := resource.Change.Action()
+		switch action {
+		case ActionCreate:
+			summary.Add++
+		case ActionUpdate:
+			summary.Change++
+		case ActionDelete:
+			summary.Destroy++
+		case ActionReplace:
+			summary.Add++
+			summary.Destroy++
+			summary.Replace++
+		default:
+			continue
+		}
+		summary.Resources = append(summary.Resources, &ResourceSummary{
+			Address: resource.Address,
+			Action:  action,
+		})
+	}
+	return summary
+}
+
+func (s *Summary) HasChanges() bool {
+	return len(s.Resources) > 0
+}
+
+func (s *Summary) String() string {
+	if !s.HasChanges() {
+		return "No changes."
+	}
+	return fmt.Sprintf("Plan: %d to add, %d to change, %d to destroy.", s.Add, s.Change, s.Destroy)
+}
+
+// PrintSummary prints table of changed resources followed by totals.
+func PrintSummary(out io.Writer, summary *Summary) error {
+	if summary.HasChanges() {
+		w := tabwriter.NewWriter(out, 0, 4, 2, ' ', 0)
+		fmt.Fprintf(w, "ACTION\tADDRESS\n")
+		for _, resource := range summary.Resources {
+			fmt.Fprintf(w, "%s\t%s\n", resource.Action, resource.Address)
+		}
+		if err := w.Flush(); err != nil {
+			return err
+		}
+	}
+	fmt.Fprintf(out, "%s\n", summary.String())
+	return nil
+}
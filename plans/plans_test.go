@@ -0,0 +1,139 @@
+package plans
+
+import (
+	"bytes"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestParsePlanMasksSensitiveValues(t *testing.T) {
+	tests := []struct {
+		name    string
+		change  string
+		before  interface{}
+		after   interface{}
+		secrets []string
+	}{
+		{
+			name:    "top level attributes",
+			change:  `{"actions": ["update"], "before": {"password": "old", "name": "db"}, "after": {"password": "new", "name": "db"}, "before_sensitive": {"password": true}, "after_sensitive": {"password": true}}`,
+			before:  map[string]interface{}{"password": SensitiveValue, "name": "db"},
+			after:   map[string]interface{}{"password": SensitiveValue, "name": "db"},
+			secrets: []string{`"old"`, `"new"`},
+		},
+		{
+			name:    "only after sensitive",
+			change:  `{"actions": ["update"], "before": {"token": "a"}, "after": {"token": "b"}, "before_sensitive": {}, "after_sensitive": {"token": true}}`,
+			before:  map[string]interface{}{"token": "a"},
+			after:   map[string]interface{}{"token": SensitiveValue},
+			secrets: []string{`"b"`},
+		},
+		{
+			name:   "nested objects and lists",
+			change: `{"actions": ["create"], "after": {"settings": {"secret": "s", "region": "eu"}, "users": [{"name": "a", "key": "k1"}, {"name": "b", "key": "k2"}], "keys": ["k", "l"]}, "after_sensitive": {"settings": {"secret": true}, "users": [{"key": true}, {"key": true}], "keys": [false, true]}}`,
+			after: map[string]interface{}{
+				"settings": map[string]interface{}{"secret": SensitiveValue, "region": "eu"},
+				"users": []interface{}{
+					map[string]interface{}{"name": "a", "key": SensitiveValue},
+					map[string]interface{}{"name": "b", "key": SensitiveValue},
+				},
+				"keys": []interface{}{"k", SensitiveValue},
+			},
+			secrets: []string{`"s"`, `"k1"`, `"k2"`, `"l"`},
+		},
+		{
+			name:    "whole value",
+			change:  `{"actions": ["delete"], "before": {"value": "secret"}, "after": null, "before_sensitive": true, "after_sensitive": true}`,
+			before:  SensitiveValue,
+			secrets: []string{`"secret"`},
+		},
+		{
+			name:   "null values are kept",
+			change: `{"actions": ["update"], "before": {"password": null}, "after": {"password": "new"}, "before_sensitive": {"password": true}, "after_sensitive": {"password": true}}`,
+			before: map[string]interface{}{"password": nil},
+			after:  map[string]interface{}{"password": SensitiveValue},
+		},
+		{
+			name:   "marks of missing attributes",
+			change: `{"actions": ["create"], "after": {"name": "a"}, "after_sensitive": {"password": true, "list": [true]}}`,
+			after:  map[string]interface{}{"name": "a"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			data := `{"resource_changes": [{"address": "a.b", "change": ` + tt.change + `}], "resource_drift": [{"address": "a.b", "change": ` + tt.change + `}]}`
+			plan, err := ParsePlan([]byte(data))
+			if err != nil {
+				t.Fatalf("unexpected error: %s", err)
+			}
+			for _, change := range []Change{plan.ResourceChanges[0].Change, plan.ResourceDrift[0].Change} {
+				if !reflect.DeepEqual(change.Before, tt.before) {
+					t.Errorf("expected before %#v, got %#v", tt.before, change.Before)
+				}
+				if !reflect.DeepEqual(change.After, tt.after) {
+					t.Errorf("expected after %#v, got %#v", tt.after, change.After)
+				}
+			}
+			var out bytes.Buffer
+			if err := RenderMarkdown(&out, &MarkdownReport{Path: "w", Plan: plan}); err != nil {
+				t.Fatalf("unexpected error: %s", err)
+			}
+			for _, secret := range tt.secrets {
+				if strings.Contains(out.String(), secret) {
+					t.Errorf("sensitive value %s leaked into report:\n%s", secret, out.String())
+				}
+			}
+		})
+	}
+
+	if _, err := ParsePlan([]byte(`{"resource_changes": {}`)); err == nil || !strings.Contains(err.Error(), "failed to parse plan") {
+		t.Fatalf("expected invalid plan to be rejected, got %v", err)
+	}
+}
+
+func TestSummary(t *testing.T) {
+	plan, err := ParsePlan([]byte(`{"resource_changes": [
+		{"address": "a.create", "change": {"actions": ["create"]}},
+		{"address": "a.update", "change": {"actions": ["update"]}},
+		{"address": "a.delete", "change": {"actions": ["delete"]}},
+		{"address": "a.replace", "change": {"actions": ["delete", "create"]}},
+		{"address": "a.replace_before", "change": {"actions": ["create", "delete"]}},
+		{"address": "a.noop", "change": {"actions": ["no-op"]}},
+		{"address": "data.a.read", "change": {"actions": ["read"]}}
+	]}`))
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	summary := plan.Summary()
+	if summary.Add != 3 || summary.Change != 1 || summary.Destroy != 3 || summary.Replace != 2 {
+		t.Fatalf("unexpected counts %+v", summary)
+	}
+	expected := []*ResourceSummary{
+		{Address: "a.create", Action: ActionCreate},
+		{Address: "a.update", Action: ActionUpdate},
+		{Address: "a.delete", Action: ActionDelete},
+		{Address: "a.replace", Action: ActionReplace},
+		{Address: "a.replace_before", Action: ActionReplace},
+	}
+	if !reflect.DeepEqual(summary.Resources, expected) {
+		t.Fatalf("unexpected resources %+v", summary.Resources)
+	}
+	if !summary.HasChanges() || summary.String() != "Plan: 3 to add, 1 to change, 3 to destroy." {
+		t.Fatalf("unexpected summary %s", summary)
+	}
+
+	var out bytes.Buffer
+	if err := PrintSummary(&out, summary); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if !strings.Contains(out.String(), "replace  a.replace\n") || !strings.HasSuffix(out.String(), "Plan: 3 to add, 1 to change, 3 to destroy.\n") {
+		t.Fatalf("unexpected summary output\n%s", out.String())
+	}
+
+	empty := (&Plan{ResourceChanges: []*ResourceChange{{Address: "a.noop", Change: Change{Actions: []string{"no-op"}}}}}).Summary()
+	out.Reset()
+	if empty.HasChanges() || PrintSummary(&out, empty) != nil || out.String() != "No changes.\n" {
+		t.Fatalf("expected no changes, got %q", out.String())
+	}
+}
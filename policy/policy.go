@@ -0,0 +1,239 @@
+package policy
+
+import (
+	"fmt"
+	"io"
+	"io/ioutil"
+	"text/tabwriter"
+
+	"github.com/p0tr3c/terra-ci/plans"
+
+	"gopkg.in/yaml.v2"
+)
+
+const (
+	LevelDeny = "deny"
+	LevelWarn = "warn"
+
+	RuleNoDelete      = "no_delete"
+	RuleRequireTags   = "require_tags"
+	RuleNoPublicS3Acl = "no_public_s3_acl"
+	RuleMaxDestroy    = "max_destroy"
+)
+
+var (
+	publicS3Acls = map[string]bool{
+		"public-read":        true,
+		"public-read-write":  true,
+		"authenticated-read": true,
+	}
+	s3AclResourceTypes = map[string]bool{
+		"aws_s3_bucket":     true,
+		"aws_s3_bucket_acl": true,
+	}
+)
+
+// Rule is single guardrail evaluated against the plan. ResourceTypes
+// limits no_delete and require_tags rules to given resource types.
+type Rule struct {
+	Name          string   `yaml:"name"`
+	Level         string   `yaml:"level"`
+	Type          string   `yaml:"type"`
+	ResourceTypes []string `yaml:"resource_types"`
+	Tags          []string `yaml:"tags"`
+	Max           int      `yaml:"max"`
+}
+
+type Policy struct {
+	Rules []*Rule `yaml:"rules"`
+}
+
+type Violation struct {
+	Rule    string `json:"rule"`
+	Level   string `json:"level"`
+	Address string `json:"address"`
+	Message string `json:"message"`
+}
+
+// LoadPolicy reads and validates YAML policy file.
+func LoadPolicy(path string) (*Policy, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var policy Policy
+	if err := yaml.UnmarshalStrict(data, &policy); err != nil {
+		return nil, fmt.Errorf("failed to parse policy %s: %s", path, err.Error())
+	}
+	for i, rule := range policy.Rules {
+		if rule.Name == "" {
+			rule.Name = fmt.Sprintf("rule-%d", i+1)
+		}
+		switch rule.Level {
+		case LevelDeny, LevelWarn:
+		default:
+			return nil, fmt.Errorf("rule %s has invalid level %q, expected deny or warn", rule.Name, rule.Level)
+		}
+		switch rule.Type {
+		case RuleNoDelete, RuleNoPublicS3Acl:
+		case RuleRequireTags:
+			if len(rule.Tags) == 0 {
+				return nil, fmt.Errorf("rule %s requires tags", rule.Name)
+			}
+		case RuleMaxDestroy:
+			if rule.Max < 0 {
+				return nil, fmt.Errorf("rule %s requires non-negative max", rule.Name)
+			}
+		default:
+			return nil, fmt.Errorf("rule %s has unknown type %q", rule.Name, rule.Type)
+		}
+	}
+	return &policy, nil
+}
+
+func (r *Rule) appliesTo(resourceType string) bool {
+	if len(r.ResourceTypes) == 0 {
+		return true
+	}
+	for _, t := range r.ResourceTypes {
+		if t == resourceType {
+			return true
+		}
+	}
+	return false
+}
+
+func (r *Rule) violation(address, format string, args ...interface{}) *Violation {
+	return &Violation{
+		Rule:    r.Name,
+		Level:   r.Level,
+		Address: address,
+		Message: fmt.Sprintf(format, args...),
+	}
+}
+
+// Evaluate returns violations of all rules by managed resources changed
+// in the plan.
+func (p *Policy) Evaluate(plan *plans.Plan) []*Violation {
+	violations := []*Violation{}
+	for _, rule := range p.Rules {
+		if rule.Type == RuleMaxDestroy {
+			if destroyed := plan.Summary().Destroy; destroyed > rule.Max {
+				violations = append(violations, rule.violation("", "plan destroys %d resources, at most %d allowed", destroyed, rule.Max))
+			}
+			continue
+		}
+		for _, resource := range plan.ResourceChanges {
+			if resource.Mode == "data" || !rule.appliesTo(resource.Type) {
+				continue
+			}
+			if violation := rule.evaluateResource(resource); violation != nil {
+				violations = append(violations, violation)
+			}
+		}
+	}
+	return violations
+}
+
+func (r *Rule) evaluateResource(resource *plans.ResourceChange) *Violation {
+	action := resource.Change.Action()
+	after, _ := resource.Change.After.(map[string]interface{})
+	switch r.Type {
+	case RuleNoDelete:
+		if action == plans.ActionDelete || action == plans.ActionReplace {
+			return r.violation(resource.Address, "%s is not allowed", action)
+		}
+	case RuleRequireTags:
+		if action != plans.ActionCreate && action != plans.ActionUpdate && action != plans.ActionReplace {
+			return nil
+		}
+		// Resources which do not support tags are skipped. Tags set with
+		// provider default_tags are only part of tags_all.
+		tags, hasTags := after["tags"]
+		tagsAll, hasTagsAll := after["tags_all"]
+		if !hasTags && !hasTagsAll {
+			return nil
+		}
+		tagMap, _ := tags.(map[string]interface{})
+		tagsAllMap, _ := tagsAll.(map[string]interface{})
+		missing := []string{}
+		for _, tag := range r.Tags {
+			_, tagged := tagMap[tag]
+			_, taggedAll := tagsAllMap[tag]
+			if !tagged && !taggedAll {
+				missing = append(missing, tag)
+			}
+		}
+		if len(missing) > 0 {
+			return r.violation(resource.Address, "missing required tags %v", missing)
+		}
+	case RuleNoPublicS3Acl:
+		if !s3AclResourceTypes[resource.Type] || after == nil {
+			return nil
+		}
+		if acl, ok := after["acl"].(string); ok && publicS3Acls[acl] {
+			return r.violation(resource.Address, "public acl %s is not allowed", acl)
+		}
+	}
+	return nil
+}
+
+// HasDenied reports whether any violation comes from deny rule.
+func HasDenied(violations []*Violation) bool {
+	for _, violation := range violations {
+		if violation.Level == LevelDeny {
+			return true
+		}
+	}
+	return false
+}
+
+// PolicyError is returned when plan violates deny rules, or when Reason
+// is set, when the action can not be checked against the policy.
+type PolicyError struct {
+	Violations []*Violation
+	Reason     string
+}
+
+func (e *PolicyError) Error() string {
+	if e.Reason != "" {
+		return e.Reason
+	}
+	denied := 0
+	for _, violation := range e.Violations {
+		if violation.Level == LevelDeny {
+			denied++
+		}
+	}
+	return fmt.Sprintf("plan violates %d deny policy rules", denied)
+}
+
+// Check evaluates the policy against the plan, prints violations and
+// returns PolicyError when any deny rule is violated.
+func Check(out io.Writer, policy *Policy, plan *plans.Plan) error {
+	violations := policy.Evaluate(plan)
+	if err := PrintViolations(out, violations); err != nil {
+		return err
+	}
+	if HasDenied(violations) {
+		return &PolicyError{Violations: violations}
+	}
+	return nil
+}
+
+func PrintViolations(out io.Writer, violations []*Violation) error {
+	if len(violations) == 0 {
+		fmt.Fprintf(out, "policy check passed\n")
+		return nil
+	}
+	w := tabwriter.NewWriter(out, 0, 4, 2, ' ', 0)
+	fmt.Fprintf(w, "LEVEL\tRULE\tADDRESS\tMESSAGE\n")
+	for _, violation := range violations {
+		address := violation.Address
+		if address == "" {
+			address = "-"
+		}
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\n", violation.Level, violation.Rule, address, violation.Message)
+	}
+	return w.Flush()
+}
@@ -0,0 +1,177 @@
+package policy
+
+import (
+	"bytes"
+	"errors"
+	"io/ioutil"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/p0tr3c/terra-ci/plans"
+)
+
+func TestLoadPolicy(t *testing.T) {
+	tests := []struct {
+		name   string
+		policy string
+		rules  []*Rule
+		err    string
+	}{
+		{
+			name: "valid",
+			policy: `
+rules:
+  - name: keep-databases
+    level: deny
+    type: no_delete
+    resource_types: [aws_db_instance]
+  - level: warn
+    type: require_tags
+    tags: [owner]
+  - level: deny
+    type: max_destroy
+    max: 2
+`,
+			rules: []*Rule{
+				{Name: "keep-databases", Level: LevelDeny, Type: RuleNoDelete, ResourceTypes: []string{"aws_db_instance"}},
+				{Name: "rule-2", Level: LevelWarn, Type: RuleRequireTags, Tags: []string{"owner"}},
+				{Name: "rule-3", Level: LevelDeny, Type: RuleMaxDestroy, Max: 2},
+			},
+		},
+		{name: "invalid level", policy: "rules:\n  - level: block\n    type: no_delete\n", err: `invalid level "block"`},
+		{name: "unknown type", policy: "rules:\n  - level: deny\n    type: no_create\n", err: `unknown type "no_create"`},
+		{name: "require tags without tags", policy: "rules:\n  - level: deny\n    type: require_tags\n", err: "requires tags"},
+		{name: "negative max", policy: "rules:\n  - level: deny\n    type: max_destroy\n    max: -1\n", err: "requires non-negative max"},
+		{name: "unknown field", policy: "rules:\n  - level: deny\n    type: no_delete\n    resources: [a]\n", err: "failed to parse policy"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "policy.yml")
+			if err := ioutil.WriteFile(path, []byte(tt.policy), 0644); err != nil {
+				t.Fatalf("failed to write policy: %s", err)
+			}
+			policy, err := LoadPolicy(path)
+			if tt.err != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.err) {
+					t.Fatalf("expected error containing %q, got %v", tt.err, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %s", err)
+			}
+			if !reflect.DeepEqual(policy.Rules, tt.rules) {
+				t.Fatalf("expected rules %+v, got %+v", tt.rules, policy.Rules)
+			}
+		})
+	}
+}
+
+const testPlan = `{
+  "format_version": "0.2",
+  "resource_changes": [
+    {"address": "aws_db_instance.main", "mode": "managed", "type": "aws_db_instance", "change": {"actions": ["delete"], "before": {}, "after": null}},
+    {"address": "aws_instance.old", "mode": "managed", "type": "aws_instance", "change": {"actions": ["delete", "create"], "after": {"tags": {"owner": "ops"}}}},
+    {"address": "aws_instance.tagged", "mode": "managed", "type": "aws_instance", "change": {"actions": ["create"], "after": {"tags": {"owner": "ops"}}}},
+    {"address": "aws_instance.default_tags", "mode": "managed", "type": "aws_instance", "change": {"actions": ["create"], "after": {"tags": null, "tags_all": {"owner": "ops"}}}},
+    {"address": "aws_instance.untagged", "mode": "managed", "type": "aws_instance", "change": {"actions": ["update"], "after": {"tags": {"name": "x"}, "tags_all": {"name": "x"}}}},
+    {"address": "aws_iam_role_policy.inline", "mode": "managed", "type": "aws_iam_role_policy", "change": {"actions": ["create"], "after": {"policy": "{}"}}},
+    {"address": "aws_s3_bucket.public", "mode": "managed", "type": "aws_s3_bucket", "change": {"actions": ["create"], "after": {"acl": "public-read"}}},
+    {"address": "aws_s3_bucket_acl.private", "mode": "managed", "type": "aws_s3_bucket_acl", "change": {"actions": ["update"], "after": {"acl": "private"}}},
+    {"address": "data.aws_instance.lookup", "mode": "data", "type": "aws_instance", "change": {"actions": ["read"], "after": {}}}
+  ]
+}`
+
+func TestEvaluate(t *testing.T) {
+	plan, err := plans.ParsePlan([]byte(testPlan))
+	if err != nil {
+		t.Fatalf("failed to parse plan: %s", err)
+	}
+	tests := []struct {
+		name       string
+		rule       *Rule
+		violations []string
+	}{
+		{
+			name:       "no_delete",
+			rule:       &Rule{Type: RuleNoDelete},
+			violations: []string{"aws_db_instance.main", "aws_instance.old"},
+		},
+		{
+			name:       "no_delete of resource types",
+			rule:       &Rule{Type: RuleNoDelete, ResourceTypes: []string{"aws_db_instance", "aws_rds_cluster"}},
+			violations: []string{"aws_db_instance.main"},
+		},
+		{
+			name:       "require_tags",
+			rule:       &Rule{Type: RuleRequireTags, Tags: []string{"owner"}},
+			violations: []string{"aws_instance.untagged"},
+		},
+		{
+			name:       "require_tags of resource types",
+			rule:       &Rule{Type: RuleRequireTags, Tags: []string{"owner"}, ResourceTypes: []string{"aws_s3_bucket"}},
+			violations: []string{},
+		},
+		{
+			name:       "no_public_s3_acl",
+			rule:       &Rule{Type: RuleNoPublicS3Acl},
+			violations: []string{"aws_s3_bucket.public"},
+		},
+		{
+			name:       "max_destroy exceeded",
+			rule:       &Rule{Type: RuleMaxDestroy, Max: 1},
+			violations: []string{""},
+		},
+		{
+			name:       "max_destroy within limit",
+			rule:       &Rule{Type: RuleMaxDestroy, Max: 2},
+			violations: []string{},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.rule.Name = tt.name
+			tt.rule.Level = LevelDeny
+			violations := (&Policy{Rules: []*Rule{tt.rule}}).Evaluate(plan)
+			addresses := []string{}
+			for _, violation := range violations {
+				if violation.Rule != tt.name || violation.Level != LevelDeny {
+					t.Fatalf("unexpected violation %+v", violation)
+				}
+				addresses = append(addresses, violation.Address)
+			}
+			if !reflect.DeepEqual(addresses, tt.violations) {
+				t.Fatalf("expected violations of %v, got %v", tt.violations, addresses)
+			}
+		})
+	}
+}
+
+func TestCheck(t *testing.T) {
+	plan, err := plans.ParsePlan([]byte(testPlan))
+	if err != nil {
+		t.Fatalf("failed to parse plan: %s", err)
+	}
+	warn := &Policy{Rules: []*Rule{{Name: "owner", Level: LevelWarn, Type: RuleRequireTags, Tags: []string{"owner"}}}}
+	var out bytes.Buffer
+	if err := Check(&out, warn, plan); err != nil {
+		t.Fatalf("expected warnings not to fail the check, got %s", err)
+	}
+	if !strings.Contains(out.String(), "aws_instance.untagged") {
+		t.Fatalf("expected violation to be printed, got %s", out.String())
+	}
+
+	deny := &Policy{Rules: append(warn.Rules, &Rule{Name: "keep", Level: LevelDeny, Type: RuleNoDelete})}
+	err = Check(ioutil.Discard, deny, plan)
+	var policyErr *PolicyError
+	if !errors.As(err, &policyErr) || len(policyErr.Violations) != 3 || err.Error() != "plan violates 2 deny policy rules" {
+		t.Fatalf("expected policy error with 2 deny violations, got %v", err)
+	}
+
+	out.Reset()
+	if err := Check(&out, &Policy{}, plan); err != nil || out.String() != "policy check passed\n" {
+		t.Fatalf("expected empty policy to pass, got %v %q", err, out.String())
+	}
+}
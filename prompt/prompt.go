@@ -0,0 +1,46 @@
+package prompt
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"strings"
+	"sync"
+)
+
+var (
+	// readers holds one buffered reader per input stream, so answers
+	// typed ahead for later questions are not lost in a discarded buffer
+	readers   = map[io.Reader]*bufio.Reader{}
+	readersMu sync.Mutex
+)
+
+func reader(in io.Reader) *bufio.Reader {
+	readersMu.Lock()
+	defer readersMu.Unlock()
+	if buffered, ok := in.(*bufio.Reader); ok {
+		return buffered
+	}
+	buffered, ok := readers[in]
+	if !ok {
+		buffered = bufio.NewReader(in)
+		readers[in] = buffered
+	}
+	return buffered
+}
+
+// Confirm prints message followed by a [y/N] choice and reads a single
+// answer line from in. Anything other than an explicit yes is a decline.
+func Confirm(in io.Reader, out io.Writer, message string) (bool, error) {
+	fmt.Fprintf(out, "%s [y/N]: ", message)
+	answer, err := reader(in).ReadString('\n')
+	if err != nil && err != io.EOF {
+		return false, err
+	}
+	switch strings.ToLower(strings.TrimSpace(answer)) {
+	case "y", "yes":
+		return true, nil
+	default:
+		return false, nil
+	}
+}
@@ -0,0 +1,24 @@
+package prompt
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+func TestConfirmReadsAnswersInOrder(t *testing.T) {
+	in := strings.NewReader("y\nno\n Yes \n")
+	var out bytes.Buffer
+	for i, expected := range []bool{true, false, true, false} {
+		confirmed, err := Confirm(in, &out, "continue?")
+		if err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+		if confirmed != expected {
+			t.Fatalf("expected answer %d to be %t, got %t", i, expected, confirmed)
+		}
+	}
+	if expected := strings.Repeat("continue? [y/N]: ", 4); out.String() != expected {
+		t.Fatalf("expected output %q, got %q", expected, out.String())
+	}
+}
@@ -0,0 +1,65 @@
+package reports
+
+import (
+	"encoding/json"
+	"os"
+	"time"
+
+	"github.com/p0tr3c/terra-ci/aws"
+
+	awssdk "github.com/aws/aws-sdk-go/aws"
+)
+
+// EventRecord is single line of the json report.
+type EventRecord struct {
+	Arn             string    `json:"arn"`
+	Id              int64     `json:"id"`
+	PreviousEventId int64     `json:"previous_event_id"`
+	Type            string    `json:"type"`
+	Timestamp       time.Time `json:"timestamp"`
+	State           string    `json:"state,omitempty"`
+}
+
+func NewEventRecord(event aws.SfnEvent) *EventRecord {
+	return &EventRecord{
+		Arn:             event.Arn,
+		Id:              awssdk.Int64Value(event.Id),
+		PreviousEventId: awssdk.Int64Value(event.PreviousEventId),
+		Type:            awssdk.StringValue(event.Type),
+		Timestamp:       awssdk.TimeValue(event.Timestamp),
+		State:           event.StateName(),
+	}
+}
+
+// JsonSubscriber appends every event as single json line to the file.
+// File is created on the first event.
+type JsonSubscriber struct {
+	Path    string
+	file    *os.File
+	encoder *json.Encoder
+}
+
+func NewJsonSubscriber(target string) (aws.SfnEventSubscriber, error) {
+	return &JsonSubscriber{
+		Path: target,
+	}, nil
+}
+
+func (s *JsonSubscriber) HandleEvent(event aws.SfnEvent) error {
+	if s.file == nil {
+		file, err := os.Create(s.Path)
+		if err != nil {
+			return err
+		}
+		s.file = file
+		s.encoder = json.NewEncoder(file)
+	}
+	return s.encoder.Encode(NewEventRecord(event))
+}
+
+func (s *JsonSubscriber) Close() error {
+	if s.file == nil {
+		return nil
+	}
+	return s.file.Close()
+}
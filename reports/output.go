@@ -0,0 +1,170 @@
+package reports
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/p0tr3c/terra-ci/aws"
+	"github.com/p0tr3c/terra-ci/plans"
+	"github.com/p0tr3c/terra-ci/workspaces"
+
+	awssdk "github.com/aws/aws-sdk-go/aws"
+)
+
+const (
+	OutputText   = "text"
+	OutputJson   = "json"
+	OutputNdjson = "ndjson"
+)
+
+var (
+	executionStatus = map[string]string{
+		"ExecutionSucceeded": "SUCCEEDED",
+		"ExecutionFailed":    "FAILED",
+		"ExecutionTimedOut":  "TIMED_OUT",
+		"ExecutionAborted":   "ABORTED",
+	}
+)
+
+// ExecutionResult is structured result of plan, apply or test. In ndjson
+// output transitions and logs are written as separate records while the
+// execution runs, so they are omitted from the result record.
+type ExecutionResult struct {
+	Record      string         `json:"record"`
+	Action      string         `json:"action"`
+	Path        string         `json:"path"`
+	Arn         string         `json:"arn,omitempty"`
+	Status      string         `json:"status"`
+	Started     time.Time      `json:"started"`
+	Finished    time.Time      `json:"finished"`
+	Duration    float64        `json:"duration_seconds"`
+	Tasks       []string       `json:"tasks"`
+	Transitions []*EventRecord `json:"transitions,omitempty"`
+	Logs        []string       `json:"logs,omitempty"`
+	Changes     bool           `json:"changes,omitempty"`
+	Plan        *plans.Summary `json:"plan,omitempty"`
+	Error       string         `json:"error,omitempty"`
+}
+
+type transitionRecord struct {
+	Record string `json:"record"`
+	*EventRecord
+}
+
+type logRecord struct {
+	Record  string `json:"record"`
+	Arn     string `json:"arn"`
+	Message string `json:"message"`
+}
+
+// ExecutionRecorder collects execution events and task logs and writes
+// them to out as json document or as ndjson records.
+type ExecutionRecorder struct {
+	Format  string
+	Out     io.Writer
+	Result  *ExecutionResult
+	encoder *json.Encoder
+	rm      sync.Mutex
+}
+
+func NewExecutionRecorder(format string, out io.Writer, action, path string) (*ExecutionRecorder, error) {
+	if format != OutputJson && format != OutputNdjson {
+		return nil, fmt.Errorf("unsupported output format %q", format)
+	}
+	return &ExecutionRecorder{
+		Format:  format,
+		Out:     out,
+		encoder: json.NewEncoder(out),
+		Result: &ExecutionResult{
+			Record:  "result",
+			Action:  action,
+			Path:    path,
+			Started: time.Now().UTC(),
+			Tasks:   []string{},
+		},
+	}, nil
+}
+
+// isTransition reports whether event enters or exits a state or changes
+// status of the execution.
+func isTransition(event aws.SfnEvent) bool {
+	return event.StateName() != "" || strings.HasPrefix(awssdk.StringValue(event.Type), "Execution")
+}
+
+func (r *ExecutionRecorder) HandleEvent(event aws.SfnEvent) error {
+	r.rm.Lock()
+	defer r.rm.Unlock()
+	r.Result.Arn = event.Arn
+	eventType := awssdk.StringValue(event.Type)
+	if status, ok := executionStatus[eventType]; ok {
+		r.Result.Status = status
+	}
+	if eventType == "TaskStateEntered" {
+		r.Result.Tasks = append(r.Result.Tasks, event.StateName())
+	}
+	if !isTransition(event) {
+		return nil
+	}
+	if r.Format == OutputNdjson {
+		return r.encoder.Encode(&transitionRecord{
+			Record:      "transition",
+			EventRecord: NewEventRecord(event),
+		})
+	}
+	r.Result.Transitions = append(r.Result.Transitions, NewEventRecord(event))
+	return nil
+}
+
+func (r *ExecutionRecorder) HandleLog(line string) error {
+	r.rm.Lock()
+	defer r.rm.Unlock()
+	if r.Format == OutputNdjson {
+		return r.encoder.Encode(&logRecord{
+			Record:  "log",
+			Arn:     r.Result.Arn,
+			Message: line,
+		})
+	}
+	r.Result.Logs = append(r.Result.Logs, line)
+	return nil
+}
+
+// Close is called by the monitor after the last event, result is written
+// by Finish once the command completes.
+func (r *ExecutionRecorder) Close() error {
+	return nil
+}
+
+// Finish writes result of the execution which completed with err.
+func (r *ExecutionRecorder) Finish(err error) error {
+	r.rm.Lock()
+	defer r.rm.Unlock()
+	r.Result.Finished = time.Now().UTC()
+	r.Result.Duration = r.Result.Finished.Sub(r.Result.Started).Seconds()
+	var planChanges *workspaces.PlanChangesError
+	if errors.As(err, &planChanges) {
+		r.Result.Changes = true
+		err = nil
+	}
+	if r.Result.Plan != nil {
+		r.Result.Changes = r.Result.Plan.HasChanges()
+	}
+	if err != nil {
+		r.Result.Error = err.Error()
+	}
+	if r.Result.Status == "" {
+		r.Result.Status = "SUCCEEDED"
+		if err != nil {
+			r.Result.Status = "FAILED"
+		}
+	}
+	if r.Format == OutputJson {
+		r.encoder.SetIndent("", "  ")
+	}
+	return r.encoder.Encode(r.Result)
+}
@@ -0,0 +1,47 @@
+package reports
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/p0tr3c/terra-ci/aws"
+)
+
+// NewSubscriberFunc creates event subscriber writing its report to target.
+type NewSubscriberFunc func(target string) (aws.SfnEventSubscriber, error)
+
+var (
+	// Reporters maps report kind, as used in --report kind=target, to the
+	// function creating its subscriber.
+	Reporters = map[string]NewSubscriberFunc{
+		"json":    NewJsonSubscriber,
+		"timing":  NewTimingSubscriber,
+		"webhook": NewWebhookSubscriber,
+	}
+)
+
+// NewSubscriber creates subscriber from report specification kind=target,
+// e.g. json=events.ndjson.
+func NewSubscriber(spec string) (aws.SfnEventSubscriber, error) {
+	parts := strings.SplitN(spec, "=", 2)
+	if len(parts) != 2 || parts[0] == "" || parts[1] == "" {
+		return nil, fmt.Errorf("invalid report %q, expected kind=target", spec)
+	}
+	newSubscriber, ok := Reporters[parts[0]]
+	if !ok {
+		return nil, fmt.Errorf("unknown report kind %q", parts[0])
+	}
+	return newSubscriber(parts[1])
+}
+
+func NewSubscribers(specs []string) ([]aws.SfnEventSubscriber, error) {
+	subscribers := []aws.SfnEventSubscriber{}
+	for _, spec := range specs {
+		subscriber, err := NewSubscriber(spec)
+		if err != nil {
+			return nil, err
+		}
+		subscribers = append(subscribers, subscriber)
+	}
+	return subscribers, nil
+}
@@ -0,0 +1,79 @@
+package reports
+
+import (
+	"fmt"
+	"io/ioutil"
+	"strings"
+	"time"
+
+	"github.com/p0tr3c/terra-ci/aws"
+
+	awssdk "github.com/aws/aws-sdk-go/aws"
+)
+
+type stateTiming struct {
+	Name    string
+	Entered time.Time
+	Exited  time.Time
+}
+
+// TimingSubscriber collects time spent in each state and writes the
+// summary to the file once execution completes.
+type TimingSubscriber struct {
+	Path     string
+	started  time.Time
+	finished time.Time
+	status   string
+	states   []*stateTiming
+	running  map[string]*stateTiming
+}
+
+func NewTimingSubscriber(target string) (aws.SfnEventSubscriber, error) {
+	return &TimingSubscriber{
+		Path:    target,
+		running: make(map[string]*stateTiming),
+	}, nil
+}
+
+func (s *TimingSubscriber) HandleEvent(event aws.SfnEvent) error {
+	timestamp := awssdk.TimeValue(event.Timestamp)
+	switch {
+	case awssdk.StringValue(event.Type) == "ExecutionStarted":
+		s.started = timestamp
+	case aws.SfnExitEvents[awssdk.StringValue(event.Type)]:
+		s.finished = timestamp
+		s.status = awssdk.StringValue(event.Type)
+	case event.StateEnteredEventDetails != nil:
+		state := &stateTiming{
+			Name:    event.StateName(),
+			Entered: timestamp,
+		}
+		s.states = append(s.states, state)
+		s.running[state.Name] = state
+	case event.StateExitedEventDetails != nil:
+		if state, ok := s.running[event.StateName()]; ok {
+			state.Exited = timestamp
+			delete(s.running, state.Name)
+		}
+	}
+	return nil
+}
+
+func formatDuration(from, to time.Time) string {
+	if from.IsZero() || to.IsZero() {
+		return "-"
+	}
+	return to.Sub(from).String()
+}
+
+func (s *TimingSubscriber) Close() error {
+	if s.started.IsZero() && len(s.states) == 0 {
+		return nil
+	}
+	var report strings.Builder
+	for _, state := range s.states {
+		fmt.Fprintf(&report, "%s\t%s\n", state.Name, formatDuration(state.Entered, state.Exited))
+	}
+	fmt.Fprintf(&report, "total\t%s\t%s\n", formatDuration(s.started, s.finished), s.status)
+	return ioutil.WriteFile(s.Path, []byte(report.String()), 0644)
+}
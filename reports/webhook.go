@@ -0,0 +1,56 @@
+package reports
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/p0tr3c/terra-ci/aws"
+
+	awssdk "github.com/aws/aws-sdk-go/aws"
+)
+
+const (
+	webhookTimeout = 10 * time.Second
+)
+
+// WebhookSubscriber posts json notification to the url when execution
+// completes.
+type WebhookSubscriber struct {
+	Url    string
+	Client *http.Client
+}
+
+func NewWebhookSubscriber(target string) (aws.SfnEventSubscriber, error) {
+	return &WebhookSubscriber{
+		Url: target,
+		Client: &http.Client{
+			Timeout: webhookTimeout,
+		},
+	}, nil
+}
+
+func (s *WebhookSubscriber) HandleEvent(event aws.SfnEvent) error {
+	if !aws.SfnExitEvents[awssdk.StringValue(event.Type)] {
+		return nil
+	}
+	body, err := json.Marshal(NewEventRecord(event))
+	if err != nil {
+		return err
+	}
+	resp, err := s.Client.Post(s.Url, "application/json", bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		return fmt.Errorf("webhook responded with %s", resp.Status)
+	}
+	return nil
+}
+
+func (s *WebhookSubscriber) Close() error {
+	return nil
+}
@@ -61,19 +61,5 @@ jobs:
           aws-region: eu-west-1
       - name: terragrunt apply
         run: ./terra-ci-linux-amd  workspace apply --path=${TERRA_CI_WORKSPACE_PATH}
-`
-	StateMachineInputTpl = `
-{
-    "Comment": "Run from CLI",
-    "build": {
-	  "action": "{{ .Action }}",
-      "environment": {
-        "terra_ci_resource": "{{ .Resource }}",
-        "terra_ci_source": "{{ .RepositoryUrl }}",
-        "terra_ci_location": "{{ .RepositoryName }}",
-        "terra_ci_run": "{{ .Run }}"
-      }
-    }
-}
 `
 )
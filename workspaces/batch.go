@@ -0,0 +1,324 @@
+package workspaces
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"sync"
+	"text/tabwriter"
+	"time"
+
+	"github.com/p0tr3c/terra-ci/aws"
+	"github.com/p0tr3c/terra-ci/plans"
+)
+
+const (
+	BatchSucceeded = "succeeded"
+	BatchFailed    = "failed"
+	BatchSkipped   = "skipped"
+)
+
+// DependencyGraph orders workspaces by terragrunt dependency and
+// dependencies blocks. Dependencies on workspaces outside of the graph
+// are not part of the ordering.
+type DependencyGraph struct {
+	Workspaces   []string
+	Dependencies map[string][]string
+}
+
+func NewDependencyGraph(configs []*TerragruntConfig) *DependencyGraph {
+	graph := &DependencyGraph{
+		Workspaces:   []string{},
+		Dependencies: map[string][]string{},
+	}
+	for _, terragruntConfig := range configs {
+		if _, ok := graph.Dependencies[terragruntConfig.Path]; ok {
+			continue
+		}
+		graph.Workspaces = append(graph.Workspaces, terragruntConfig.Path)
+		graph.Dependencies[terragruntConfig.Path] = []string{}
+	}
+	for _, terragruntConfig := range configs {
+		for _, dependency := range terragruntConfig.Dependencies {
+			if _, ok := graph.Dependencies[dependency]; ok && dependency != terragruntConfig.Path {
+				graph.Dependencies[terragruntConfig.Path] = append(graph.Dependencies[terragruntConfig.Path], dependency)
+			}
+		}
+	}
+	sort.Strings(graph.Workspaces)
+	return graph
+}
+
+// Order returns workspaces sorted so that every workspace follows its
+// dependencies. Independent workspaces are sorted by path.
+func (g *DependencyGraph) Order() ([]string, error) {
+	remaining := map[string]int{}
+	dependents := map[string][]string{}
+	for _, workspace := range g.Workspaces {
+		remaining[workspace] = len(g.Dependencies[workspace])
+		for _, dependency := range g.Dependencies[workspace] {
+			dependents[dependency] = append(dependents[dependency], workspace)
+		}
+	}
+	ready := []string{}
+	for _, workspace := range g.Workspaces {
+		if remaining[workspace] == 0 {
+			ready = append(ready, workspace)
+		}
+	}
+	order := []string{}
+	for len(ready) > 0 {
+		sort.Strings(ready)
+		workspace := ready[0]
+		ready = ready[1:]
+		order = append(order, workspace)
+		for _, dependent := range dependents[workspace] {
+			remaining[dependent]--
+			if remaining[dependent] == 0 {
+				ready = append(ready, dependent)
+			}
+		}
+	}
+	if len(order) < len(g.Workspaces) {
+		cycle := []string{}
+		for _, workspace := range g.Workspaces {
+			if remaining[workspace] > 0 {
+				cycle = append(cycle, workspace)
+			}
+		}
+		return nil, fmt.Errorf("dependency cycle between workspaces %s", strings.Join(cycle, ", "))
+	}
+	return order, nil
+}
+
+// BatchResult is outcome of execution of single workspace in batch.
+type BatchResult struct {
+	Path     string         `json:"path"`
+	Status   string         `json:"status"`
+	Duration float64        `json:"duration_seconds"`
+	Plan     *plans.Summary `json:"plan,omitempty"`
+	Error    string         `json:"error,omitempty"`
+}
+
+// BatchError is returned when any workspace in batch failed. Err is error
+// of the first failed workspace.
+type BatchError struct {
+	Failed  int
+	Skipped int
+	Err     error
+}
+
+func (e *BatchError) Error() string {
+	return fmt.Sprintf("%d workspaces failed, %d skipped", e.Failed, e.Skipped)
+}
+
+func (e *BatchError) Unwrap() error {
+	return e.Err
+}
+
+// isBatchStop reports whether error of workspace stops the whole batch,
+// which is the case when monitoring was interrupted or the execution was
+// aborted.
+func isBatchStop(err error) bool {
+	var interrupted aws.InterruptedError
+	var executionStatus *aws.ExecutionStatusError
+	return errors.As(err, &interrupted) ||
+		(errors.As(err, &executionStatus) && executionStatus.Status == "ExecutionAborted")
+}
+
+type batchCompletion struct {
+	result *BatchResult
+	err    error
+}
+
+// ExecuteBatch executes workspaces of the graph in dependency order, up
+// to parallelism workspaces at once. Dependents of failed workspaces are
+// skipped. When execution of workspace is interrupted or aborted, no more
+// workspaces are started and its error is returned once running
+// executions complete. PlanChangesError is returned when no workspace
+// failed and any plan has changes. Results are returned in dependency
+// order.
+func ExecuteBatch(graph *DependencyGraph, parallelism int, execute func(path string) (*plans.Summary, error)) ([]*BatchResult, error) {
+	order, err := graph.Order()
+	if err != nil {
+		return nil, err
+	}
+	if parallelism < 1 {
+		parallelism = 1
+	}
+
+	results := map[string]*BatchResult{}
+	orderedResults := []*BatchResult{}
+	remaining := map[string]int{}
+	dependents := map[string][]string{}
+	ready := []string{}
+	for _, path := range order {
+		results[path] = &BatchResult{Path: path}
+		orderedResults = append(orderedResults, results[path])
+		remaining[path] = len(graph.Dependencies[path])
+		for _, dependency := range graph.Dependencies[path] {
+			dependents[dependency] = append(dependents[dependency], path)
+		}
+		if remaining[path] == 0 {
+			ready = append(ready, path)
+		}
+	}
+	release := func(path string) {
+		for _, dependent := range dependents[path] {
+			remaining[dependent]--
+			if remaining[dependent] == 0 {
+				ready = append(ready, dependent)
+			}
+		}
+	}
+
+	batchError := &BatchError{}
+	var stopErr error
+	changed := []string{}
+	completions := make(chan *batchCompletion)
+	running := 0
+	for finished := 0; finished < len(order); {
+		for len(ready) > 0 && running < parallelism {
+			sort.Strings(ready)
+			result := results[ready[0]]
+			ready = ready[1:]
+			if stopErr != nil {
+				result.Status = BatchSkipped
+				result.Error = fmt.Sprintf("batch stopped: %s", stopErr.Error())
+			}
+			for _, dependency := range graph.Dependencies[result.Path] {
+				if result.Status == BatchSkipped {
+					break
+				}
+				if status := results[dependency].Status; status != BatchSucceeded {
+					result.Status = BatchSkipped
+					result.Error = fmt.Sprintf("dependency %s %s", dependency, status)
+				}
+			}
+			if result.Status == BatchSkipped {
+				batchError.Skipped++
+				finished++
+				release(result.Path)
+				continue
+			}
+
+			running++
+			go func(result *BatchResult) {
+				started := time.Now()
+				plan, err := execute(result.Path)
+				result.Plan = plan
+				result.Duration = time.Since(started).Seconds()
+				completions <- &batchCompletion{result: result, err: err}
+			}(result)
+		}
+		if running == 0 {
+			break
+		}
+
+		completion := <-completions
+		running--
+		finished++
+		var planChanges *PlanChangesError
+		switch {
+		case completion.err != nil && !errors.As(completion.err, &planChanges):
+			completion.result.Status = BatchFailed
+			completion.result.Error = completion.err.Error()
+			batchError.Failed++
+			if batchError.Err == nil {
+				batchError.Err = completion.err
+			}
+			if stopErr == nil && isBatchStop(completion.err) {
+				stopErr = completion.err
+			}
+		default:
+			completion.result.Status = BatchSucceeded
+			if completion.err != nil || (completion.result.Plan != nil && completion.result.Plan.HasChanges()) {
+				changed = append(changed, completion.result.Path)
+			}
+		}
+		release(completion.result.Path)
+	}
+	switch {
+	case stopErr != nil:
+		return orderedResults, stopErr
+	case batchError.Failed > 0:
+		return orderedResults, batchError
+	case len(changed) > 0:
+		sort.Strings(changed)
+		return orderedResults, &PlanChangesError{Path: strings.Join(changed, ", ")}
+	}
+	return orderedResults, nil
+}
+
+// PrefixedWriter writes complete lines to out, each prefixed with name of
+// the workspace, so output of concurrent executions can be told apart.
+// Writers sharing out must share the lock.
+type PrefixedWriter struct {
+	out    io.Writer
+	lock   *sync.Mutex
+	prefix string
+	buffer []byte
+}
+
+func NewPrefixedWriter(out io.Writer, lock *sync.Mutex, prefix string) *PrefixedWriter {
+	return &PrefixedWriter{
+		out:    out,
+		lock:   lock,
+		prefix: prefix,
+	}
+}
+
+func (w *PrefixedWriter) Write(p []byte) (int, error) {
+	w.lock.Lock()
+	defer w.lock.Unlock()
+	w.buffer = append(w.buffer, p...)
+	for {
+		i := bytes.IndexByte(w.buffer, '\n')
+		if i < 0 {
+			return len(p), nil
+		}
+		if _, err := w.out.Write(append([]byte(w.prefix), w.buffer[:i+1]...)); err != nil {
+			return 0, err
+		}
+		w.buffer = w.buffer[i+1:]
+	}
+}
+
+// Flush writes incomplete last line.
+func (w *PrefixedWriter) Flush() error {
+	w.lock.Lock()
+	defer w.lock.Unlock()
+	if len(w.buffer) == 0 {
+		return nil
+	}
+	line := append([]byte(w.prefix), w.buffer...)
+	w.buffer = nil
+	_, err := w.out.Write(append(line, '\n'))
+	return err
+}
+
+// PrintBatchResults prints table of results of batch execution.
+func PrintBatchResults(out io.Writer, results []*BatchResult) error {
+	w := tabwriter.NewWriter(out, 0, 4, 2, ' ', 0)
+	fmt.Fprintf(w, "WORKSPACE\tSTATUS\tDURATION\tPLAN\tERROR\n")
+	for _, result := range results {
+		plan := "-"
+		if result.Plan != nil {
+			plan = result.Plan.String()
+		}
+		errorMessage := "-"
+		if result.Error != "" {
+			errorMessage = strings.SplitN(result.Error, "\n", 2)[0]
+		}
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\n",
+			result.Path,
+			result.Status,
+			time.Duration(result.Duration*float64(time.Second)).Round(time.Second),
+			plan,
+			errorMessage)
+	}
+	return w.Flush()
+}
@@ -0,0 +1,318 @@
+package workspaces
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/p0tr3c/terra-ci/aws"
+	"github.com/p0tr3c/terra-ci/plans"
+)
+
+// newTestGraph returns graph of workspaces with dependencies given as
+// space separated paths.
+func newTestGraph(dependencies map[string]string) *DependencyGraph {
+	configs := []*TerragruntConfig{}
+	for path, paths := range dependencies {
+		configs = append(configs, &TerragruntConfig{Path: path, Dependencies: strings.Fields(paths)})
+	}
+	return NewDependencyGraph(configs)
+}
+
+func TestDependencyGraphOrder(t *testing.T) {
+	tests := []struct {
+		name         string
+		dependencies map[string]string
+		order        []string
+		err          string
+	}{
+		{
+			name:         "independent",
+			dependencies: map[string]string{"c": "", "a": "", "b": ""},
+			order:        []string{"a", "b", "c"},
+		},
+		{
+			name:         "chain",
+			dependencies: map[string]string{"a": "b", "b": "c", "c": ""},
+			order:        []string{"c", "b", "a"},
+		},
+		{
+			name:         "diamond",
+			dependencies: map[string]string{"app": "dns vpc", "dns": "vpc", "vpc": "", "zz": ""},
+			order:        []string{"vpc", "dns", "app", "zz"},
+		},
+		{
+			name:         "outside of graph",
+			dependencies: map[string]string{"app": "vpc ../other app"},
+			order:        []string{"app"},
+		},
+		{
+			name:         "cycle",
+			dependencies: map[string]string{"a": "b", "b": "c", "c": "a", "d": ""},
+			err:          "dependency cycle between workspaces a, b, c",
+		},
+		{
+			name:         "dependent of cycle",
+			dependencies: map[string]string{"a": "b", "b": "a", "c": "a"},
+			err:          "dependency cycle between workspaces a, b, c",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			order, err := newTestGraph(tt.dependencies).Order()
+			if tt.err != "" {
+				if err == nil || err.Error() != tt.err {
+					t.Fatalf("expected error %q, got %v", tt.err, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %s", err)
+			}
+			if !reflect.DeepEqual(order, tt.order) {
+				t.Fatalf("expected order %v, got %v", tt.order, order)
+			}
+		})
+	}
+}
+
+func TestExecuteBatch(t *testing.T) {
+	failed := errors.New("failed")
+	tests := []struct {
+		name         string
+		dependencies map[string]string
+		parallelism  int
+		errors       map[string]error
+		changes      []string
+		statuses     map[string]string
+		executed     []string
+		err          func(err error) bool
+	}{
+		{
+			name:         "succeeded",
+			dependencies: map[string]string{"app": "vpc", "vpc": ""},
+			statuses:     map[string]string{"app": BatchSucceeded, "vpc": BatchSucceeded},
+			executed:     []string{"vpc", "app"},
+			err:          func(err error) bool { return err == nil },
+		},
+		{
+			name:         "transitive dependents of failure are skipped",
+			dependencies: map[string]string{"vpc": "", "dns": "vpc", "app": "dns", "other": ""},
+			errors:       map[string]error{"vpc": failed},
+			statuses:     map[string]string{"vpc": BatchFailed, "dns": BatchSkipped, "app": BatchSkipped, "other": BatchSucceeded},
+			executed:     []string{"other", "vpc"},
+			err: func(err error) bool {
+				var batchErr *BatchError
+				return errors.As(err, &batchErr) && batchErr.Failed == 1 && batchErr.Skipped == 2 && errors.Is(err, failed)
+			},
+		},
+		{
+			name:         "plan changes",
+			dependencies: map[string]string{"app": "vpc", "vpc": "", "dns": ""},
+			errors:       map[string]error{"vpc": &PlanChangesError{Path: "vpc"}},
+			changes:      []string{"dns"},
+			statuses:     map[string]string{"app": BatchSucceeded, "vpc": BatchSucceeded, "dns": BatchSucceeded},
+			executed:     []string{"dns", "vpc", "app"},
+			err: func(err error) bool {
+				var planChanges *PlanChangesError
+				return errors.As(err, &planChanges) && planChanges.Path == "dns, vpc"
+			},
+		},
+		{
+			name:         "failure with plan changes",
+			dependencies: map[string]string{"vpc": "", "dns": ""},
+			errors:       map[string]error{"dns": failed, "vpc": &PlanChangesError{Path: "vpc"}},
+			statuses:     map[string]string{"vpc": BatchSucceeded, "dns": BatchFailed},
+			executed:     []string{"dns", "vpc"},
+			err: func(err error) bool {
+				var batchErr *BatchError
+				return errors.As(err, &batchErr)
+			},
+		},
+		{
+			name:         "interrupted",
+			dependencies: map[string]string{"a": "", "b": "", "c": ""},
+			errors:       map[string]error{"a": aws.InterruptedError("monitoring interrupted by interrupt")},
+			statuses:     map[string]string{"a": BatchFailed, "b": BatchSkipped, "c": BatchSkipped},
+			executed:     []string{"a"},
+			err: func(err error) bool {
+				var interrupted aws.InterruptedError
+				return errors.As(err, &interrupted)
+			},
+		},
+		{
+			name:         "aborted",
+			dependencies: map[string]string{"a": "", "b": "", "c": "a"},
+			errors:       map[string]error{"a": &aws.ExecutionStatusError{Status: "ExecutionAborted"}},
+			statuses:     map[string]string{"a": BatchFailed, "b": BatchSkipped, "c": BatchSkipped},
+			executed:     []string{"a"},
+			err: func(err error) bool {
+				var executionStatus *aws.ExecutionStatusError
+				return errors.As(err, &executionStatus) && executionStatus.Status == "ExecutionAborted"
+			},
+		},
+		{
+			name:         "interrupted with running executions",
+			dependencies: map[string]string{"a": "", "b": "", "c": ""},
+			parallelism:  2,
+			errors:       map[string]error{"a": aws.InterruptedError("monitoring interrupted by interrupt")},
+			statuses:     map[string]string{"a": BatchFailed, "b": BatchSucceeded, "c": BatchSkipped},
+			executed:     []string{"a", "b"},
+			err: func(err error) bool {
+				var interrupted aws.InterruptedError
+				return errors.As(err, &interrupted)
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var lock sync.Mutex
+			executed := []string{}
+			// With parallelism other executions complete after a
+			done := make(chan struct{})
+			results, err := ExecuteBatch(newTestGraph(tt.dependencies), tt.parallelism, func(path string) (*plans.Summary, error) {
+				lock.Lock()
+				executed = append(executed, path)
+				lock.Unlock()
+				if path == "a" {
+					defer close(done)
+				} else if tt.parallelism > 1 {
+					<-done
+				}
+				summary := &plans.Summary{}
+				for _, changed := range tt.changes {
+					if changed == path {
+						summary.Add = 1
+						summary.Resources = []*plans.ResourceSummary{{Address: "aws_instance.a", Action: "create"}}
+					}
+				}
+				return summary, tt.errors[path]
+			})
+			if !tt.err(err) {
+				t.Fatalf("unexpected error %v", err)
+			}
+			statuses := map[string]string{}
+			for _, result := range results {
+				statuses[result.Path] = result.Status
+			}
+			if !reflect.DeepEqual(statuses, tt.statuses) {
+				t.Fatalf("expected statuses %v, got %v", tt.statuses, statuses)
+			}
+			if tt.parallelism > 1 {
+				sort.Strings(executed)
+			}
+			if !reflect.DeepEqual(executed, tt.executed) {
+				t.Fatalf("expected executed %v, got %v", tt.executed, executed)
+			}
+		})
+	}
+}
+
+func TestExecuteBatchParallelism(t *testing.T) {
+	dependencies := map[string]string{}
+	for i := 0; i < 12; i++ {
+		dependencies[fmt.Sprintf("w%02d", i)] = ""
+	}
+	// Second half depends on workspaces of the first half
+	for i := 6; i < 12; i++ {
+		dependencies[fmt.Sprintf("w%02d", i)] = fmt.Sprintf("w%02d", i-6)
+	}
+	for _, parallelism := range []int{1, 3, 5} {
+		t.Run(fmt.Sprintf("parallelism %d", parallelism), func(t *testing.T) {
+			var lock sync.Mutex
+			running, maxRunning := 0, 0
+			results, err := ExecuteBatch(newTestGraph(dependencies), parallelism, func(path string) (*plans.Summary, error) {
+				lock.Lock()
+				running++
+				if running > maxRunning {
+					maxRunning = running
+				}
+				lock.Unlock()
+				time.Sleep(5 * time.Millisecond)
+				lock.Lock()
+				running--
+				lock.Unlock()
+				return nil, nil
+			})
+			if err != nil {
+				t.Fatalf("unexpected error: %s", err)
+			}
+			if len(results) != len(dependencies) {
+				t.Fatalf("expected %d results, got %d", len(dependencies), len(results))
+			}
+			if maxRunning > parallelism {
+				t.Fatalf("expected at most %d executions at once, got %d", parallelism, maxRunning)
+			}
+			if parallelism > 1 && maxRunning < 2 {
+				t.Fatalf("expected executions to run concurrently")
+			}
+		})
+	}
+}
+
+func TestPrefixedWriterConcurrentLines(t *testing.T) {
+	const (
+		writers = 8
+		lines   = 200
+	)
+	var out bytes.Buffer
+	var lock sync.Mutex
+	var wg sync.WaitGroup
+	for i := 0; i < writers; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			w := NewPrefixedWriter(&out, &lock, fmt.Sprintf("[w%d] ", i))
+			for line := 0; line < lines; line++ {
+				// Lines are written in fragments split at varying offsets
+				text := []byte(fmt.Sprintf("line %d of w%d\n", line, i))
+				split := line % len(text)
+				if _, err := w.Write(text[:split]); err != nil {
+					t.Errorf("unexpected error: %s", err)
+				}
+				if _, err := w.Write(text[split:]); err != nil {
+					t.Errorf("unexpected error: %s", err)
+				}
+			}
+			if _, err := w.Write([]byte("incomplete")); err != nil {
+				t.Errorf("unexpected error: %s", err)
+			}
+			if err := w.Flush(); err != nil {
+				t.Errorf("unexpected error: %s", err)
+			}
+		}(i)
+	}
+	wg.Wait()
+
+	// Every writer's lines are complete and in order
+	written := map[string]int{}
+	for _, line := range strings.Split(strings.TrimSuffix(out.String(), "\n"), "\n") {
+		end := strings.Index(line, "] ")
+		if !strings.HasPrefix(line, "[w") || end < 0 {
+			t.Fatalf("line without prefix %q", line)
+		}
+		writer, text := line[2:end], line[end+2:]
+		expected := fmt.Sprintf("line %d of w%s", written[writer], writer)
+		if written[writer] == lines {
+			expected = "incomplete"
+		}
+		if text != expected {
+			t.Fatalf("expected %q from w%s, got %q", expected, writer, text)
+		}
+		written[writer]++
+	}
+	if len(written) != writers {
+		t.Fatalf("expected output of %d writers, got %d", writers, len(written))
+	}
+	for writer, count := range written {
+		if count != lines+1 {
+			t.Fatalf("expected %d lines from w%s, got %d", lines+1, writer, count)
+		}
+	}
+}
@@ -0,0 +1,227 @@
+package workspaces
+
+import (
+	"path/filepath"
+	"strings"
+)
+
+// ChangedWorkspace is workspace affected by changed files.
+type ChangedWorkspace struct {
+	Path    string   `json:"path"`
+	Reasons []string `json:"reasons"`
+}
+
+func (w *ChangedWorkspace) addReason(reason string) {
+	for _, existing := range w.Reasons {
+		if existing == reason {
+			return
+		}
+	}
+	w.Reasons = append(w.Reasons, reason)
+}
+
+// Repository holds location of the current directory in git repository.
+type Repository struct {
+	// Root is path of the repository root relative to the current directory
+	Root string
+	// Prefix is path of the current directory relative to the repository root
+	Prefix string
+}
+
+// OpenRepository locates the current directory in git repository.
+func OpenRepository() (*Repository, error) {
+	root, err := RepositoryRoot()
+	if err != nil {
+		return nil, err
+	}
+	prefix, err := runGit("", "rev-parse", "--show-prefix")
+	if err != nil {
+		return nil, err
+	}
+	return &Repository{
+		Root:   root,
+		Prefix: filepath.Clean(prefix),
+	}, nil
+}
+
+// Path returns path relative to the repository root. Relative paths are
+// relative to the current directory.
+func (r *Repository) Path(path string) (string, error) {
+	if !filepath.IsAbs(path) {
+		return filepath.Join(r.Prefix, path), nil
+	}
+	absRoot, err := filepath.Abs(r.Root)
+	if err != nil {
+		return "", err
+	}
+	return filepath.Rel(absRoot, path)
+}
+
+// ChangedFiles returns files changed between merge base of base and head,
+// relative to the repository root.
+func ChangedFiles(base, head string) ([]string, *Repository, error) {
+	repository, err := OpenRepository()
+	if err != nil {
+		return nil, nil, err
+	}
+	diff, err := runGit("", "-c", "core.quotepath=off", "diff", "--name-only", "--no-renames", base+"..."+head, "--")
+	if err != nil {
+		return nil, nil, err
+	}
+	files := []string{}
+	for _, file := range strings.Split(diff, "\n") {
+		if file != "" {
+			files = append(files, filepath.Clean(file))
+		}
+	}
+	return files, repository, nil
+}
+
+// RepositoryRoot returns path of the git repository root relative to the
+// current directory.
+func RepositoryRoot() (string, error) {
+	repoRoot, err := runGit("", "rev-parse", "--show-cdup")
+	if err != nil {
+		return "", err
+	}
+	return filepath.Clean(repoRoot), nil
+}
+
+func isRemoteSource(source string) bool {
+	return strings.Contains(source, "::") || strings.Contains(source, "://") ||
+		strings.HasPrefix(source, "git@") || strings.HasSuffix(source, ".git") ||
+		strings.HasPrefix(source, "github.com/") || strings.HasPrefix(source, "bitbucket.org/")
+}
+
+// ModuleDirectory returns directory of the repository holding module used
+// by the workspace, or empty string when it can not be determined. Local
+// sources are resolved against the workspace. Subdirectory of remote
+// sources is assumed to be in this repository, as in monorepo. Local
+// sources starting with interpolation are resolved by the last directory
+// before the subdirectory, e.g. ${get_parent_terragrunt_dir()}/../modules//vpc
+// refers to modules/vpc.
+func ModuleDirectory(terragruntConfig *TerragruntConfig, repoRoot string) string {
+	source, _ := SplitModuleSource(terragruntConfig.Source)
+	if source == "" {
+		return ""
+	}
+	// Subdirectory follows the last // which is not part of url scheme
+	separator := -1
+	for i := 0; i+1 < len(source); i++ {
+		if source[i] == '/' && source[i+1] == '/' && (i == 0 || source[i-1] != ':') {
+			separator = i
+		}
+	}
+	repository, subdirectory := source, ""
+	if separator >= 0 {
+		repository, subdirectory = source[:separator], source[separator+2:]
+	}
+	switch {
+	case isRemoteSource(repository):
+		if subdirectory == "" {
+			return ""
+		}
+		return filepath.Join(repoRoot, subdirectory)
+	case strings.Contains(repository, "${"):
+		if subdirectory == "" {
+			return ""
+		}
+		return filepath.Join(repoRoot, filepath.Base(repository), subdirectory)
+	case filepath.IsAbs(repository):
+		return filepath.Join(repository, subdirectory)
+	}
+	return filepath.Join(terragruntConfig.Path, repository, subdirectory)
+}
+
+func isUnder(path, dir string) bool {
+	return path == dir || strings.HasPrefix(path, dir+string(filepath.Separator))
+}
+
+// changedConfig holds paths of workspace config relative to the
+// repository root.
+type changedConfig struct {
+	workspace       *ChangedWorkspace
+	path            string
+	references      []string
+	moduleDirectory string
+}
+
+func newChangedConfig(terragruntConfig *TerragruntConfig, repository *Repository) (*changedConfig, error) {
+	path, err := repository.Path(terragruntConfig.Path)
+	if err != nil {
+		return nil, err
+	}
+	config := &changedConfig{
+		workspace: &ChangedWorkspace{
+			Path:    terragruntConfig.Path,
+			Reasons: []string{},
+		},
+		path:       path,
+		references: []string{},
+	}
+	for _, reference := range append(append([]string{}, terragruntConfig.Includes...), terragruntConfig.Reads...) {
+		referencePath, err := repository.Path(reference)
+		if err != nil {
+			return nil, err
+		}
+		config.references = append(config.references, referencePath)
+	}
+	if moduleDirectory := ModuleDirectory(terragruntConfig, repository.Root); moduleDirectory != "" {
+		config.moduleDirectory, err = repository.Path(moduleDirectory)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return config, nil
+}
+
+// ChangedWorkspaces maps changed files, relative to the repository root,
+// to workspaces found under root. Workspace is affected by changes of its
+// own files, which are not part of nested workspace, of configs it
+// includes or reads with read_terragrunt_config and of the module
+// referenced by its terraform source.
+func ChangedWorkspaces(root string, changedFiles []string, repository *Repository) ([]*ChangedWorkspace, error) {
+	configs, err := FindTerragruntConfigs(root)
+	if err != nil {
+		return nil, err
+	}
+	changedConfigs := []*changedConfig{}
+	for _, terragruntConfig := range configs {
+		config, err := newChangedConfig(terragruntConfig, repository)
+		if err != nil {
+			return nil, err
+		}
+		changedConfigs = append(changedConfigs, config)
+	}
+
+	for _, file := range changedFiles {
+		// File belongs to the deepest workspace containing it
+		var owner *changedConfig
+		for _, config := range changedConfigs {
+			if isUnder(file, config.path) && (owner == nil || len(config.path) > len(owner.path)) {
+				owner = config
+			}
+		}
+		if owner != nil {
+			owner.workspace.addReason("workspace changed")
+		}
+		for _, config := range changedConfigs {
+			for _, reference := range config.references {
+				if file == reference {
+					config.workspace.addReason("config " + file + " changed")
+				}
+			}
+			if config.moduleDirectory != "" && config.moduleDirectory != "." && isUnder(file, config.moduleDirectory) {
+				config.workspace.addReason("module " + config.moduleDirectory + " changed")
+			}
+		}
+	}
+
+	changed := []*ChangedWorkspace{}
+	for _, config := range changedConfigs {
+		if len(config.workspace.Reasons) > 0 {
+			changed = append(changed, config.workspace)
+		}
+	}
+	return changed, nil
+}
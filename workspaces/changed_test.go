@@ -0,0 +1,142 @@
+package workspaces
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+// testGit runs git in dir with test identity.
+func testGit(t *testing.T, dir string, args ...string) string {
+	t.Helper()
+	args = append([]string{"-c", "user.name=test", "-c", "user.email=test@example.com", "-c", "commit.gpgsign=false"}, args...)
+	output, err := runGit(dir, args...)
+	if err != nil {
+		t.Fatalf("%s", err)
+	}
+	return output
+}
+
+// newTestRepository creates git repository with base commit on main branch
+// and changes committed on feature branch.
+func newTestRepository(t *testing.T, base, changes map[string]string) string {
+	t.Helper()
+	dir := t.TempDir()
+	testGit(t, dir, "init", "-q")
+	testGit(t, dir, "checkout", "-q", "-b", "main")
+	writeTree(t, dir, base)
+	testGit(t, dir, "add", "-A")
+	testGit(t, dir, "commit", "-q", "-m", "base")
+	testGit(t, dir, "checkout", "-q", "-b", "feature")
+	writeTree(t, dir, changes)
+	testGit(t, dir, "add", "-A")
+	testGit(t, dir, "commit", "-q", "-m", "changes")
+	return dir
+}
+
+// chdir changes the current directory for the duration of the test.
+func chdir(t *testing.T, dir string) {
+	t.Helper()
+	wd, err := os.Getwd()
+	if err != nil {
+		t.Fatalf("failed to get current directory: %s", err)
+	}
+	if err := os.Chdir(dir); err != nil {
+		t.Fatalf("failed to change directory: %s", err)
+	}
+	t.Cleanup(func() {
+		os.Chdir(wd)
+	})
+}
+
+func TestChangedWorkspaces(t *testing.T) {
+	base := map[string]string{
+		"live/terragrunt.hcl":                  `remote_state {}`,
+		"live/env.hcl":                         `locals { env = "prod" }`,
+		"live/prod/vpc/terragrunt.hcl":         "include {\n  path = find_in_parent_folders()\n}\n",
+		"live/prod/vpc/peering/terragrunt.hcl": "terraform {\n  source = \"../../../../modules//peering\"\n}\n",
+		"live/prod/app/terragrunt.hcl":         "locals {\n  env = read_terragrunt_config(find_in_parent_folders(\"env.hcl\"))\n}\n",
+		"modules/peering/main.tf":              `# peering`,
+	}
+	tests := []struct {
+		name     string
+		changes  map[string]string
+		dir      string
+		root     func(repo string) string
+		expected map[string][]string
+	}{
+		{
+			name:     "nested workspace",
+			changes:  map[string]string{"live/prod/vpc/peering/terragrunt.hcl": "# changed"},
+			root:     func(string) string { return "live" },
+			expected: map[string][]string{"live/prod/vpc/peering": {"workspace changed"}},
+		},
+		{
+			name:     "parent workspace",
+			changes:  map[string]string{"live/prod/vpc/main.tf": "# added"},
+			root:     func(string) string { return "live" },
+			expected: map[string][]string{"live/prod/vpc": {"workspace changed"}},
+		},
+		{
+			name:    "included config",
+			changes: map[string]string{"live/terragrunt.hcl": "# changed"},
+			root:    func(string) string { return "live" },
+			expected: map[string][]string{
+				"live/prod/vpc": {"config live/terragrunt.hcl changed"},
+			},
+		},
+		{
+			name:     "read config",
+			changes:  map[string]string{"live/env.hcl": "# changed"},
+			root:     func(string) string { return "live" },
+			expected: map[string][]string{"live/prod/app": {"config live/env.hcl changed"}},
+		},
+		{
+			name:     "module",
+			changes:  map[string]string{"modules/peering/main.tf": "# changed"},
+			root:     func(string) string { return "live" },
+			expected: map[string][]string{"live/prod/vpc/peering": {"module modules/peering changed"}},
+		},
+		{
+			name:     "absolute root",
+			changes:  map[string]string{"live/prod/app/main.tf": "# added"},
+			root:     func(repo string) string { return filepath.Join(repo, "live") },
+			expected: map[string][]string{"live/prod/app": {"workspace changed"}},
+		},
+		{
+			name:     "subdirectory of repository",
+			changes:  map[string]string{"live/env.hcl": "# changed"},
+			dir:      "live",
+			root:     func(string) string { return "prod" },
+			expected: map[string][]string{"prod/app": {"config live/env.hcl changed"}},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			repo := newTestRepository(t, base, tt.changes)
+			chdir(t, filepath.Join(repo, tt.dir))
+			root := tt.root(repo)
+
+			changedFiles, repository, err := ChangedFiles("main", "feature")
+			if err != nil {
+				t.Fatalf("unexpected error: %s", err)
+			}
+			changed, err := ChangedWorkspaces(root, changedFiles, repository)
+			if err != nil {
+				t.Fatalf("unexpected error: %s", err)
+			}
+			reasons := map[string][]string{}
+			for _, workspace := range changed {
+				path := workspace.Path
+				if filepath.IsAbs(path) {
+					path, _ = filepath.Rel(repo, path)
+				}
+				reasons[filepath.ToSlash(path)] = workspace.Reasons
+			}
+			if !reflect.DeepEqual(reasons, tt.expected) {
+				t.Fatalf("expected %v, got %v", tt.expected, reasons)
+			}
+		})
+	}
+}
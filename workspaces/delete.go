@@ -0,0 +1,161 @@
+package workspaces
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+)
+
+type WorkspaceDeleteInput struct {
+	Path         string
+	CiPath       string
+	LocalModules string
+	DryRun       bool
+}
+
+// IsWorkspaceStateEmpty lists resources tracked in the workspace state
+// and reports whether there are none left.
+func IsWorkspaceStateEmpty(path, localModules string, outErr io.Writer) (bool, error) {
+	shellCommandArgs := []string{
+		"state",
+		"list",
+	}
+	if localModules != "" {
+		shellCommandArgs = append(shellCommandArgs, []string{
+			"--terragrunt-source",
+			localModules,
+		}...)
+	}
+	shellCommand := exec.Command("terragrunt", shellCommandArgs...)
+	workspaceAbsPath, err := filepath.Abs(path)
+	if err != nil {
+		return false, err
+	}
+	var stateList bytes.Buffer
+	shellCommand.Dir = workspaceAbsPath
+	shellCommand.Stdout = &stateList
+	shellCommand.Stderr = outErr
+
+	if err := shellCommand.Run(); err != nil {
+		return false, err
+	}
+	return strings.TrimSpace(stateList.String()) == "", nil
+}
+
+// GetWorkspaceDeletions returns files and directories which belong to the
+// workspace, in the order in which they have to be removed. Parent
+// directories are only included when nothing else would be left in them.
+// Nothing at or above the current working directory is ever included,
+// workspaces which are not below it are refused.
+func GetWorkspaceDeletions(input *WorkspaceDeleteInput) ([]string, error) {
+	root, err := os.Getwd()
+	if err != nil {
+		return nil, err
+	}
+	workspaceAbsPath, err := filepath.Abs(input.Path)
+	if err != nil {
+		return nil, err
+	}
+	if !isBelow(root, workspaceAbsPath) {
+		return nil, fmt.Errorf("workspace %s is not below current directory %s", input.Path, root)
+	}
+
+	deletions := []string{}
+	removed := make(map[string]bool)
+
+	candidates := []string{
+		filepath.Join(input.Path, defaultTerragruntConfigName),
+	}
+	if input.CiPath != "" {
+		candidates = append(candidates, WorkspaceCIFilePath(input.CiPath, input.Path))
+	}
+	for _, candidate := range candidates {
+		absCandidate, err := filepath.Abs(candidate)
+		if err != nil {
+			return nil, err
+		}
+		if !isBelow(root, absCandidate) {
+			return nil, fmt.Errorf("refusing to remove %s, which is not below current directory %s", candidate, root)
+		}
+		if _, err := os.Stat(candidate); err != nil {
+			if os.IsNotExist(err) {
+				continue
+			}
+			return nil, err
+		}
+		deletions = append(deletions, candidate)
+		removed[filepath.Clean(candidate)] = true
+	}
+
+	dir := filepath.Clean(input.Path)
+	for {
+		absDir, err := filepath.Abs(dir)
+		if err != nil {
+			return nil, err
+		}
+		if !isBelow(root, absDir) {
+			break
+		}
+		empty, err := isDirectoryEmptyAfter(dir, removed)
+		if err != nil {
+			if os.IsNotExist(err) {
+				dir = filepath.Dir(dir)
+				continue
+			}
+			return nil, err
+		}
+		if !empty {
+			break
+		}
+		deletions = append(deletions, dir)
+		removed[dir] = true
+		dir = filepath.Dir(dir)
+	}
+	return deletions, nil
+}
+
+// isBelow reports whether absolute path is inside of absolute dir and is
+// not dir itself.
+func isBelow(dir, path string) bool {
+	rel, err := filepath.Rel(dir, path)
+	if err != nil {
+		return false
+	}
+	return rel != "." && rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator))
+}
+
+func isDirectoryEmptyAfter(dir string, removed map[string]bool) (bool, error) {
+	entries, err := ioutil.ReadDir(dir)
+	if err != nil {
+		return false, err
+	}
+	for _, entry := range entries {
+		if !removed[filepath.Join(dir, entry.Name())] {
+			return false, nil
+		}
+	}
+	return true, nil
+}
+
+func DeleteWorkspace(input *WorkspaceDeleteInput, out io.Writer) error {
+	deletions, err := GetWorkspaceDeletions(input)
+	if err != nil {
+		return err
+	}
+	for _, deletion := range deletions {
+		if input.DryRun {
+			fmt.Fprintf(out, "would remove %s\n", deletion)
+			continue
+		}
+		if err := os.Remove(deletion); err != nil {
+			return err
+		}
+		fmt.Fprintf(out, "removed %s\n", deletion)
+	}
+	return nil
+}
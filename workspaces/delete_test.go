@@ -0,0 +1,189 @@
+package workspaces
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestGetWorkspaceDeletions(t *testing.T) {
+	tests := []struct {
+		name      string
+		tree      map[string]string
+		dir       string
+		input     *WorkspaceDeleteInput
+		deletions []string
+		err       string
+	}{
+		{
+			name: "sibling workspace",
+			tree: map[string]string{
+				"live/prod/vpc/terragrunt.hcl": "",
+				"live/prod/dns/terragrunt.hcl": "",
+			},
+			input:     &WorkspaceDeleteInput{Path: "live/prod/vpc"},
+			deletions: []string{"live/prod/vpc/terragrunt.hcl", "live/prod/vpc"},
+		},
+		{
+			name: "empty parents",
+			tree: map[string]string{
+				"live/prod/vpc/terragrunt.hcl": "",
+				"live/dev/vpc/terragrunt.hcl":  "",
+			},
+			input:     &WorkspaceDeleteInput{Path: "live/prod/vpc/"},
+			deletions: []string{"live/prod/vpc/terragrunt.hcl", "live/prod/vpc", "live/prod"},
+		},
+		{
+			name: "stops below current directory",
+			tree: map[string]string{
+				"live/prod/vpc/terragrunt.hcl": "",
+			},
+			input:     &WorkspaceDeleteInput{Path: "live/prod/vpc"},
+			deletions: []string{"live/prod/vpc/terragrunt.hcl", "live/prod/vpc", "live/prod", "live"},
+		},
+		{
+			name: "stops below nested current directory",
+			tree: map[string]string{
+				"live/prod/vpc/terragrunt.hcl": "",
+			},
+			dir:       "live",
+			input:     &WorkspaceDeleteInput{Path: "prod/vpc"},
+			deletions: []string{"prod/vpc/terragrunt.hcl", "prod/vpc", "prod"},
+		},
+		{
+			name: "other files are kept",
+			tree: map[string]string{
+				"live/prod/vpc/terragrunt.hcl":      "",
+				"live/prod/vpc/.terraform.lock.hcl": "",
+			},
+			input:     &WorkspaceDeleteInput{Path: "live/prod/vpc"},
+			deletions: []string{"live/prod/vpc/terragrunt.hcl"},
+		},
+		{
+			name: "ci workflow",
+			tree: map[string]string{
+				"live/prod/vpc/terragrunt.hcl":             "",
+				"live/prod/dns/terragrunt.hcl":             "",
+				".github/workflows/workspace_prod_vpc.yml": "",
+				".github/workflows/workspace_prod_dns.yml": "",
+			},
+			input: &WorkspaceDeleteInput{Path: "live/prod/vpc", CiPath: ".github/workflows"},
+			deletions: []string{
+				"live/prod/vpc/terragrunt.hcl",
+				".github/workflows/workspace_prod_vpc.yml",
+				"live/prod/vpc",
+			},
+		},
+		{
+			name: "missing workspace",
+			tree: map[string]string{
+				"live/prod/dns/terragrunt.hcl": "",
+			},
+			input:     &WorkspaceDeleteInput{Path: "live/prod/vpc", CiPath: ".github/workflows"},
+			deletions: []string{},
+		},
+		{
+			name: "missing directory with empty parent",
+			tree: map[string]string{
+				"live/prod/dns/terragrunt.hcl": "",
+				"live/dev/.keep":               "",
+			},
+			input:     &WorkspaceDeleteInput{Path: "live/dev/vpc"},
+			deletions: []string{},
+		},
+		{
+			name: "current directory",
+			tree: map[string]string{
+				"terragrunt.hcl": "",
+			},
+			input: &WorkspaceDeleteInput{Path: "."},
+			err:   "is not below current directory",
+		},
+		{
+			name: "above current directory",
+			tree: map[string]string{
+				"live/prod/vpc/terragrunt.hcl": "",
+				"other/terragrunt.hcl":         "",
+			},
+			dir:   "other",
+			input: &WorkspaceDeleteInput{Path: "../live/prod/vpc"},
+			err:   "is not below current directory",
+		},
+		{
+			name: "ci workflow above current directory",
+			tree: map[string]string{
+				"live/prod/vpc/terragrunt.hcl":             "",
+				".github/workflows/workspace_prod_vpc.yml": "",
+			},
+			dir:   "live",
+			input: &WorkspaceDeleteInput{Path: "live/prod/vpc", CiPath: "../.github/workflows"},
+			err:   "not below current directory",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			root := t.TempDir()
+			writeTree(t, root, tt.tree)
+			chdir(t, filepath.Join(root, tt.dir))
+
+			deletions, err := GetWorkspaceDeletions(tt.input)
+			if tt.err != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.err) {
+					t.Fatalf("expected error %q, got %v", tt.err, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %s", err)
+			}
+			expected := []string{}
+			for _, deletion := range tt.deletions {
+				expected = append(expected, filepath.FromSlash(deletion))
+			}
+			if !reflect.DeepEqual(deletions, expected) {
+				t.Fatalf("expected deletions %v, got %v", expected, deletions)
+			}
+		})
+	}
+}
+
+func TestDeleteWorkspace(t *testing.T) {
+	root := t.TempDir()
+	writeTree(t, root, map[string]string{
+		"live/prod/vpc/terragrunt.hcl":             "",
+		".github/workflows/workspace_prod_vpc.yml": "",
+	})
+	chdir(t, root)
+	input := &WorkspaceDeleteInput{Path: "live/prod/vpc", CiPath: ".github/workflows"}
+
+	var out bytes.Buffer
+	input.DryRun = true
+	if err := DeleteWorkspace(input, &out); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if !strings.Contains(out.String(), "would remove live") {
+		t.Fatalf("expected dry run output, got\n%s", out.String())
+	}
+	if _, err := os.Stat("live/prod/vpc/terragrunt.hcl"); err != nil {
+		t.Fatalf("expected dry run to keep workspace: %s", err)
+	}
+
+	out.Reset()
+	input.DryRun = false
+	if err := DeleteWorkspace(input, &out); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	for _, removed := range []string{"live", ".github/workflows/workspace_prod_vpc.yml"} {
+		if _, err := os.Stat(removed); !os.IsNotExist(err) {
+			t.Errorf("expected %s to be removed, got %v", removed, err)
+		}
+	}
+	for _, kept := range []string{root, ".github/workflows"} {
+		if _, err := os.Stat(kept); err != nil {
+			t.Errorf("expected %s to be kept: %s", kept, err)
+		}
+	}
+}
@@ -0,0 +1,276 @@
+package workspaces
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/hashicorp/hcl/v2"
+	"github.com/hashicorp/hcl/v2/hclsyntax"
+)
+
+const (
+	terragruntCacheDirectory = ".terragrunt-cache"
+	findInParentFolders      = "find_in_parent_folders"
+	readTerragruntConfig     = "read_terragrunt_config"
+)
+
+// TerragruntConfig holds parts of terragrunt.hcl used by terra-ci. Paths
+// of includes, configs read with read_terragrunt_config and dependencies
+// are resolved relative to the current directory, the same way as the
+// path of the config.
+type TerragruntConfig struct {
+	Path         string
+	Source       string
+	Includes     []string
+	Reads        []string
+	Dependencies []string
+}
+
+// ReadTerragruntConfig parses terragrunt.hcl of the workspace in dir.
+func ReadTerragruntConfig(dir string) (*TerragruntConfig, error) {
+	configPath := filepath.Join(dir, defaultTerragruntConfigName)
+	data, err := ioutil.ReadFile(configPath)
+	if err != nil {
+		return nil, err
+	}
+	file, err := parseHcl(data, configPath)
+	if err != nil {
+		return nil, err
+	}
+
+	terragruntConfig := &TerragruntConfig{
+		Path:         filepath.Clean(dir),
+		Includes:     []string{},
+		Reads:        []string{},
+		Dependencies: []string{},
+	}
+	for _, block := range BlocksOfType(file.Body, "terraform") {
+		if source, ok := file.Attribute(block.Body, "source"); ok {
+			terragruntConfig.Source = source
+		}
+	}
+	for _, block := range BlocksOfType(file.Body, "include") {
+		attribute, ok := block.Body.Attributes["path"]
+		if !ok {
+			continue
+		}
+		include, err := resolveIncludePath(file, terragruntConfig.Path, attribute.Expr)
+		if err != nil {
+			return nil, fmt.Errorf("failed to resolve include of %s: %s", configPath, err.Error())
+		}
+		terragruntConfig.Includes = append(terragruntConfig.Includes, include)
+	}
+	reads, err := resolveReadPaths(file, terragruntConfig.Path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to resolve read_terragrunt_config of %s: %s", configPath, err.Error())
+	}
+	terragruntConfig.Reads = reads
+	for _, block := range BlocksOfType(file.Body, "dependency") {
+		if dependency, ok := file.Attribute(block.Body, "config_path"); ok {
+			terragruntConfig.addDependency(dependency)
+		}
+	}
+	for _, block := range BlocksOfType(file.Body, "dependencies") {
+		attribute, ok := block.Body.Attributes["paths"]
+		if !ok {
+			continue
+		}
+		for _, dependency := range file.Strings(attribute.Expr) {
+			terragruntConfig.addDependency(dependency)
+		}
+	}
+	return terragruntConfig, nil
+}
+
+func (c *TerragruntConfig) addDependency(path string) {
+	dependency := resolveConfigPath(c.Path, path)
+	for _, existing := range c.Dependencies {
+		if existing == dependency {
+			return
+		}
+	}
+	c.Dependencies = append(c.Dependencies, dependency)
+}
+
+// resolveConfigPath resolves path relative to the workspace. Paths using
+// interpolation can not be resolved and are kept as written.
+func resolveConfigPath(dir, path string) string {
+	if filepath.IsAbs(path) || strings.Contains(path, "${") {
+		return path
+	}
+	return filepath.Join(dir, path)
+}
+
+// resolveIncludePath returns path of included or read config. Besides
+// constant paths find_in_parent_folders calls are resolved, other
+// expressions are kept as written.
+func resolveIncludePath(file *hclFile, dir string, expr hclsyntax.Expression) (string, error) {
+	call, ok := expr.(*hclsyntax.FunctionCallExpr)
+	if !ok || call.Name != findInParentFolders {
+		return resolveConfigPath(dir, file.String(expr)), nil
+	}
+	name := defaultTerragruntConfigName
+	if len(call.Args) > 0 {
+		name = file.String(call.Args[0])
+	}
+	return findInParent(dir, name)
+}
+
+// resolveReadPaths returns paths of configs read anywhere in the file with
+// read_terragrunt_config, in order of appearance.
+func resolveReadPaths(file *hclFile, dir string) ([]string, error) {
+	calls := []*hclsyntax.FunctionCallExpr{}
+	hclsyntax.VisitAll(file.Body, func(node hclsyntax.Node) hcl.Diagnostics {
+		if call, ok := node.(*hclsyntax.FunctionCallExpr); ok && call.Name == readTerragruntConfig && len(call.Args) > 0 {
+			calls = append(calls, call)
+		}
+		return nil
+	})
+	// Attributes are visited in map order
+	sort.Slice(calls, func(i, j int) bool {
+		return calls[i].NameRange.Start.Byte < calls[j].NameRange.Start.Byte
+	})
+	reads := []string{}
+	for _, call := range calls {
+		read, err := resolveIncludePath(file, dir, call.Args[0])
+		if err != nil {
+			return nil, err
+		}
+		duplicate := false
+		for _, existing := range reads {
+			duplicate = duplicate || existing == read
+		}
+		if !duplicate {
+			reads = append(reads, read)
+		}
+	}
+	return reads, nil
+}
+
+// findInParent looks for file in parent directories of dir, as terragrunt
+// find_in_parent_folders does.
+func findInParent(dir, name string) (string, error) {
+	absDir, err := filepath.Abs(dir)
+	if err != nil {
+		return "", err
+	}
+	for current := filepath.Dir(absDir); ; current = filepath.Dir(current) {
+		candidate := filepath.Join(current, name)
+		if _, err := os.Stat(candidate); err == nil {
+			if filepath.IsAbs(dir) {
+				return candidate, nil
+			}
+			wd, err := os.Getwd()
+			if err != nil {
+				return "", err
+			}
+			return filepath.Rel(wd, candidate)
+		}
+		if filepath.Dir(current) == current {
+			return "", fmt.Errorf("%s not found in parent folders of %s", name, dir)
+		}
+	}
+}
+
+// FindTerragruntConfigs walks root for terragrunt.hcl files of workspaces.
+// Root configs included by workspaces are skipped.
+func FindTerragruntConfigs(root string) ([]*TerragruntConfig, error) {
+	configs := []*TerragruntConfig{}
+	err := filepath.Walk(root, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if info.IsDir() {
+			if path != root && (info.Name() == terragruntCacheDirectory || strings.HasPrefix(info.Name(), ".")) {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if info.Name() != defaultTerragruntConfigName {
+			return nil
+		}
+		terragruntConfig, err := ReadTerragruntConfig(filepath.Dir(path))
+		if err != nil {
+			return err
+		}
+		configs = append(configs, terragruntConfig)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	included := map[string]bool{}
+	for _, terragruntConfig := range configs {
+		for _, include := range terragruntConfig.Includes {
+			included[filepath.Clean(include)] = true
+		}
+	}
+	workspaceConfigs := []*TerragruntConfig{}
+	for _, terragruntConfig := range configs {
+		if !included[filepath.Join(terragruntConfig.Path, defaultTerragruntConfigName)] {
+			workspaceConfigs = append(workspaceConfigs, terragruntConfig)
+		}
+	}
+	sort.Slice(workspaceConfigs, func(i, j int) bool {
+		return workspaceConfigs[i].Path < workspaceConfigs[j].Path
+	})
+	return workspaceConfigs, nil
+}
+
+// SplitModuleSource splits terraform source into module location and the
+// ref query parameter.
+func SplitModuleSource(source string) (string, string) {
+	i := strings.LastIndex(source, "?")
+	if i < 0 {
+		return source, ""
+	}
+	query, err := url.ParseQuery(source[i+1:])
+	if err != nil {
+		return source, ""
+	}
+	ref := query.Get("ref")
+	query.Del("ref")
+	if len(query) == 0 {
+		return source[:i], ref
+	}
+	return source[:i] + "?" + query.Encode(), ref
+}
+
+// Workspace describes workspace found in the live tree.
+type Workspace struct {
+	Path       string `json:"path"`
+	Source     string `json:"source"`
+	Ref        string `json:"ref"`
+	CiWorkflow bool   `json:"ci_workflow"`
+}
+
+// ListWorkspaces returns workspaces found under root. CI workflows are
+// looked up in ciPath.
+func ListWorkspaces(root, ciPath string) ([]*Workspace, error) {
+	configs, err := FindTerragruntConfigs(root)
+	if err != nil {
+		return nil, err
+	}
+	workspaces := []*Workspace{}
+	for _, terragruntConfig := range configs {
+		source, ref := SplitModuleSource(terragruntConfig.Source)
+		workspace := &Workspace{
+			Path:   terragruntConfig.Path,
+			Source: source,
+			Ref:    ref,
+		}
+		if _, err := os.Stat(WorkspaceCIFilePath(ciPath, terragruntConfig.Path)); err == nil {
+			workspace.CiWorkflow = true
+		} else if !os.IsNotExist(err) {
+			return nil, err
+		}
+		workspaces = append(workspaces, workspace)
+	}
+	return workspaces, nil
+}
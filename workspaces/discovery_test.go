@@ -0,0 +1,204 @@
+package workspaces
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// writeTree creates files with given content under root.
+func writeTree(t *testing.T, root string, files map[string]string) {
+	t.Helper()
+	for name, content := range files {
+		path := filepath.Join(root, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatalf("failed to create %s: %s", filepath.Dir(path), err)
+		}
+		if err := ioutil.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatalf("failed to write %s: %s", path, err)
+		}
+	}
+}
+
+func TestReadTerragruntConfig(t *testing.T) {
+	root := t.TempDir()
+	writeTree(t, root, map[string]string{
+		"live/terragrunt.hcl": `remote_state {}`,
+		"live/env.hcl":        `locals { env = "prod" }`,
+	})
+	tests := []struct {
+		name     string
+		config   string
+		expected *TerragruntConfig
+	}{
+		{
+			name: "labeled include and dependencies",
+			config: `
+include "root" {
+  path = find_in_parent_folders()
+}
+include "env" {
+  path = find_in_parent_folders("env.hcl")
+}
+locals {
+  env    = read_terragrunt_config(find_in_parent_folders("env.hcl"))
+  common = read_terragrunt_config("${get_parent_terragrunt_dir()}/common.hcl")
+  region = try(read_terragrunt_config("../region.hcl").locals.region, "eu-west-1")
+}
+terraform {
+  source = "git::git@github.com:org/repo.git//modules/vpc?ref=v1.2.0"
+}
+dependency "network" {
+  config_path = "../network"
+}
+dependencies {
+  paths = [
+    "../network",
+    "../dns",
+  ]
+}
+`,
+			expected: &TerragruntConfig{
+				Source:       "git::git@github.com:org/repo.git//modules/vpc?ref=v1.2.0",
+				Includes:     []string{filepath.Join(root, "live", "terragrunt.hcl"), filepath.Join(root, "live", "env.hcl")},
+				Reads:        []string{filepath.Join(root, "live", "env.hcl"), "${get_parent_terragrunt_dir()}/common.hcl", filepath.Join(root, "live", "prod", "region.hcl")},
+				Dependencies: []string{"../network", "../dns"},
+			},
+		},
+		{
+			name: "heredocs and nested braces in templates",
+			config: `
+locals {
+  script = <<-EOT
+    terraform {
+      source = "../../wrong//module"
+    }
+  EOT
+  name = "${upper("{")}-${join(",", [for s in ["a"] : "{${s}}"])}"
+}
+terraform {
+  # source = "../../commented//module"
+  source = "${get_parent_terragrunt_dir()}/../modules//app"
+  extra_arguments "vars" {
+    commands  = ["plan"]
+    arguments = ["-var", "a={b}"]
+  }
+}
+/* dependencies { paths = ["../commented"] } */
+dependencies { paths = ["../vpc"] }
+`,
+			expected: &TerragruntConfig{
+				Source:       "${get_parent_terragrunt_dir()}/../modules//app",
+				Includes:     []string{},
+				Reads:        []string{},
+				Dependencies: []string{"../vpc"},
+			},
+		},
+		{
+			name: "expressions which are not constant",
+			config: `
+terraform {
+  source = local.source
+}
+dependencies {
+  paths = concat(local.paths, ["../vpc"])
+}
+dependency "dns" {
+  config_path = "../${local.env}/dns"
+}
+`,
+			expected: &TerragruntConfig{
+				Source:       "${local.source}",
+				Includes:     []string{},
+				Reads:        []string{},
+				Dependencies: []string{"../${local.env}/dns", `${concat(local.paths, ["../vpc"])}`},
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := filepath.Join(root, "live", "prod", strings.Replace(tt.name, " ", "-", -1))
+			writeTree(t, dir, map[string]string{defaultTerragruntConfigName: tt.config})
+
+			terragruntConfig, err := ReadTerragruntConfig(dir)
+			if err != nil {
+				t.Fatalf("unexpected error: %s", err)
+			}
+			tt.expected.Path = dir
+			for i, dependency := range tt.expected.Dependencies {
+				tt.expected.Dependencies[i] = resolveConfigPath(dir, dependency)
+			}
+			if !reflect.DeepEqual(terragruntConfig, tt.expected) {
+				t.Fatalf("expected %+v, got %+v", tt.expected, terragruntConfig)
+			}
+		})
+	}
+}
+
+func TestReadTerragruntConfigErrors(t *testing.T) {
+	tests := []struct {
+		name   string
+		config string
+		err    string
+	}{
+		{name: "unclosed block", config: "terraform {\n  source = \"../vpc\"\n", err: "terragrunt.hcl:3"},
+		{name: "unterminated string", config: "terraform {\n  source = \"../vpc\n}\n", err: "terragrunt.hcl:2"},
+		{name: "unterminated heredoc", config: "locals {\n  a = <<EOT\n  b\n}\n", err: "Unterminated template string"},
+		{name: "missing include", config: "include {\n  path = find_in_parent_folders(\"missing.hcl\")\n}\n", err: "missing.hcl not found"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			writeTree(t, dir, map[string]string{defaultTerragruntConfigName: tt.config})
+			_, err := ReadTerragruntConfig(dir)
+			if err == nil || !strings.Contains(err.Error(), tt.err) {
+				t.Fatalf("expected error containing %q, got %v", tt.err, err)
+			}
+		})
+	}
+}
+
+func TestFindTerragruntConfigs(t *testing.T) {
+	root := t.TempDir()
+	writeTree(t, root, map[string]string{
+		"live/terragrunt.hcl":                                `remote_state {}`,
+		"live/prod/vpc/terragrunt.hcl":                       "include {\n  path = find_in_parent_folders()\n}\n",
+		"live/prod/app/terragrunt.hcl":                       "dependency \"vpc\" {\n  config_path = \"../vpc\"\n}\n",
+		"live/prod/app/.terragrunt-cache/x/terragrunt.hcl":   `invalid {`,
+		"live/prod/.hidden/terragrunt.hcl":                   `invalid {`,
+		"live/prod/vpc/.terragrunt-cache/y/z/terragrunt.hcl": `invalid {`,
+	})
+	configs, err := FindTerragruntConfigs(filepath.Join(root, "live"))
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	paths := []string{}
+	for _, terragruntConfig := range configs {
+		paths = append(paths, terragruntConfig.Path)
+	}
+	expected := []string{filepath.Join(root, "live", "prod", "app"), filepath.Join(root, "live", "prod", "vpc")}
+	if !reflect.DeepEqual(paths, expected) {
+		t.Fatalf("expected %v, got %v", expected, paths)
+	}
+}
+
+func TestSplitModuleSource(t *testing.T) {
+	tests := []struct {
+		source string
+		module string
+		ref    string
+	}{
+		{source: "git::git@github.com:org/repo.git//modules/vpc?ref=v1.2.0", module: "git::git@github.com:org/repo.git//modules/vpc", ref: "v1.2.0"},
+		{source: "git::https://github.com/org/repo.git//vpc?depth=1&ref=main", module: "git::https://github.com/org/repo.git//vpc?depth=1", ref: "main"},
+		{source: "../../modules//vpc", module: "../../modules//vpc"},
+	}
+	for _, tt := range tests {
+		module, ref := SplitModuleSource(tt.source)
+		if module != tt.module || ref != tt.ref {
+			t.Errorf("expected %s %s for %s, got %s %s", tt.module, tt.ref, tt.source, module, ref)
+		}
+	}
+}
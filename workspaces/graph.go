@@ -0,0 +1,176 @@
+package workspaces
+
+import (
+	"fmt"
+	"io"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+const (
+	GraphNodeWorkspace = "workspace"
+	GraphNodeModule    = "module"
+
+	GraphEdgeDependency = "dependency"
+	GraphEdgeModule     = "module"
+)
+
+type GraphNode struct {
+	Id          string `json:"id"`
+	Kind        string `json:"kind"`
+	Highlighted bool   `json:"highlighted"`
+}
+
+type GraphEdge struct {
+	From string `json:"from"`
+	To   string `json:"to"`
+	Kind string `json:"kind"`
+	Ref  string `json:"ref,omitempty"`
+}
+
+// target returns kind of node the edge points to. Edges always start at
+// workspace.
+func (e *GraphEdge) target() string {
+	if e.Kind == GraphEdgeModule {
+		return GraphNodeModule
+	}
+	return GraphNodeWorkspace
+}
+
+// WorkspaceGraph holds dependencies between workspaces and modules used
+// by them. Workspace and module may have the same id, for example when
+// workspace directory is used as module source, so nodes are identified
+// by kind and id.
+type WorkspaceGraph struct {
+	Nodes []*GraphNode `json:"nodes"`
+	Edges []*GraphEdge `json:"edges"`
+	nodes map[string]*GraphNode
+}
+
+func graphNodeKey(kind, id string) string {
+	return kind + ":" + id
+}
+
+func (g *WorkspaceGraph) addNode(id, kind string) {
+	key := graphNodeKey(kind, id)
+	if _, ok := g.nodes[key]; ok {
+		return
+	}
+	node := &GraphNode{Id: id, Kind: kind}
+	g.nodes[key] = node
+	g.Nodes = append(g.Nodes, node)
+}
+
+// NewWorkspaceGraph builds graph of workspaces. Modules are identified by
+// their directory in the repository when it can be determined, otherwise
+// by the source without ref.
+func NewWorkspaceGraph(configs []*TerragruntConfig, repoRoot string) *WorkspaceGraph {
+	graph := &WorkspaceGraph{
+		Nodes: []*GraphNode{},
+		Edges: []*GraphEdge{},
+		nodes: map[string]*GraphNode{},
+	}
+	for _, terragruntConfig := range configs {
+		graph.addNode(terragruntConfig.Path, GraphNodeWorkspace)
+	}
+	for _, terragruntConfig := range configs {
+		for _, dependency := range terragruntConfig.Dependencies {
+			graph.addNode(dependency, GraphNodeWorkspace)
+			graph.Edges = append(graph.Edges, &GraphEdge{
+				From: terragruntConfig.Path,
+				To:   dependency,
+				Kind: GraphEdgeDependency,
+			})
+		}
+		if terragruntConfig.Source == "" {
+			continue
+		}
+		source, ref := SplitModuleSource(terragruntConfig.Source)
+		module := ModuleDirectory(terragruntConfig, repoRoot)
+		if module == "" {
+			module = source
+		}
+		graph.addNode(module, GraphNodeModule)
+		graph.Edges = append(graph.Edges, &GraphEdge{
+			From: terragruntConfig.Path,
+			To:   module,
+			Kind: GraphEdgeModule,
+			Ref:  ref,
+		})
+	}
+	sort.Slice(graph.Nodes, func(i, j int) bool {
+		if graph.Nodes[i].Kind != graph.Nodes[j].Kind {
+			return graph.Nodes[i].Kind == GraphNodeWorkspace
+		}
+		return graph.Nodes[i].Id < graph.Nodes[j].Id
+	})
+	sort.SliceStable(graph.Edges, func(i, j int) bool {
+		if graph.Edges[i].From != graph.Edges[j].From {
+			return graph.Edges[i].From < graph.Edges[j].From
+		}
+		return graph.Edges[i].To < graph.Edges[j].To
+	})
+	return graph
+}
+
+// Highlight marks workspace and module nodes with given ids. Ids which
+// are not part of the graph are returned.
+func (g *WorkspaceGraph) Highlight(ids []string) []string {
+	missing := []string{}
+	for _, id := range ids {
+		found := false
+		for _, kind := range []string{GraphNodeWorkspace, GraphNodeModule} {
+			if node, ok := g.nodes[graphNodeKey(kind, filepath.Clean(id))]; ok {
+				node.Highlighted = true
+				found = true
+			}
+		}
+		if !found {
+			missing = append(missing, id)
+		}
+	}
+	return missing
+}
+
+func dotQuote(value string) string {
+	return `"` + strings.NewReplacer(`\`, `\\`, `"`, `\"`).Replace(value) + `"`
+}
+
+// WriteDot writes the graph in graphviz DOT format. Workspaces are boxes,
+// modules ellipses and highlighted nodes are filled. DOT node names are
+// prefixed with kind, and labeled with id.
+func (g *WorkspaceGraph) WriteDot(out io.Writer) error {
+	var dot strings.Builder
+	dot.WriteString("digraph workspaces {\n")
+	dot.WriteString("  rankdir=LR;\n")
+	for _, node := range g.Nodes {
+		attributes := []string{"label=" + dotQuote(node.Id), "shape=box"}
+		if node.Kind == GraphNodeModule {
+			attributes[1] = "shape=ellipse"
+		}
+		if node.Highlighted {
+			attributes = append(attributes, "style=filled", "fillcolor=orange")
+		}
+		fmt.Fprintf(&dot, "  %s [%s];\n", dotQuote(graphNodeKey(node.Kind, node.Id)), strings.Join(attributes, ", "))
+	}
+	for _, edge := range g.Edges {
+		attributes := []string{}
+		if edge.Kind == GraphEdgeModule {
+			attributes = append(attributes, "style=dashed")
+		}
+		if edge.Ref != "" {
+			attributes = append(attributes, "label="+dotQuote(edge.Ref))
+		}
+		suffix := ""
+		if len(attributes) > 0 {
+			suffix = " [" + strings.Join(attributes, ", ") + "]"
+		}
+		fmt.Fprintf(&dot, "  %s -> %s%s;\n",
+			dotQuote(graphNodeKey(GraphNodeWorkspace, edge.From)),
+			dotQuote(graphNodeKey(edge.target(), edge.To)), suffix)
+	}
+	dot.WriteString("}\n")
+	_, err := io.WriteString(out, dot.String())
+	return err
+}
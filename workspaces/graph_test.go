@@ -0,0 +1,89 @@
+package workspaces
+
+import (
+	"bytes"
+	"encoding/json"
+	"flag"
+	"io/ioutil"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+var update = flag.Bool("update", false, "update golden files")
+
+func TestWorkspaceGraph(t *testing.T) {
+	tests := []struct {
+		name      string
+		configs   []*TerragruntConfig
+		highlight []string
+		missing   []string
+	}{
+		{
+			name: "workspaces",
+			configs: []*TerragruntConfig{
+				{Path: "live/prod/vpc", Source: "../../../modules//vpc"},
+				{Path: "live/prod/app", Source: "git::git@github.com:org/repo.git//modules/app?ref=v1.2.0", Dependencies: []string{"live/prod/vpc"}},
+				{Path: "live/dev/app", Source: "git::git@github.com:org/repo.git//modules/app?ref=v1.3.0", Dependencies: []string{"live/dev/vpc"}},
+				{Path: "live/_global/iam"},
+			},
+			highlight: []string{"live/prod/vpc/", "modules/app", "live/missing"},
+			missing:   []string{"live/missing"},
+		},
+		{
+			name: "shared id",
+			configs: []*TerragruntConfig{
+				{Path: "live/shared"},
+				{Path: "live/app", Source: "../shared", Dependencies: []string{"live/shared"}},
+			},
+			highlight: []string{"live/shared"},
+			missing:   []string{},
+		},
+		{
+			name: "quoting",
+			configs: []*TerragruntConfig{
+				{Path: `live/"quoted"\dir`, Source: `git::https://example.com/repo.git//modules/a"b?ref=v"1\`},
+				{Path: "live/app", Dependencies: []string{`live/"quoted"\dir`}},
+			},
+			highlight: []string{`live/"quoted"\dir`},
+			missing:   []string{},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			graph := NewWorkspaceGraph(tt.configs, ".")
+			if missing := graph.Highlight(tt.highlight); !reflect.DeepEqual(missing, tt.missing) {
+				t.Fatalf("expected missing %v, got %v", tt.missing, missing)
+			}
+
+			var dot bytes.Buffer
+			if err := graph.WriteDot(&dot); err != nil {
+				t.Fatalf("unexpected error: %s", err)
+			}
+			var jsonOut bytes.Buffer
+			encoder := json.NewEncoder(&jsonOut)
+			encoder.SetIndent("", "  ")
+			if err := encoder.Encode(graph); err != nil {
+				t.Fatalf("unexpected error: %s", err)
+			}
+
+			name := "graph-" + strings.Replace(tt.name, " ", "-", -1)
+			for extension, out := range map[string]*bytes.Buffer{"dot": &dot, "json": &jsonOut} {
+				golden := filepath.Join("testdata", name+"."+extension+".golden")
+				if *update {
+					if err := ioutil.WriteFile(golden, out.Bytes(), 0644); err != nil {
+						t.Fatalf("failed to update %s: %s", golden, err)
+					}
+				}
+				expected, err := ioutil.ReadFile(golden)
+				if err != nil {
+					t.Fatalf("failed to read %s: %s", golden, err)
+				}
+				if !bytes.Equal(out.Bytes(), expected) {
+					t.Fatalf("output does not match %s, expected\n%s\ngot\n%s", golden, expected, out.String())
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,85 @@
+package workspaces
+
+import (
+	"strings"
+
+	"github.com/hashicorp/hcl/v2"
+	"github.com/hashicorp/hcl/v2/hclsyntax"
+	"github.com/zclconf/go-cty/cty"
+)
+
+// Terragrunt configuration is parsed with the HCL native syntax parser,
+// the same way terragrunt parses it, but expressions are not evaluated
+// with terragrunt functions. Expressions which are not constant are kept
+// as written, e.g. "${get_parent_terragrunt_dir()}/modules//vpc", so they
+// are reported instead of being dropped.
+
+// hclFile is parsed terragrunt configuration.
+type hclFile struct {
+	Body *hclsyntax.Body
+	data []byte
+}
+
+func parseHcl(data []byte, filename string) (*hclFile, error) {
+	file, diags := hclsyntax.ParseConfig(data, filename, hcl.Pos{Line: 1, Column: 1})
+	if diags.HasErrors() {
+		return nil, diags
+	}
+	return &hclFile{
+		Body: file.Body.(*hclsyntax.Body),
+		data: data,
+	}, nil
+}
+
+// BlocksOfType returns blocks of body with given type.
+func BlocksOfType(body *hclsyntax.Body, blockType string) []*hclsyntax.Block {
+	blocks := []*hclsyntax.Block{}
+	for _, block := range body.Blocks {
+		if block.Type == blockType {
+			blocks = append(blocks, block)
+		}
+	}
+	return blocks
+}
+
+// source returns text of the expression as written in the file.
+func (f *hclFile) source(expr hclsyntax.Expression) string {
+	return string(expr.Range().SliceBytes(f.data))
+}
+
+// String returns value of constant string expression. Other expressions
+// are returned as written, templates without quotes and any other
+// expression as interpolation.
+func (f *hclFile) String(expr hclsyntax.Expression) string {
+	value, diags := expr.Value(nil)
+	if !diags.HasErrors() && value.Type() == cty.String && value.IsKnown() && !value.IsNull() {
+		return value.AsString()
+	}
+	source := f.source(expr)
+	if _, ok := expr.(*hclsyntax.TemplateExpr); ok && strings.HasPrefix(source, `"`) {
+		return strings.TrimSuffix(strings.TrimPrefix(source, `"`), `"`)
+	}
+	return "${" + source + "}"
+}
+
+// Strings returns items of list expression as strings.
+func (f *hclFile) Strings(expr hclsyntax.Expression) []string {
+	values := []string{}
+	tuple, ok := expr.(*hclsyntax.TupleConsExpr)
+	if !ok {
+		return append(values, f.String(expr))
+	}
+	for _, item := range tuple.Exprs {
+		values = append(values, f.String(item))
+	}
+	return values
+}
+
+// Attribute returns string value of attribute of body, if it is set.
+func (f *hclFile) Attribute(body *hclsyntax.Body, name string) (string, bool) {
+	attribute, ok := body.Attributes[name]
+	if !ok {
+		return "", false
+	}
+	return f.String(attribute.Expr), true
+}
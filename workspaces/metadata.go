@@ -0,0 +1,234 @@
+package workspaces
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/p0tr3c/terra-ci/config"
+)
+
+const (
+	planMetadataSuffix = ".terra-ci.json"
+)
+
+// PlanMetadata records where the plan was produced from, so apply can
+// refuse plans which no longer match the workspace. Uncommitted changes
+// are recorded as sha256 of their diff, empty when there are none.
+type PlanMetadata struct {
+	Commit              string    `json:"commit"`
+	ChangesSha256       string    `json:"changes_sha256"`
+	Path                string    `json:"path"`
+	Source              string    `json:"source"`
+	SourceCommit        string    `json:"source_commit"`
+	SourceChangesSha256 string    `json:"source_changes_sha256"`
+	Version             string    `json:"version"`
+	Timestamp           time.Time `json:"timestamp"`
+}
+
+// PlanMetadataPath returns path of metadata file stored next to the plan.
+// Relative plans are resolved against the workspace.
+func PlanMetadataPath(executionInput *WorkspaceExecutionInput) (string, error) {
+	planPath := executionInput.OutPlan
+	if !filepath.IsAbs(planPath) {
+		workspaceAbsPath, err := filepath.Abs(executionInput.Path)
+		if err != nil {
+			return "", err
+		}
+		planPath = filepath.Join(workspaceAbsPath, planPath)
+	}
+	return planPath + planMetadataSuffix, nil
+}
+
+// gitState returns commit checked out in dir and sha256 of uncommitted
+// changes of tracked files under paths, empty when there are none. Paths
+// outside of the repository are ignored. Directories outside of git
+// repository have no commit.
+func gitState(dir string, paths ...string) (string, string, error) {
+	if _, err := runGit(dir, "rev-parse", "--is-inside-work-tree"); err != nil {
+		return "", "", nil
+	}
+	commit, err := runGit(dir, "rev-parse", "HEAD")
+	if err != nil {
+		return "", "", err
+	}
+	cdup, err := runGit(dir, "rev-parse", "--show-cdup")
+	if err != nil {
+		return "", "", err
+	}
+	absDir, err := filepath.Abs(dir)
+	if err != nil {
+		return "", "", err
+	}
+	repoRoot := filepath.Join(absDir, cdup)
+	// Untracked files, such as the plan itself, do not affect the plan
+	pathspecs := []string{}
+	for _, path := range paths {
+		absPath, err := filepath.Abs(path)
+		if err != nil {
+			return "", "", err
+		}
+		if isUnder(absPath, repoRoot) {
+			pathspecs = append(pathspecs, absPath)
+		}
+	}
+	if len(pathspecs) == 0 {
+		return commit, "", nil
+	}
+	diff, err := runGit(dir, append([]string{"diff", "HEAD", "--no-color", "--no-ext-diff", "--"}, pathspecs...)...)
+	if err != nil || diff == "" {
+		return commit, "", err
+	}
+	sum := sha256.Sum256([]byte(diff))
+	return commit, hex.EncodeToString(sum[:]), nil
+}
+
+// workspaceInputs returns paths the plan of the workspace depends on, the
+// workspace itself, configs it includes or reads and its module directory.
+func workspaceInputs(workspacePath, repoRoot string) ([]string, error) {
+	terragruntConfig, err := ReadTerragruntConfig(workspacePath)
+	if err != nil {
+		return nil, err
+	}
+	inputs := append([]string{workspacePath}, terragruntConfig.Includes...)
+	inputs = append(inputs, terragruntConfig.Reads...)
+	if moduleDirectory := ModuleDirectory(terragruntConfig, repoRoot); moduleDirectory != "" {
+		inputs = append(inputs, moduleDirectory)
+	}
+	return inputs, nil
+}
+
+// NewPlanMetadata describes current state of the workspace, the configs
+// and module it uses, and its terragrunt source.
+func NewPlanMetadata(executionInput *WorkspaceExecutionInput) (*PlanMetadata, error) {
+	workspaceAbsPath, err := filepath.Abs(executionInput.Path)
+	if err != nil {
+		return nil, err
+	}
+	path := filepath.ToSlash(filepath.Clean(executionInput.Path))
+	inputs := []string{workspaceAbsPath}
+	if repoRoot, err := runGit(workspaceAbsPath, "rev-parse", "--show-toplevel"); err == nil {
+		if relPath, err := filepath.Rel(repoRoot, workspaceAbsPath); err == nil {
+			path = filepath.ToSlash(relPath)
+		}
+		inputs, err = workspaceInputs(workspaceAbsPath, repoRoot)
+		if err != nil {
+			return nil, err
+		}
+	}
+	commit, changes, err := gitState(workspaceAbsPath, inputs...)
+	if err != nil {
+		return nil, err
+	}
+	metadata := &PlanMetadata{
+		Commit:        commit,
+		ChangesSha256: changes,
+		Path:          path,
+		Source:        executionInput.LocalModules,
+		Version:       config.Version,
+		Timestamp:     time.Now().UTC(),
+	}
+	if executionInput.LocalModules != "" {
+		// Terragrunt sources reference module directory with //
+		sourceDir := strings.SplitN(executionInput.LocalModules, "//", 2)[0]
+		metadata.SourceCommit, metadata.SourceChangesSha256, err = gitState(sourceDir, sourceDir)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return metadata, nil
+}
+
+func WritePlanMetadata(executionInput *WorkspaceExecutionInput) error {
+	metadata, err := NewPlanMetadata(executionInput)
+	if err != nil {
+		return err
+	}
+	metadataPath, err := PlanMetadataPath(executionInput)
+	if err != nil {
+		return err
+	}
+	data, err := json.MarshalIndent(metadata, "", "  ")
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(metadataPath, data, defaultFilePermMode)
+}
+
+func ReadPlanMetadata(executionInput *WorkspaceExecutionInput) (*PlanMetadata, error) {
+	metadataPath, err := PlanMetadataPath(executionInput)
+	if err != nil {
+		return nil, err
+	}
+	data, err := ioutil.ReadFile(metadataPath)
+	if err != nil {
+		return nil, err
+	}
+	var metadata PlanMetadata
+	if err := json.Unmarshal(data, &metadata); err != nil {
+		return nil, err
+	}
+	return &metadata, nil
+}
+
+// Diff returns differences between metadata of the plan and current state
+// of the workspace. Version and timestamp are informational only.
+func (m *PlanMetadata) Diff(current *PlanMetadata) []string {
+	diff := []string{}
+	compare := func(field, planned, current string) {
+		if planned != current {
+			diff = append(diff, fmt.Sprintf("%s: %q -> %q", field, planned, current))
+		}
+	}
+	compare("commit", m.Commit, current.Commit)
+	compare("changes_sha256", m.ChangesSha256, current.ChangesSha256)
+	compare("path", m.Path, current.Path)
+	compare("source", m.Source, current.Source)
+	compare("source_commit", m.SourceCommit, current.SourceCommit)
+	compare("source_changes_sha256", m.SourceChangesSha256, current.SourceChangesSha256)
+	return diff
+}
+
+// StalePlanError is returned by apply of plan which does not match the
+// current state of the workspace.
+type StalePlanError struct {
+	Plan string
+	Diff []string
+}
+
+func (e *StalePlanError) Error() string {
+	return fmt.Sprintf("plan %s is stale, use --force-stale-plan to apply it anyway:\n  %s",
+		e.Plan, strings.Join(e.Diff, "\n  "))
+}
+
+// VerifyPlanMetadata fails unless the plan was produced from the current
+// state of the workspace.
+func VerifyPlanMetadata(executionInput *WorkspaceExecutionInput) error {
+	planned, err := ReadPlanMetadata(executionInput)
+	if os.IsNotExist(err) {
+		return &StalePlanError{
+			Plan: executionInput.OutPlan,
+			Diff: []string{"no metadata recorded for the plan"},
+		}
+	}
+	if err != nil {
+		return err
+	}
+	current, err := NewPlanMetadata(executionInput)
+	if err != nil {
+		return err
+	}
+	if diff := planned.Diff(current); len(diff) > 0 {
+		return &StalePlanError{
+			Plan: executionInput.OutPlan,
+			Diff: diff,
+		}
+	}
+	return nil
+}
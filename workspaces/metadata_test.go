@@ -0,0 +1,152 @@
+package workspaces
+
+import (
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+var testMetadataTree = map[string]string{
+	"live/terragrunt.hcl":          `remote_state {}`,
+	"live/prod/vpc/terragrunt.hcl": "include {\n  path = find_in_parent_folders()\n}\nterraform {\n  source = \"../../../modules//vpc\"\n}\n",
+	"live/prod/vpc/inputs.hcl":     `locals {}`,
+	"modules/vpc/main.tf":          `# vpc`,
+	"docs/README.md":               `# docs`,
+}
+
+// newMetadataRepository creates repository with workspace live/prod/vpc
+// committed on main branch.
+func newMetadataRepository(t *testing.T) string {
+	t.Helper()
+	dir := t.TempDir()
+	testGit(t, dir, "init", "-q")
+	testGit(t, dir, "checkout", "-q", "-b", "main")
+	writeTree(t, dir, testMetadataTree)
+	testGit(t, dir, "add", "-A")
+	testGit(t, dir, "commit", "-q", "-m", "base")
+	return dir
+}
+
+func TestNewPlanMetadata(t *testing.T) {
+	repo := newMetadataRepository(t)
+	executionInput := &WorkspaceExecutionInput{Path: filepath.Join(repo, "live", "prod", "vpc")}
+	metadata, err := NewPlanMetadata(executionInput)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if commit := testGit(t, repo, "rev-parse", "HEAD"); metadata.Commit != commit {
+		t.Fatalf("expected commit %s, got %s", commit, metadata.Commit)
+	}
+	if metadata.Path != "live/prod/vpc" || metadata.ChangesSha256 != "" {
+		t.Fatalf("unexpected metadata of clean workspace %+v", metadata)
+	}
+
+	writeTree(t, repo, map[string]string{"live/prod/vpc/inputs.hcl": `locals { a = 1 }`})
+	dirty, err := NewPlanMetadata(executionInput)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if len(dirty.ChangesSha256) != 64 {
+		t.Fatalf("expected changes of dirty workspace to be recorded, got %+v", dirty)
+	}
+
+	outside := t.TempDir()
+	writeTree(t, outside, map[string]string{defaultTerragruntConfigName: ""})
+	metadata, err = NewPlanMetadata(&WorkspaceExecutionInput{Path: outside, LocalModules: outside + "//vpc"})
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if metadata.Commit != "" || metadata.ChangesSha256 != "" || metadata.SourceCommit != "" || metadata.Source != outside+"//vpc" {
+		t.Fatalf("unexpected metadata outside of repository %+v", metadata)
+	}
+}
+
+func TestPlanMetadataDiff(t *testing.T) {
+	planned := &PlanMetadata{Commit: "a", Path: "live/prod/vpc", Source: "../modules", SourceCommit: "b", Version: "1.0.0"}
+	tests := []struct {
+		name    string
+		current PlanMetadata
+		diff    []string
+	}{
+		{name: "same", current: *planned, diff: []string{}},
+		{name: "informational", current: PlanMetadata{Commit: "a", Path: "live/prod/vpc", Source: "../modules", SourceCommit: "b", Version: "2.0.0"}, diff: []string{}},
+		{
+			name:    "changed",
+			current: PlanMetadata{Commit: "c", ChangesSha256: "d", Path: "live/dev/vpc", SourceCommit: "b", SourceChangesSha256: "e"},
+			diff: []string{
+				`commit: "a" -> "c"`,
+				`changes_sha256: "" -> "d"`,
+				`path: "live/prod/vpc" -> "live/dev/vpc"`,
+				`source: "../modules" -> ""`,
+				`source_changes_sha256: "" -> "e"`,
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if diff := planned.Diff(&tt.current); !reflect.DeepEqual(diff, tt.diff) {
+				t.Fatalf("expected diff %v, got %v", tt.diff, diff)
+			}
+		})
+	}
+}
+
+func TestVerifyPlanMetadata(t *testing.T) {
+	tests := []struct {
+		name   string
+		before map[string]string
+		after  map[string]string
+		commit bool
+		stale  string
+	}{
+		{name: "unchanged"},
+		{name: "unchanged dirty tree", before: map[string]string{"live/prod/vpc/inputs.hcl": `locals { a = 1 }`}},
+		{
+			name:   "dirty tree edited",
+			before: map[string]string{"live/prod/vpc/inputs.hcl": `locals { a = 1 }`},
+			after:  map[string]string{"live/prod/vpc/inputs.hcl": `locals { a = 2 }`},
+			stale:  "changes_sha256",
+		},
+		{name: "workspace edited", after: map[string]string{"live/prod/vpc/inputs.hcl": `locals { a = 1 }`}, stale: "changes_sha256"},
+		{name: "included config edited", after: map[string]string{"live/terragrunt.hcl": `remote_state { a = 1 }`}, stale: "changes_sha256"},
+		{name: "module edited", after: map[string]string{"modules/vpc/main.tf": `# changed`}, stale: "changes_sha256"},
+		{name: "unrelated file edited", after: map[string]string{"docs/README.md": `# changed`}},
+		{name: "untracked file", after: map[string]string{"live/prod/vpc/notes.txt": `notes`}},
+		{name: "new commit", after: map[string]string{"docs/README.md": `# changed`}, commit: true, stale: "commit"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			repo := newMetadataRepository(t)
+			executionInput := &WorkspaceExecutionInput{
+				Path:    filepath.Join(repo, "live", "prod", "vpc"),
+				OutPlan: "tfplan",
+			}
+			writeTree(t, repo, tt.before)
+			if err := WritePlanMetadata(executionInput); err != nil {
+				t.Fatalf("failed to write metadata: %s", err)
+			}
+			writeTree(t, repo, tt.after)
+			if tt.commit {
+				testGit(t, repo, "commit", "-q", "-a", "-m", "change")
+			}
+
+			err := VerifyPlanMetadata(executionInput)
+			if tt.stale == "" {
+				if err != nil {
+					t.Fatalf("unexpected error: %s", err)
+				}
+				return
+			}
+			staleErr, ok := err.(*StalePlanError)
+			if !ok || len(staleErr.Diff) != 1 || !strings.HasPrefix(staleErr.Diff[0], tt.stale+":") {
+				t.Fatalf("expected stale %s, got %v", tt.stale, err)
+			}
+		})
+	}
+
+	executionInput := &WorkspaceExecutionInput{Path: filepath.Join(newMetadataRepository(t), "live", "prod", "vpc"), OutPlan: "tfplan"}
+	if err := VerifyPlanMetadata(executionInput); err == nil || !strings.Contains(err.Error(), "no metadata recorded") {
+		t.Fatalf("expected plan without metadata to be stale, got %v", err)
+	}
+}
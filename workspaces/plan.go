@@ -0,0 +1,260 @@
+package workspaces
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+
+	"github.com/p0tr3c/terra-ci/artifacts"
+	"github.com/p0tr3c/terra-ci/aws"
+	"github.com/p0tr3c/terra-ci/plans"
+	"github.com/p0tr3c/terra-ci/policy"
+
+	awssdk "github.com/aws/aws-sdk-go/aws"
+)
+
+// ShowLocalPlan returns plan file of the workspace rendered by
+// terragrunt show -json.
+func ShowLocalPlan(executionInput *WorkspaceExecutionInput, outErr io.Writer) ([]byte, error) {
+	shellCommandArgs := []string{
+		"show",
+		"-json",
+		executionInput.OutPlan,
+	}
+	if executionInput.LocalModules != "" {
+		shellCommandArgs = append(shellCommandArgs, []string{
+			"--terragrunt-source",
+			executionInput.LocalModules,
+		}...)
+	}
+	shellCommand := exec.Command("terragrunt", shellCommandArgs...)
+	workspaceAbsPath, err := filepath.Abs(executionInput.Path)
+	if err != nil {
+		return nil, err
+	}
+	var planJson bytes.Buffer
+	shellCommand.Dir = workspaceAbsPath
+	shellCommand.Stdout = &planJson
+	shellCommand.Stderr = outErr
+
+	if err := shellCommand.Run(); err != nil {
+		return nil, err
+	}
+	return planJson.Bytes(), nil
+}
+
+// GetExecutionArtifacts returns artifacts referenced by output of the
+// execution.
+func GetExecutionArtifacts(client *aws.Client, arn string) (*aws.ExecutionOutputArtifacts, error) {
+	execution, err := client.DescribeExecution(arn)
+	if err != nil {
+		return nil, err
+	}
+	if awssdk.StringValue(execution.Output) == "" {
+		return &aws.ExecutionOutputArtifacts{}, nil
+	}
+	output, err := aws.GetCloudwatchLogsReference(execution)
+	if err != nil {
+		return nil, err
+	}
+	return &output.Artifacts, nil
+}
+
+// GetRemotePlan returns plan json artifact referenced by output of the
+// execution, or nil when the build did not produce one.
+func GetRemotePlan(client *aws.Client, arn string) ([]byte, error) {
+	executionArtifacts, err := GetExecutionArtifacts(client, arn)
+	if err != nil {
+		return nil, err
+	}
+	if executionArtifacts.PlanJson == "" {
+		return nil, nil
+	}
+	return client.GetObject(executionArtifacts.PlanJson)
+}
+
+// StoreRemotePlan copies binary plan produced by the execution into the
+// artifact store and returns its reference, or nil when the build did not
+// produce plan. Plan json is stored next to the plan and its checksum is
+// part of the reference, so remote apply of the reference can be checked
+// before it starts.
+func StoreRemotePlan(executionInput *WorkspaceExecutionInput) (*artifacts.Ref, error) {
+	executionArtifacts, err := GetExecutionArtifacts(executionInput.Client, executionInput.ExecutionArn)
+	if err != nil {
+		return nil, err
+	}
+	if executionArtifacts.Plan == "" {
+		return nil, nil
+	}
+	plan, err := executionInput.Client.GetObject(executionArtifacts.Plan)
+	if err != nil {
+		return nil, err
+	}
+	key, err := artifacts.PlanKey(executionInput.Path, executionInput.ExecutionArn)
+	if err != nil {
+		return nil, err
+	}
+	if executionArtifacts.PlanJson == "" {
+		return artifacts.Put(executionInput.ArtifactStore, key, plan)
+	}
+	planJson, err := executionInput.Client.GetObject(executionArtifacts.PlanJson)
+	if err != nil {
+		return nil, err
+	}
+	return artifacts.PutPlan(executionInput.ArtifactStore, key, plan, planJson)
+}
+
+// GetStoredPlan returns parsed plan json stored next to referenced plan.
+func GetStoredPlan(ref *artifacts.Ref, client *aws.Client) (*plans.Plan, error) {
+	planJson, err := artifacts.GetPlanJson(ref, client)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read plan json of %s: %s", ref.Location, err.Error())
+	}
+	return plans.ParsePlan(planJson)
+}
+
+// VerifyPlanRef checks that plan referenced by PlanRef was not modified
+// since it was stored, and can be fetched by remote execution.
+func VerifyPlanRef(executionInput *WorkspaceExecutionInput) (*artifacts.Ref, error) {
+	ref, err := artifacts.ParseRef(executionInput.PlanRef)
+	if err != nil {
+		return nil, err
+	}
+	if !strings.HasPrefix(ref.Location, "s3://") {
+		return nil, fmt.Errorf("plan %s is not accessible by remote execution, use s3 artifact store", ref.Location)
+	}
+	if _, err := artifacts.GetRef(ref, executionInput.Client); err != nil {
+		return nil, err
+	}
+	return ref, nil
+}
+
+// GetPlan returns parsed plan of finished plan action, or nil when there
+// is no plan to show. Local plans are only shown when saved with --out.
+func GetPlan(executionInput *WorkspaceExecutionInput, outErr io.Writer) (*plans.Plan, error) {
+	var planJson []byte
+	var err error
+	if executionInput.Local {
+		if executionInput.OutPlan == "" {
+			return nil, nil
+		}
+		planJson, err = ShowLocalPlan(executionInput, outErr)
+	} else {
+		planJson, err = GetRemotePlan(executionInput.Client, executionInput.ExecutionArn)
+	}
+	if err != nil || planJson == nil {
+		return nil, err
+	}
+	return plans.ParsePlan(planJson)
+}
+
+// PlanWorkspaceWithOutput runs plan action and prints summary of planned
+// changes. With DetailedExitCode PlanChangesError is returned when the
+// plan has changes.
+func PlanWorkspaceWithOutput(executionInput *WorkspaceExecutionInput, in io.Reader, out, outErr io.Writer) (*plans.Summary, error) {
+	if executionInput.ReportMarkdown != "" && executionInput.Local && executionInput.OutPlan == "" {
+		return nil, fmt.Errorf("--report-markdown requires plan saved with --out")
+	}
+	err := ExecuteWorkspaceWithOutput(executionInput, in, out, outErr)
+	var planChanges *PlanChangesError
+	if err != nil && !errors.As(err, &planChanges) {
+		return nil, err
+	}
+	if executionInput.PrintInput {
+		return nil, nil
+	}
+
+	plan, planErr := GetPlan(executionInput, outErr)
+	if planErr != nil {
+		return nil, planErr
+	}
+	if plan == nil {
+		if (executionInput.DetailedExitCode || executionInput.ReportMarkdown != "") && !executionInput.Local {
+			return nil, fmt.Errorf("execution %s produced no plan artifact", executionInput.ExecutionArn)
+		}
+		return nil, err
+	}
+	summary := plan.Summary()
+	if !executionInput.Local && executionInput.ArtifactStore != nil {
+		ref, refErr := StoreRemotePlan(executionInput)
+		if refErr != nil {
+			return nil, refErr
+		}
+		if ref != nil {
+			summary.Ref = ref.String()
+		}
+	}
+	if summaryErr := plans.PrintSummary(out, summary); summaryErr != nil {
+		return nil, summaryErr
+	}
+	if summary.Ref != "" {
+		fmt.Fprintf(out, "plan stored, apply it with: terra-ci workspace apply --path %s --plan-ref %s\n", executionInput.Path, summary.Ref)
+	}
+	if executionInput.ReportMarkdown != "" {
+		if reportErr := WritePlanReport(executionInput, plan); reportErr != nil {
+			return nil, reportErr
+		}
+		fmt.Fprintf(out, "plan report written to %s\n", executionInput.ReportMarkdown)
+	}
+	if executionInput.DetailedExitCode && summary.HasChanges() {
+		return summary, &PlanChangesError{Path: executionInput.Path}
+	}
+	return summary, err
+}
+
+// WritePlanReport writes markdown report of the plan into ReportMarkdown
+// file. Remote reports link the execution.
+func WritePlanReport(executionInput *WorkspaceExecutionInput, plan *plans.Plan) error {
+	report := &plans.MarkdownReport{
+		Path: executionInput.Path,
+		Plan: plan,
+	}
+	if !executionInput.Local {
+		report.ExecutionArn = executionInput.ExecutionArn
+		report.ExecutionUrl = aws.ExecutionConsoleUrl(executionInput.ExecutionArn)
+	}
+	file, err := os.Create(executionInput.ReportMarkdown)
+	if err != nil {
+		return err
+	}
+	if err := plans.RenderMarkdown(file, report); err != nil {
+		file.Close()
+		return err
+	}
+	return file.Close()
+}
+
+// CheckRemotePlanPolicy evaluates policy against plan applied by remote
+// execution. Remote apply without stored plan can not be checked and is
+// refused.
+func CheckRemotePlanPolicy(executionInput *WorkspaceExecutionInput, ref *artifacts.Ref, out io.Writer) error {
+	if ref == nil {
+		return &policy.PolicyError{
+			Reason: fmt.Sprintf("remote apply of %s without --plan-ref can not be checked against policy", executionInput.Path),
+		}
+	}
+	plan, err := GetStoredPlan(ref, executionInput.Client)
+	if err != nil {
+		return err
+	}
+	return policy.Check(out, executionInput.Policy, plan)
+}
+
+// CheckPlanPolicy evaluates policy against local plan file of the
+// workspace.
+func CheckPlanPolicy(executionInput *WorkspaceExecutionInput, out, outErr io.Writer) error {
+	planJson, err := ShowLocalPlan(executionInput, outErr)
+	if err != nil {
+		return err
+	}
+	plan, err := plans.ParsePlan(planJson)
+	if err != nil {
+		return err
+	}
+	return policy.Check(out, executionInput.Policy, plan)
+}
@@ -0,0 +1,138 @@
+package workspaces
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/p0tr3c/terra-ci/artifacts"
+	"github.com/p0tr3c/terra-ci/aws"
+	"github.com/p0tr3c/terra-ci/aws/awstest"
+)
+
+// newFakeClient returns client of fake APIs. Executions started by it
+// complete on the first poll with output.
+func newFakeClient(output string) (*aws.Client, *awstest.FakeSfn, *awstest.FakeS3) {
+	sfnClient := awstest.NewFakeSfn(awstest.NewFakeTaskHistory("Plan", "/g", "s1", true))
+	sfnClient.Output = output
+	cloudwatchClient := awstest.NewFakeCloudwatch()
+	cloudwatchClient.AddLogs("/g", "s1", "planning\n")
+	s3Client := awstest.NewFakeS3()
+	return aws.NewClientWithAPI(sfnClient, cloudwatchClient, s3Client), sfnClient, s3Client
+}
+
+// startFakeExecution starts execution and reveals its whole history.
+func startFakeExecution(t *testing.T, client *aws.Client, sfnClient *awstest.FakeSfn) string {
+	t.Helper()
+	arn, err := client.StartStateMachine("arn:aws:states:eu-west-1:123:stateMachine:plan", &aws.SfnInputParameters{Action: "plan"})
+	if err != nil {
+		t.Fatalf("failed to start execution: %s", err)
+	}
+	execution := sfnClient.Executions[arn]
+	execution.Revealed = len(execution.History)
+	return arn
+}
+
+func TestStoreRemotePlan(t *testing.T) {
+	client, sfnClient, s3Client := newFakeClient(`{"artifacts":{"plan":"s3://builds/tfplan","plan_json":"s3://builds/plan.json"}}`)
+	if err := s3Client.AddObject("s3://builds/tfplan", []byte("plan")); err != nil {
+		t.Fatalf("failed to add plan: %s", err)
+	}
+	if err := s3Client.AddObject("s3://builds/plan.json", []byte(`{"format_version":"0.2"}`)); err != nil {
+		t.Fatalf("failed to add plan json: %s", err)
+	}
+	store, err := artifacts.NewLocalStore(t.TempDir())
+	if err != nil {
+		t.Fatalf("failed to create store: %s", err)
+	}
+	executionInput := &WorkspaceExecutionInput{
+		Path:          "live/prod/vpc",
+		Client:        client,
+		ArtifactStore: store,
+		ExecutionArn:  startFakeExecution(t, client, sfnClient),
+	}
+
+	ref, err := StoreRemotePlan(executionInput)
+	if err != nil {
+		t.Fatalf("failed to store plan: %s", err)
+	}
+	if !strings.Contains(ref.Location, "plans/live/prod/vpc/") {
+		t.Fatalf("unexpected location %s", ref.Location)
+	}
+	data, err := artifacts.Get(store, ref)
+	if err != nil || string(data) != "plan" {
+		t.Fatalf("expected stored plan, got %q, %v", data, err)
+	}
+	if ref.JsonSha256 == "" {
+		t.Fatalf("expected plan json checksum in reference %s", ref)
+	}
+	if _, err := GetStoredPlan(ref, client); err != nil {
+		t.Fatalf("expected plan json stored next to plan, got %s", err)
+	}
+
+	// Builds which did not produce plan have no reference
+	client, sfnClient, _ = newFakeClient("")
+	executionInput.Client = client
+	executionInput.ExecutionArn = startFakeExecution(t, client, sfnClient)
+	if ref, err := StoreRemotePlan(executionInput); ref != nil || err != nil {
+		t.Fatalf("expected no reference, got %v, %v", ref, err)
+	}
+}
+
+func TestVerifyPlanRef(t *testing.T) {
+	client, _, s3Client := newFakeClient("")
+	s3Store, err := artifacts.NewStore("s3://store/terra-ci", client)
+	if err != nil {
+		t.Fatalf("failed to create store: %s", err)
+	}
+	s3Ref, err := artifacts.Put(s3Store, "tfplan", []byte("plan"))
+	if err != nil {
+		t.Fatalf("failed to put plan: %s", err)
+	}
+	tamperedRef, err := artifacts.Put(s3Store, "tampered", []byte("plan"))
+	if err != nil {
+		t.Fatalf("failed to put plan: %s", err)
+	}
+	if err := s3Client.AddObject(tamperedRef.Location, []byte("modified")); err != nil {
+		t.Fatalf("failed to modify plan: %s", err)
+	}
+	localStore, err := artifacts.NewLocalStore(t.TempDir())
+	if err != nil {
+		t.Fatalf("failed to create store: %s", err)
+	}
+	localRef, err := artifacts.Put(localStore, "tfplan", []byte("plan"))
+	if err != nil {
+		t.Fatalf("failed to put plan: %s", err)
+	}
+
+	tests := []struct {
+		name    string
+		planRef string
+		err     string
+	}{
+		{name: "s3", planRef: s3Ref.String()},
+		{name: "local", planRef: localRef.String(), err: "not accessible by remote execution"},
+		{name: "modified", planRef: tamperedRef.String(), err: "artifact was modified"},
+		{name: "missing", planRef: "s3://store/terra-ci/missing#sha256=" + s3Ref.Sha256, err: "does not exist"},
+		{name: "invalid", planRef: "s3://store/terra-ci/tfplan", err: "invalid artifact reference"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ref, err := VerifyPlanRef(&WorkspaceExecutionInput{
+				Client:  client,
+				PlanRef: tt.planRef,
+			})
+			if tt.err == "" {
+				if err != nil {
+					t.Fatalf("unexpected error: %s", err)
+				}
+				if ref.String() != tt.planRef {
+					t.Fatalf("expected reference %s, got %s", tt.planRef, ref)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.err) {
+				t.Fatalf("expected error containing %q, got %v", tt.err, err)
+			}
+		})
+	}
+}
@@ -0,0 +1,186 @@
+package workspaces
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/p0tr3c/terra-ci/artifacts"
+	"github.com/p0tr3c/terra-ci/plans"
+)
+
+const (
+	// ProtectedMarkerFile marks workspace as protected regardless of
+	// protected_paths setting.
+	ProtectedMarkerFile = ".terra-ci-protected"
+)
+
+// DestroyProtection guards protected workspace against actions which
+// destroy its resources. It is resolved from the workspace path given by
+// the user, as execution may run against translated path.
+type DestroyProtection struct {
+	Workspace  string
+	MaxDestroy int
+	Confirmed  bool
+}
+
+// matchPath reports whether slash separated path matches the pattern.
+// Besides filepath.Match syntax, ** segment matches any number of
+// path segments.
+func matchPath(pattern, path []string) (bool, error) {
+	if len(pattern) == 0 {
+		return len(path) == 0, nil
+	}
+	if pattern[0] == "**" {
+		for i := 0; i <= len(path); i++ {
+			matched, err := matchPath(pattern[1:], path[i:])
+			if err != nil || matched {
+				return matched, err
+			}
+		}
+		return false, nil
+	}
+	if len(path) == 0 {
+		return false, nil
+	}
+	matched, err := filepath.Match(pattern[0], path[0])
+	if err != nil || !matched {
+		return false, err
+	}
+	return matchPath(pattern[1:], path[1:])
+}
+
+func splitPath(path string) []string {
+	return strings.Split(filepath.ToSlash(filepath.Clean(path)), "/")
+}
+
+// IsProtectedWorkspace reports whether workspace matches any of protected
+// path patterns or contains ProtectedMarkerFile. Patterns are matched
+// against path relative to the repository root, so they hold regardless
+// of the current directory. Outside of git repository path is matched as
+// given.
+func IsProtectedWorkspace(path string, patterns []string) (bool, error) {
+	matchedPath := path
+	if len(patterns) > 0 {
+		if repository, err := OpenRepository(); err == nil {
+			matchedPath, err = repository.Path(path)
+			if err != nil {
+				return false, err
+			}
+		}
+	}
+	for _, pattern := range patterns {
+		// Malformed segments are reported even when earlier ones differ
+		for _, segment := range splitPath(pattern) {
+			if _, err := filepath.Match(segment, ""); err != nil {
+				return false, fmt.Errorf("invalid protected path %s: %s", pattern, err.Error())
+			}
+		}
+		matched, err := matchPath(splitPath(pattern), splitPath(matchedPath))
+		if err != nil {
+			return false, fmt.Errorf("invalid protected path %s: %s", pattern, err.Error())
+		}
+		if matched {
+			return true, nil
+		}
+	}
+	_, err := os.Stat(filepath.Join(path, ProtectedMarkerFile))
+	if err == nil {
+		return true, nil
+	}
+	if os.IsNotExist(err) {
+		return false, nil
+	}
+	return false, err
+}
+
+// NewDestroyProtection returns protection of the workspace, or nil when
+// workspace is not protected. Confirmation must name the workspace.
+func NewDestroyProtection(path string, patterns []string, maxDestroy int, confirmation string) (*DestroyProtection, error) {
+	workspace := filepath.Clean(path)
+	if confirmation != "" && filepath.Clean(confirmation) != workspace {
+		return nil, fmt.Errorf("--i-understand-destroy=%s does not match workspace %s", confirmation, workspace)
+	}
+	protected, err := IsProtectedWorkspace(path, patterns)
+	if err != nil || !protected {
+		return nil, err
+	}
+	return &DestroyProtection{
+		Workspace:  workspace,
+		MaxDestroy: maxDestroy,
+		Confirmed:  confirmation != "",
+	}, nil
+}
+
+// DestroyProtectionError is returned when execution could destroy
+// resources of protected workspace without confirmation.
+type DestroyProtectionError struct {
+	Workspace string
+	Reason    string
+}
+
+func (e *DestroyProtectionError) Error() string {
+	return fmt.Sprintf("workspace %s is protected, refusing %s, confirm with --i-understand-destroy=%s",
+		e.Workspace, e.Reason, e.Workspace)
+}
+
+// checkPlanDestroy refuses plan deleting more than MaxDestroy resources.
+func checkPlanDestroy(protection *DestroyProtection, plan *plans.Plan) error {
+	if destroyed := plan.Summary().Destroy; destroyed > protection.MaxDestroy {
+		return &DestroyProtectionError{
+			Workspace: protection.Workspace,
+			Reason:    fmt.Sprintf("apply deleting %d resources, at most %d allowed", destroyed, protection.MaxDestroy),
+		}
+	}
+	return nil
+}
+
+// CheckDestroyProtection refuses destroy plans, destroys and applies
+// deleting more than MaxDestroy resources in protected workspace. Applies
+// of local plan files and of remote plans referenced by PlanRef are
+// inspected. Auto-approved local applies without plan file and remote
+// applies without plan can not be inspected and are refused.
+func CheckDestroyProtection(executionInput *WorkspaceExecutionInput, outErr io.Writer) error {
+	protection := executionInput.DestroyProtection
+	if protection == nil || protection.Confirmed {
+		return nil
+	}
+	protectionError := &DestroyProtectionError{Workspace: protection.Workspace}
+	switch {
+	case executionInput.Action == "destroy":
+		protectionError.Reason = "destroy"
+		return protectionError
+	case executionInput.Action == "plan" && executionInput.DestroyPlan:
+		protectionError.Reason = "destroy plan"
+		return protectionError
+	case executionInput.Action == "apply" && executionInput.Local && executionInput.OutPlan != "":
+		planJson, err := ShowLocalPlan(executionInput, outErr)
+		if err != nil {
+			return err
+		}
+		plan, err := plans.ParsePlan(planJson)
+		if err != nil {
+			return err
+		}
+		return checkPlanDestroy(protection, plan)
+	case executionInput.Action == "apply" && executionInput.Local && executionInput.IsCi:
+		protectionError.Reason = "auto-approved apply without plan file"
+		return protectionError
+	case executionInput.Action == "apply" && !executionInput.Local && executionInput.PlanRef != "":
+		ref, err := artifacts.ParseRef(executionInput.PlanRef)
+		if err != nil {
+			return err
+		}
+		plan, err := GetStoredPlan(ref, executionInput.Client)
+		if err != nil {
+			return err
+		}
+		return checkPlanDestroy(protection, plan)
+	case executionInput.Action == "apply" && !executionInput.Local:
+		protectionError.Reason = "remote apply without --plan-ref"
+		return protectionError
+	}
+	return nil
+}
@@ -0,0 +1,151 @@
+package workspaces
+
+import (
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestMatchPath(t *testing.T) {
+	tests := []struct {
+		pattern string
+		path    string
+		matched bool
+	}{
+		{pattern: "live/prod/**", path: "live/prod", matched: true},
+		{pattern: "live/prod/**", path: "live/prod/vpc", matched: true},
+		{pattern: "live/prod/**", path: "live/prod/eu-west-1/vpc", matched: true},
+		{pattern: "live/prod/**", path: "live/production/vpc"},
+		{pattern: "**/vpc", path: "live/prod/vpc", matched: true},
+		{pattern: "**/vpc", path: "vpc", matched: true},
+		{pattern: "**/vpc", path: "live/prod/vpc/subnets"},
+		{pattern: "live/**/vpc", path: "live/vpc", matched: true},
+		{pattern: "live/**/vpc", path: "live/prod/eu-west-1/vpc", matched: true},
+		{pattern: "live/*/vpc", path: "live/prod/eu-west-1/vpc"},
+		{pattern: "live/prod-*", path: "live/prod-eu", matched: true},
+		{pattern: "live/prod", path: "./live/prod/", matched: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.pattern+" "+tt.path, func(t *testing.T) {
+			matched, err := matchPath(splitPath(tt.pattern), splitPath(tt.path))
+			if err != nil {
+				t.Fatalf("unexpected error: %s", err)
+			}
+			if matched != tt.matched {
+				t.Fatalf("expected match %t, got %t", tt.matched, matched)
+			}
+		})
+	}
+
+	if _, err := IsProtectedWorkspace("live/prod", []string{"live/["}); err == nil {
+		t.Fatalf("expected invalid pattern to be rejected")
+	}
+}
+
+func TestProtectedMarkerFile(t *testing.T) {
+	dir := t.TempDir()
+	protected, err := IsProtectedWorkspace(dir, nil)
+	if err != nil || protected {
+		t.Fatalf("expected workspace without marker not to be protected, got %t, %v", protected, err)
+	}
+	if err := ioutil.WriteFile(filepath.Join(dir, ProtectedMarkerFile), nil, 0644); err != nil {
+		t.Fatalf("failed to create marker: %s", err)
+	}
+	protected, err = IsProtectedWorkspace(dir, nil)
+	if err != nil || !protected {
+		t.Fatalf("expected workspace with marker to be protected, got %t, %v", protected, err)
+	}
+
+	protection, err := NewDestroyProtection(dir+"/", nil, 1, "")
+	if err != nil || protection == nil || protection.Workspace != dir || protection.MaxDestroy != 1 || protection.Confirmed {
+		t.Fatalf("unexpected protection %+v, %v", protection, err)
+	}
+	protection, err = NewDestroyProtection(dir, nil, 0, dir)
+	if err != nil || !protection.Confirmed {
+		t.Fatalf("expected confirmed protection, got %+v, %v", protection, err)
+	}
+	if _, err := NewDestroyProtection(dir, nil, 0, filepath.Join(dir, "other")); err == nil {
+		t.Fatalf("expected confirmation of other workspace to be rejected")
+	}
+	if protection, err := NewDestroyProtection(filepath.Join(dir, "missing"), nil, 0, ""); err != nil || protection != nil {
+		t.Fatalf("expected unprotected workspace, got %+v, %v", protection, err)
+	}
+	if _, err := os.Stat(filepath.Join(dir, ProtectedMarkerFile)); err != nil {
+		t.Fatalf("marker file was removed: %s", err)
+	}
+}
+
+func TestCheckDestroyProtection(t *testing.T) {
+	client, _, _ := newFakeClient("")
+	destroyRef := storeTestPlan(t, client, "destroy", testPlanDestroy)
+	tests := []struct {
+		name           string
+		executionInput *WorkspaceExecutionInput
+		maxDestroy     int
+		confirmed      bool
+		refused        bool
+	}{
+		{name: "destroy", executionInput: &WorkspaceExecutionInput{Action: "destroy", Local: true}, refused: true},
+		{name: "destroy plan", executionInput: &WorkspaceExecutionInput{Action: "plan", DestroyPlan: true}, refused: true},
+		{name: "plan", executionInput: &WorkspaceExecutionInput{Action: "plan"}},
+		{name: "confirmed destroy", executionInput: &WorkspaceExecutionInput{Action: "destroy"}, confirmed: true},
+		{name: "local ci apply without plan", executionInput: &WorkspaceExecutionInput{Action: "apply", Local: true, IsCi: true}, refused: true},
+		{name: "remote apply without plan", executionInput: &WorkspaceExecutionInput{Action: "apply"}, refused: true},
+		{name: "confirmed remote apply without plan", executionInput: &WorkspaceExecutionInput{Action: "apply"}, confirmed: true},
+		{name: "remote apply deleting", executionInput: &WorkspaceExecutionInput{Action: "apply", PlanRef: destroyRef}, maxDestroy: 1, refused: true},
+		{name: "remote apply within limit", executionInput: &WorkspaceExecutionInput{Action: "apply", PlanRef: destroyRef}, maxDestroy: 2},
+		{name: "remote apply creating", executionInput: &WorkspaceExecutionInput{Action: "apply", PlanRef: storeTestPlan(t, client, "create", testPlanCreate)}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.executionInput.Client = client
+			tt.executionInput.DestroyProtection = &DestroyProtection{
+				Workspace:  "live/prod/vpc",
+				MaxDestroy: tt.maxDestroy,
+				Confirmed:  tt.confirmed,
+			}
+			err := CheckDestroyProtection(tt.executionInput, ioutil.Discard)
+			var protectionErr *DestroyProtectionError
+			if tt.refused != errors.As(err, &protectionErr) {
+				t.Fatalf("expected refused %t, got %v", tt.refused, err)
+			}
+			if !tt.refused && err != nil {
+				t.Fatalf("unexpected error: %s", err)
+			}
+		})
+	}
+}
+
+func TestProtectedPathRelativeToRepository(t *testing.T) {
+	repo := newMetadataRepository(t)
+	writeTree(t, repo, map[string]string{"live/dev/vpc/terragrunt.hcl": ""})
+	patterns := []string{"live/prod/**"}
+	tests := []struct {
+		name      string
+		dir       string
+		path      func(repo string) string
+		protected bool
+	}{
+		{name: "from repository root", path: func(string) string { return "live/prod/vpc" }, protected: true},
+		{name: "from subdirectory", dir: "live", path: func(string) string { return "prod/vpc" }, protected: true},
+		{name: "from workspace", dir: "live/prod/vpc", path: func(string) string { return "." }, protected: true},
+		{name: "parent directory", dir: "live/dev", path: func(string) string { return "../prod/vpc" }, protected: true},
+		{name: "absolute path", dir: "docs", path: func(repo string) string { return filepath.Join(repo, "live", "prod", "vpc") }, protected: true},
+		{name: "unprotected from subdirectory", dir: "live", path: func(string) string { return "dev/vpc" }},
+		{name: "unprotected absolute path", path: func(repo string) string { return filepath.Join(repo, "live", "dev", "vpc") }},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			chdir(t, filepath.Join(repo, tt.dir))
+			protected, err := IsProtectedWorkspace(tt.path(repo), patterns)
+			if err != nil {
+				t.Fatalf("unexpected error: %s", err)
+			}
+			if protected != tt.protected {
+				t.Fatalf("expected protected %t, got %t", tt.protected, protected)
+			}
+		})
+	}
+}
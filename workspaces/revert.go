@@ -0,0 +1,110 @@
+package workspaces
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+)
+
+const (
+	defaultRevertPlanName = "terra-ci-revert.tfplan"
+)
+
+// RevisionWorktree is a detached git worktree holding the repository
+// at a previous revision.
+type RevisionWorktree struct {
+	Ref      string
+	RepoRoot string
+	Dir      string
+}
+
+func runGit(dir string, args ...string) (string, error) {
+	shellCommand := exec.Command("git", args...)
+	shellCommand.Dir = dir
+	var stdout, stderr bytes.Buffer
+	shellCommand.Stdout = &stdout
+	shellCommand.Stderr = &stderr
+	if err := shellCommand.Run(); err != nil {
+		return "", fmt.Errorf("git %s: %s: %s", strings.Join(args, " "), err, strings.TrimSpace(stderr.String()))
+	}
+	return strings.TrimSpace(stdout.String()), nil
+}
+
+func NewRevisionWorktree(ref string) (*RevisionWorktree, error) {
+	repoRoot, err := runGit("", "rev-parse", "--show-toplevel")
+	if err != nil {
+		return nil, err
+	}
+	if _, err := runGit(repoRoot, "rev-parse", "--verify", ref+"^{commit}"); err != nil {
+		return nil, err
+	}
+	dir, err := ioutil.TempDir("", "terra-ci-revert-")
+	if err != nil {
+		return nil, err
+	}
+	if _, err := runGit(repoRoot, "worktree", "add", "--detach", dir, ref); err != nil {
+		os.RemoveAll(dir) //nolint
+		return nil, err
+	}
+	return &RevisionWorktree{
+		Ref:      ref,
+		RepoRoot: repoRoot,
+		Dir:      dir,
+	}, nil
+}
+
+// Translate maps path from the current checkout into the worktree.
+func (w *RevisionWorktree) Translate(path string) (string, error) {
+	absPath, err := filepath.Abs(path)
+	if err != nil {
+		return "", err
+	}
+	relPath, err := filepath.Rel(w.RepoRoot, absPath)
+	if err != nil {
+		return "", err
+	}
+	if strings.HasPrefix(relPath, "..") {
+		return "", fmt.Errorf("%s is outside of repository %s", path, w.RepoRoot)
+	}
+	return filepath.Join(w.Dir, relPath), nil
+}
+
+// Remove deletes the worktree. When git can not remove it, for example
+// because its directory was already deleted, the directory is removed and
+// the stale worktree is pruned.
+func (w *RevisionWorktree) Remove() error {
+	if _, err := runGit(w.RepoRoot, "worktree", "remove", "--force", w.Dir); err == nil {
+		return nil
+	}
+	if err := os.RemoveAll(w.Dir); err != nil {
+		return err
+	}
+	_, err := runGit(w.RepoRoot, "worktree", "prune")
+	return err
+}
+
+// NewRevertExecutionInput returns copy of local executionInput which
+// executes against the revision checked out in the worktree.
+func NewRevertExecutionInput(executionInput *WorkspaceExecutionInput, worktree *RevisionWorktree) (*WorkspaceExecutionInput, error) {
+	revertInput := *executionInput
+	revertInput.Ref = worktree.Ref
+
+	path, err := worktree.Translate(executionInput.Path)
+	if err != nil {
+		return nil, err
+	}
+	revertInput.Path = path
+	if executionInput.LocalModules != "" {
+		localModules, err := worktree.Translate(executionInput.LocalModules)
+		if err != nil {
+			return nil, err
+		}
+		revertInput.LocalModules = localModules
+	}
+	revertInput.OutPlan = defaultRevertPlanName
+	return &revertInput, nil
+}
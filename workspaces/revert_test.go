@@ -0,0 +1,160 @@
+package workspaces
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// setupTempDir makes temporary directory of the test the default location
+// of temporary files and returns it.
+func setupTempDir(t *testing.T) string {
+	t.Helper()
+	dir := t.TempDir()
+	tmpDir := os.Getenv("TMPDIR")
+	os.Setenv("TMPDIR", dir)
+	t.Cleanup(func() {
+		os.Setenv("TMPDIR", tmpDir)
+	})
+	return dir
+}
+
+// assertWorktreesRemoved fails unless repository has only its main
+// worktree and no temporary directory is left behind.
+func assertWorktreesRemoved(t *testing.T, repoRoot, tmpDir string) {
+	t.Helper()
+	worktrees := testGit(t, repoRoot, "worktree", "list", "--porcelain")
+	if count := strings.Count(worktrees, "worktree "); count != 1 {
+		t.Errorf("expected only main worktree, got\n%s", worktrees)
+	}
+	entries, err := ioutil.ReadDir(tmpDir)
+	if err != nil {
+		t.Fatalf("failed to read %s: %s", tmpDir, err)
+	}
+	for _, entry := range entries {
+		t.Errorf("expected temporary directory to be removed, found %s", entry.Name())
+	}
+}
+
+func TestRevisionWorktree(t *testing.T) {
+	repoRoot := newTestRepository(t, map[string]string{
+		"live/prod/vpc/terragrunt.hcl": "# v1\n",
+	}, map[string]string{
+		"live/prod/vpc/terragrunt.hcl": "# v2\n",
+	})
+	tmpDir := setupTempDir(t)
+	chdir(t, filepath.Join(repoRoot, "live"))
+
+	worktree, err := NewRevisionWorktree("main")
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if !strings.HasPrefix(worktree.Dir, tmpDir) {
+		t.Errorf("expected worktree in %s, got %s", tmpDir, worktree.Dir)
+	}
+	path, err := worktree.Translate("prod/vpc")
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if expected := filepath.Join(worktree.Dir, "live", "prod", "vpc"); path != expected {
+		t.Errorf("expected %s, got %s", expected, path)
+	}
+	config, err := ioutil.ReadFile(filepath.Join(path, "terragrunt.hcl"))
+	if err != nil {
+		t.Fatalf("failed to read config at revision: %s", err)
+	}
+	if string(config) != "# v1\n" {
+		t.Errorf("expected config at revision, got %q", config)
+	}
+	if _, err := worktree.Translate("../.."); err == nil {
+		t.Errorf("expected error translating path outside of repository")
+	}
+
+	// Untracked plan files do not prevent removal
+	writeTree(t, path, map[string]string{defaultRevertPlanName: "plan"})
+	if err := worktree.Remove(); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	assertWorktreesRemoved(t, repoRoot, tmpDir)
+}
+
+func TestRevisionWorktreeRemoveDeleted(t *testing.T) {
+	repoRoot := newTestRepository(t, map[string]string{"live/prod/vpc/terragrunt.hcl": "# v1\n"}, map[string]string{"docs/README.md": ""})
+	tmpDir := setupTempDir(t)
+	chdir(t, repoRoot)
+
+	worktree, err := NewRevisionWorktree("HEAD")
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if err := os.RemoveAll(worktree.Dir); err != nil {
+		t.Fatalf("failed to remove worktree directory: %s", err)
+	}
+	if err := worktree.Remove(); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	assertWorktreesRemoved(t, repoRoot, tmpDir)
+}
+
+func TestNewRevisionWorktreeFailure(t *testing.T) {
+	repoRoot := newTestRepository(t, map[string]string{"live/prod/vpc/terragrunt.hcl": "# v1\n"}, map[string]string{"docs/README.md": ""})
+	tests := []struct {
+		name string
+		dir  string
+		ref  string
+	}{
+		{name: "unknown ref", dir: repoRoot, ref: "unknown"},
+		{name: "tree ref", dir: repoRoot, ref: "HEAD^{tree}"},
+		{name: "outside of repository", dir: t.TempDir(), ref: "HEAD"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tmpDir := setupTempDir(t)
+			chdir(t, tt.dir)
+			if _, err := NewRevisionWorktree(tt.ref); err == nil {
+				t.Fatalf("expected error")
+			}
+			assertWorktreesRemoved(t, repoRoot, tmpDir)
+		})
+	}
+}
+
+func TestNewRevertExecutionInput(t *testing.T) {
+	repoRoot := newTestRepository(t, map[string]string{
+		"live/prod/vpc/terragrunt.hcl": "# v1\n",
+		"modules/vpc/main.tf":          "",
+	}, map[string]string{"docs/README.md": ""})
+	setupTempDir(t)
+	chdir(t, repoRoot)
+
+	worktree, err := NewRevisionWorktree("HEAD")
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	defer worktree.Remove() //nolint
+
+	executionInput := &WorkspaceExecutionInput{
+		Path:         "live/prod/vpc",
+		LocalModules: "modules",
+		OutPlan:      "tfplan",
+		Local:        true,
+	}
+	revertInput, err := NewRevertExecutionInput(executionInput, worktree)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if expected := filepath.Join(worktree.Dir, "live", "prod", "vpc"); revertInput.Path != expected {
+		t.Errorf("expected path %s, got %s", expected, revertInput.Path)
+	}
+	if expected := filepath.Join(worktree.Dir, "modules"); revertInput.LocalModules != expected {
+		t.Errorf("expected local modules %s, got %s", expected, revertInput.LocalModules)
+	}
+	if revertInput.OutPlan != defaultRevertPlanName || revertInput.Ref != "HEAD" || !revertInput.Local {
+		t.Errorf("unexpected revert input %+v", revertInput)
+	}
+	if executionInput.Path != "live/prod/vpc" || executionInput.OutPlan != "tfplan" {
+		t.Errorf("expected execution input to be unchanged, got %+v", executionInput)
+	}
+}
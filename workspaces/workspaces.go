@@ -2,6 +2,7 @@ package workspaces
 
 import (
 	"bytes"
+	"errors"
 	"fmt"
 	"io"
 	"io/ioutil"
@@ -12,7 +13,9 @@ import (
 	"text/template"
 	"time"
 
+	"github.com/p0tr3c/terra-ci/artifacts"
 	"github.com/p0tr3c/terra-ci/aws"
+	"github.com/p0tr3c/terra-ci/policy"
 	"github.com/p0tr3c/terra-ci/templates"
 )
 
@@ -55,6 +58,10 @@ func CreateWorkspaceConfig(inputConfig *WorkspaceCreateInput) error {
 	return nil
 }
 
+func WorkspaceCIFilePath(ciPath, workspacePath string) string {
+	return filepath.Join(ciPath, fmt.Sprintf("workspace_%s.yml", strings.Join(strings.Split(workspacePath, "/")[1:], "_")))
+}
+
 func CreateWorkspaceCI(inputConfig *WorkspaceCreateInput) error {
 	tpl, err := template.New("ciConfig").Parse(templates.CiWorkspaceConfigTpl)
 	if err != nil {
@@ -64,7 +71,7 @@ func CreateWorkspaceCI(inputConfig *WorkspaceCreateInput) error {
 	if err := tpl.Execute(&templatedCiConfig, inputConfig); err != nil {
 		return err
 	}
-	if err := ioutil.WriteFile(filepath.Join(inputConfig.CiPath, fmt.Sprintf("workspace_%s.yml", strings.Join(strings.Split(inputConfig.Path, "/")[1:], "_"))),
+	if err := ioutil.WriteFile(WorkspaceCIFilePath(inputConfig.CiPath, inputConfig.Path),
 		templatedCiConfig.Bytes(), defaultFilePermMode); err != nil {
 		return err
 	}
@@ -103,25 +110,104 @@ type WorkspaceExecutionInput struct {
 	IsCi                bool
 	Local               bool
 	LocalModules        string
+	AutoApprove         bool
+	Ref                 string
+	PrintInput          bool
+	AbortOnInterrupt    bool
+	Confirm             aws.ConfirmFunc `json:"-"`
+	Client              *aws.Client
+	Subscribers         []aws.SfnEventSubscriber
+	DetailedExitCode    bool
+	ReportMarkdown      string
+	ArtifactStore       artifacts.Store
+	PlanRef             string
+	ForceStalePlan      bool
+	Policy              *policy.Policy
+	DestroyProtection   *DestroyProtection
+	// ExecutionArn is set once remote execution is started
+	ExecutionArn string
 }
 
-func ExecuteRemoteWorkspaceWithOutput(executionInput *WorkspaceExecutionInput, out, outErr io.Writer) error {
-	executionArn, err := aws.StartStateMachine(executionInput.Path,
-		executionInput.Arn,
-		executionInput.Source,
-		executionInput.Location,
-		"",
-		executionInput.Action)
+// PlanChangesError is returned by plan run with DetailedExitCode when the
+// plan succeeded and contains changes.
+type PlanChangesError struct {
+	Path string
+}
+
+func (e *PlanChangesError) Error() string {
+	return fmt.Sprintf("plan of workspace %s has changes", e.Path)
+}
+
+// ValidateRemoteExecutionInput rejects options which can only be honoured
+// by local execution, instead of silently dropping them.
+func ValidateRemoteExecutionInput(executionInput *WorkspaceExecutionInput) error {
+	if executionInput.LocalModules != "" {
+		return fmt.Errorf("--source %s is not supported for remote execution, use --local", executionInput.LocalModules)
+	}
+	if executionInput.Action == "apply" && executionInput.OutPlan != "" {
+		return fmt.Errorf("plan file %s is not supported for remote apply, use --plan-ref or --local", executionInput.OutPlan)
+	}
+	return nil
+}
+
+func NewSfnInputParameters(executionInput *WorkspaceExecutionInput) *aws.SfnInputParameters {
+	return &aws.SfnInputParameters{
+		Resource:       executionInput.Path,
+		Action:         executionInput.Action,
+		RepositoryUrl:  executionInput.Source,
+		RepositoryName: executionInput.Location,
+		Ref:            executionInput.Ref,
+		Branch:         executionInput.Branch,
+		Destroy:        executionInput.DestroyPlan,
+		NoRefresh:      executionInput.DisableRefreshState,
+		OutPlan:        executionInput.OutPlan,
+	}
+}
+
+func ExecuteRemoteWorkspaceWithOutput(executionInput *WorkspaceExecutionInput, in io.Reader, out, outErr io.Writer) error {
+	if err := ValidateRemoteExecutionInput(executionInput); err != nil {
+		return err
+	}
+	inputParams := NewSfnInputParameters(executionInput)
+	var ref *artifacts.Ref
+	if executionInput.Action == "apply" && executionInput.PlanRef != "" {
+		var err error
+		ref, err = VerifyPlanRef(executionInput)
+		if err != nil {
+			return err
+		}
+		inputParams.PlanRef = ref.Location
+		inputParams.PlanSha256 = ref.Sha256
+	}
+	if executionInput.PrintInput {
+		return aws.PrintStateMachineInput(inputParams, out)
+	}
+	if executionInput.Policy != nil {
+		switch executionInput.Action {
+		case "apply":
+			if err := CheckRemotePlanPolicy(executionInput, ref, out); err != nil {
+				return err
+			}
+		case "destroy":
+			return &policy.PolicyError{
+				Reason: fmt.Sprintf("destroy of %s can not be checked against policy", executionInput.Path),
+			}
+		}
+	}
+	executionArn, err := executionInput.Client.StartStateMachine(executionInput.Arn, inputParams)
 	if err != nil {
 		return err
 	}
 
+	executionInput.ExecutionArn = executionArn
 	fmt.Fprintf(out, "execution %s started\n", executionArn)
 
-	err = aws.MonitorStateMachineStatus(executionArn,
+	err = executionInput.Client.MonitorStateMachineStatus(executionArn,
 		executionInput.RefreshRate,
 		executionInput.ExecutionTimeout,
-		executionInput.IsCi, out, outErr)
+		executionInput.IsCi,
+		executionInput.AbortOnInterrupt, executionInput.Confirm, out, outErr,
+		executionInput.Subscribers...)
 	if err != nil {
 		return err
 	}
@@ -148,18 +234,45 @@ func ExecuteLocalWorkspaceWithOutput(executionInput *WorkspaceExecutionInput, in
 	if executionInput.DestroyPlan {
 		shellCommandArgs = append(shellCommandArgs, "-destroy")
 	}
+	if executionInput.DetailedExitCode && executionInput.Action == "plan" {
+		shellCommandArgs = append(shellCommandArgs, "-detailed-exitcode")
+	}
 	if executionInput.DisableRefreshState && executionInput.Action == "plan" {
 		shellCommandArgs = append(shellCommandArgs, "-refresh=false")
 	}
 	if executionInput.IsCi && executionInput.Action == "apply" && executionInput.OutPlan == "" {
 		shellCommandArgs = append(shellCommandArgs, "-auto-approve")
 	}
+	if executionInput.AutoApprove && executionInput.Action == "destroy" {
+		shellCommandArgs = append(shellCommandArgs, "-auto-approve")
+	}
 	if executionInput.LocalModules != "" {
 		shellCommandArgs = append(shellCommandArgs, []string{
 			"--terragrunt-source",
 			executionInput.LocalModules,
 		}...)
 	}
+	if executionInput.Action == "apply" && executionInput.OutPlan != "" && !executionInput.ForceStalePlan {
+		if err := VerifyPlanMetadata(executionInput); err != nil {
+			return err
+		}
+	}
+	if executionInput.Policy != nil {
+		switch {
+		case executionInput.Action == "destroy":
+			return &policy.PolicyError{
+				Reason: fmt.Sprintf("destroy of %s can not be checked against policy", executionInput.Path),
+			}
+		case executionInput.Action == "apply" && executionInput.OutPlan == "":
+			return &policy.PolicyError{
+				Reason: fmt.Sprintf("apply of %s without plan file can not be checked against policy", executionInput.Path),
+			}
+		case executionInput.Action == "apply":
+			if err := CheckPlanPolicy(executionInput, out, outErr); err != nil {
+				return err
+			}
+		}
+	}
 	shellCommand := exec.Command("terragrunt", shellCommandArgs...)
 	workspaceAbsPath, err := filepath.Abs(executionInput.Path)
 	if err != nil {
@@ -174,62 +287,44 @@ func ExecuteLocalWorkspaceWithOutput(executionInput *WorkspaceExecutionInput, in
 		return err
 	}
 
-	if err := shellCommand.Wait(); err != nil {
-		return err
+	if err = shellCommand.Wait(); err != nil {
+		// With -detailed-exitcode terraform exits with 2 on successful plan
+		// which contains changes
+		var exitErr *exec.ExitError
+		if !executionInput.DetailedExitCode || !errors.As(err, &exitErr) || exitErr.ExitCode() != 2 {
+			return err
+		}
+		err = &PlanChangesError{Path: executionInput.Path}
 	}
 
-	return nil
+	if executionInput.Action == "plan" && executionInput.OutPlan != "" {
+		if err := WritePlanMetadata(executionInput); err != nil {
+			return err
+		}
+	}
+	return err
 }
 
 func ExecuteWorkspaceWithOutput(executionInput *WorkspaceExecutionInput, in io.Reader, out, outErr io.Writer) error {
-	if executionInput.Local {
-		if err := ExecuteLocalWorkspaceWithOutput(executionInput, in, out, outErr); err != nil {
-			return err
-		}
-	} else {
-		if err := ExecuteRemoteWorkspaceWithOutput(executionInput, out, outErr); err != nil {
+	if executionInput.Local && executionInput.PrintInput {
+		return fmt.Errorf("--print-input is only supported for remote execution")
+	}
+	if executionInput.Local && executionInput.PlanRef != "" {
+		return fmt.Errorf("--plan-ref is only supported for remote execution, pass plan file instead")
+	}
+	if !executionInput.PrintInput {
+		if err := CheckDestroyProtection(executionInput, outErr); err != nil {
 			return err
 		}
 	}
-	return nil
-}
-
-/*************************** FF SFN_MONITOR ***************************************/
-
-func FFExecuteWorkspaceWithOutput(executionInput *WorkspaceExecutionInput, in io.Reader, out, outErr io.Writer) error {
 	if executionInput.Local {
 		if err := ExecuteLocalWorkspaceWithOutput(executionInput, in, out, outErr); err != nil {
 			return err
 		}
 	} else {
-		if err := FFExecuteRemoteWorkspaceWithOutput(executionInput, out, outErr); err != nil {
+		if err := ExecuteRemoteWorkspaceWithOutput(executionInput, in, out, outErr); err != nil {
 			return err
 		}
 	}
 	return nil
 }
-
-func FFExecuteRemoteWorkspaceWithOutput(executionInput *WorkspaceExecutionInput, out, outErr io.Writer) error {
-	executionArn, err := aws.StartStateMachine(executionInput.Path,
-		executionInput.Arn,
-		executionInput.Source,
-		executionInput.Location,
-		"",
-		executionInput.Action)
-	if err != nil {
-		return err
-	}
-
-	fmt.Fprintf(out, "execution %s started\n", executionArn)
-
-	err = aws.FFMonitorStateMachineStatus(executionArn,
-		executionInput.RefreshRate,
-		executionInput.ExecutionTimeout,
-		executionInput.IsCi, out, outErr)
-	if err != nil {
-		return err
-	}
-	return nil
-}
-
-/*************************** FF SFN_MONITOR - END  ***************************************/
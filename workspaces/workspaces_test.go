@@ -0,0 +1,181 @@
+package workspaces
+
+import (
+	"errors"
+	"io/ioutil"
+	"strings"
+	"testing"
+
+	"github.com/p0tr3c/terra-ci/artifacts"
+	"github.com/p0tr3c/terra-ci/aws"
+	"github.com/p0tr3c/terra-ci/policy"
+)
+
+const (
+	testPlanCreate  = `{"format_version":"0.2","resource_changes":[{"address":"aws_instance.a","type":"aws_instance","change":{"actions":["create"]}}]}`
+	testPlanDestroy = `{"format_version":"0.2","resource_changes":[{"address":"aws_instance.a","type":"aws_instance","change":{"actions":["delete"]}},{"address":"aws_instance.b","type":"aws_instance","change":{"actions":["delete"]}}]}`
+)
+
+// storeTestPlan stores plan with its json in s3 artifact store under
+// execution name and returns its reference.
+func storeTestPlan(t *testing.T, client *aws.Client, name, planJson string) string {
+	t.Helper()
+	store, err := artifacts.NewStore("s3://store/terra-ci", client)
+	if err != nil {
+		t.Fatalf("failed to create store: %s", err)
+	}
+	key, err := artifacts.PlanKey("live/prod/vpc", name)
+	if err != nil {
+		t.Fatalf("invalid plan key: %s", err)
+	}
+	ref, err := artifacts.PutPlan(store, key, []byte("plan"), []byte(planJson))
+	if err != nil {
+		t.Fatalf("failed to put plan: %s", err)
+	}
+	return ref.String()
+}
+
+func TestRemoteApplyPolicy(t *testing.T) {
+	denyDelete := &policy.Policy{
+		Rules: []*policy.Rule{
+			{Name: "keep-instances", Level: policy.LevelDeny, Type: policy.RuleNoDelete},
+		},
+	}
+	tests := []struct {
+		name     string
+		planJson string
+		policy   *policy.Policy
+		err      string
+	}{
+		{name: "no policy", planJson: testPlanDestroy},
+		{name: "allowed", planJson: testPlanCreate, policy: denyDelete},
+		{name: "denied", planJson: testPlanDestroy, policy: denyDelete, err: "violates 2 deny policy rules"},
+		{name: "no plan", policy: denyDelete, err: "without --plan-ref can not be checked against policy"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			client, sfnClient, _ := newFakeClient("")
+			executionInput := &WorkspaceExecutionInput{
+				Action:           "apply",
+				Path:             "live/prod/vpc",
+				Arn:              "arn:aws:states:eu-west-1:123:stateMachine:apply",
+				ExecutionTimeout: 1,
+				IsCi:             true,
+				Client:           client,
+				Policy:           tt.policy,
+			}
+			if tt.planJson != "" {
+				executionInput.PlanRef = storeTestPlan(t, client, tt.name, tt.planJson)
+			}
+
+			err := ExecuteWorkspaceWithOutput(executionInput, strings.NewReader(""), ioutil.Discard, ioutil.Discard)
+			if tt.err == "" {
+				if err != nil {
+					t.Fatalf("unexpected error: %s", err)
+				}
+				if len(sfnClient.Started) != 1 {
+					t.Fatalf("expected apply to be started")
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.err) {
+				t.Fatalf("expected error containing %q, got %v", tt.err, err)
+			}
+			if len(sfnClient.Started) != 0 {
+				t.Fatalf("expected apply not to be started")
+			}
+		})
+	}
+}
+
+func TestRemoteApplyPolicyMissingPlanJson(t *testing.T) {
+	client, sfnClient, _ := newFakeClient("")
+	store, err := artifacts.NewStore("s3://store/terra-ci", client)
+	if err != nil {
+		t.Fatalf("failed to create store: %s", err)
+	}
+	ref, err := artifacts.Put(store, "tfplan", []byte("plan"))
+	if err != nil {
+		t.Fatalf("failed to put plan: %s", err)
+	}
+	err = ExecuteWorkspaceWithOutput(&WorkspaceExecutionInput{
+		Action:  "apply",
+		Path:    "live/prod/vpc",
+		Client:  client,
+		PlanRef: ref.String(),
+		Policy:  &policy.Policy{},
+	}, strings.NewReader(""), ioutil.Discard, ioutil.Discard)
+	var policyErr *policy.PolicyError
+	if err == nil || errors.As(err, &policyErr) || !strings.Contains(err.Error(), "failed to read plan json") {
+		t.Fatalf("expected missing plan json error, got %v", err)
+	}
+	if len(sfnClient.Started) != 0 {
+		t.Fatalf("expected apply not to be started")
+	}
+}
+
+func TestPolicyRefusesUncheckedActions(t *testing.T) {
+	tests := []struct {
+		name           string
+		executionInput *WorkspaceExecutionInput
+		err            string
+	}{
+		{name: "local ci apply without plan file", executionInput: &WorkspaceExecutionInput{Action: "apply", Local: true, IsCi: true}, err: "apply of live/prod/vpc without plan file"},
+		{name: "local apply without plan file", executionInput: &WorkspaceExecutionInput{Action: "apply", Local: true}, err: "apply of live/prod/vpc without plan file"},
+		{name: "local destroy", executionInput: &WorkspaceExecutionInput{Action: "destroy", Local: true, AutoApprove: true}, err: "destroy of live/prod/vpc"},
+		{name: "remote destroy", executionInput: &WorkspaceExecutionInput{Action: "destroy"}, err: "destroy of live/prod/vpc"},
+		{name: "remote apply without plan", executionInput: &WorkspaceExecutionInput{Action: "apply"}, err: "remote apply of live/prod/vpc without --plan-ref"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			client, sfnClient, _ := newFakeClient("")
+			tt.executionInput.Path = "live/prod/vpc"
+			tt.executionInput.Client = client
+			tt.executionInput.Policy = &policy.Policy{}
+			err := ExecuteWorkspaceWithOutput(tt.executionInput, strings.NewReader(""), ioutil.Discard, ioutil.Discard)
+			var policyErr *policy.PolicyError
+			if !errors.As(err, &policyErr) || !strings.Contains(err.Error(), tt.err) {
+				t.Fatalf("expected policy error containing %q, got %v", tt.err, err)
+			}
+			if len(sfnClient.Started) != 0 {
+				t.Fatalf("expected execution not to be started")
+			}
+		})
+	}
+}
+
+func TestRemoteApplyTamperedPlanJson(t *testing.T) {
+	client, sfnClient, s3Client := newFakeClient("")
+	ref := storeTestPlan(t, client, "tampered", testPlanDestroy)
+	parsed, err := artifacts.ParseRef(ref)
+	if err != nil {
+		t.Fatalf("failed to parse reference: %s", err)
+	}
+	// Plan json replaced in the bucket hides deletions from policy and
+	// destroy protection
+	if err := s3Client.AddObject(parsed.Location+".json", []byte(testPlanCreate)); err != nil {
+		t.Fatalf("failed to tamper plan json: %s", err)
+	}
+	executionInput := &WorkspaceExecutionInput{
+		Action:  "apply",
+		Path:    "live/prod/vpc",
+		Client:  client,
+		PlanRef: ref,
+		Policy: &policy.Policy{
+			Rules: []*policy.Rule{{Name: "keep", Level: policy.LevelDeny, Type: policy.RuleNoDelete}},
+		},
+		DestroyProtection: &DestroyProtection{Workspace: "live/prod/vpc"},
+	}
+	err = ExecuteWorkspaceWithOutput(executionInput, strings.NewReader(""), ioutil.Discard, ioutil.Discard)
+	if err == nil || !strings.Contains(err.Error(), "artifact was modified") {
+		t.Fatalf("expected tampered plan json to be rejected, got %v", err)
+	}
+	executionInput.DestroyProtection = nil
+	err = ExecuteWorkspaceWithOutput(executionInput, strings.NewReader(""), ioutil.Discard, ioutil.Discard)
+	if err == nil || !strings.Contains(err.Error(), "artifact was modified") {
+		t.Fatalf("expected tampered plan json to be rejected by policy check, got %v", err)
+	}
+	if len(sfnClient.Started) != 0 {
+		t.Fatalf("expected apply not to be started")
+	}
+}